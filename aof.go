@@ -0,0 +1,545 @@
+package gocache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// AOFSyncPolicy controls how often the append-only file is fsynced.
+type AOFSyncPolicy int
+
+const (
+	// AOFSyncEverySec flushes and fsyncs the log once per second, so at
+	// most a second of writes can be lost in a crash.
+	AOFSyncEverySec AOFSyncPolicy = iota
+	// AOFSyncAlways fsyncs after every logged operation.
+	AOFSyncAlways
+	// AOFSyncNo flushes the log once per second and leaves syncing to the
+	// operating system.
+	AOFSyncNo
+)
+
+// defaultAOFRewriteMinSize is the smallest log that is rewritten
+// automatically when Config.AOFRewriteMinSize is not set.
+const defaultAOFRewriteMinSize = 64 << 20
+
+// Operations recorded in the append-only file.
+const (
+	opSet uint8 = iota + 1
+	opDel
+	opHSet
+	opHDel
+	opLPush
+	opRPush
+	opLPop
+	opRPop
+	opExpire
+	opFlush
+	opRestore
+	opSAdd
+	opSRem
+	opZAdd
+	opZRem
+	opLSet
+	opLInsert
+	opLRem
+	opLTrim
+	opHExpire
+	opXAdd
+	opXTrim
+	opXGroupCreate
+	opXReadGroup
+	opXAck
+	opXClaim
+)
+
+// aofRecord is one logged operation. Results rather than deltas are logged
+// where replaying the delta would not be idempotent, e.g. Increment is
+// logged as an opSet of the new value.
+type aofRecord struct {
+	Op      uint8
+	Key     string
+	Field   string
+	Value   any
+	Members []string
+	Scores  []float64
+	Start   int
+	Stop    int
+	Exp     int64
+	Cost    int64
+	Entry   *snapshotEntry
+	ID      StreamID
+	IDs     []StreamID
+	Values  map[string]any // stream entries
+	// Time is when the operation was applied, in UnixNano, so that it is
+	// replayed against the keys that had not expired then.
+	Time int64
+}
+
+// aof is an append-only operation log. Every record is framed as a
+// big-endian uint32 length and IEEE CRC-32 followed by its gob encoding.
+type aof struct {
+	mu       sync.Mutex
+	path     string
+	f        *os.File
+	w        *bufio.Writer
+	sync     AOFSyncPolicy
+	size     int64
+	baseSize int64 // size after the last rewrite
+	minSize  int64
+	err      error // first write error, sticky
+	onError  func(key string, err error)
+
+	// Records logged while a rewrite is in progress, to be appended to
+	// the rewritten log.
+	rewriting bool
+	rewBuf    bytes.Buffer
+
+	stop     chan struct{}
+	done     chan struct{}
+	rewrites sync.WaitGroup
+}
+
+func encodeRecord(r *aofRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 8))
+	if err := gob.NewEncoder(&buf).Encode(r); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[0:], uint32(len(b)-8))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[8:]))
+	return b, nil
+}
+
+// readRecords calls fn for every intact record in r. It returns the offset
+// of the end of the last intact record, so that a torn write at the end of
+// the log can be truncated.
+func readRecords(r io.Reader, fn func(*aofRecord)) (int64, error) {
+	br := bufio.NewReader(r)
+	var off int64
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return off, nil
+			}
+			return off, err
+		}
+		n := binary.BigEndian.Uint32(hdr[0:])
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return off, nil
+			}
+			return off, err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(hdr[4:]) {
+			return off, nil
+		}
+		var rec aofRecord
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+			return off, err
+		}
+		fn(&rec)
+		off += int64(len(hdr)) + int64(n)
+	}
+}
+
+// openAOF replays the log at config.AOFPath into c and opens it for
+// appending.
+func (c *cache) openAOF(config Config) error {
+	f, err := os.OpenFile(config.AOFPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	// Evictions are logged like deletes, so the policy must not pick
+	// victims of its own while replaying.
+	c.replaying = true
+	off, err := readRecords(f, c.apply)
+	c.replaying = false
+	for _, s := range c.shards {
+		s.mu.Lock()
+		evicted := s.shrink()
+		s.mu.Unlock()
+		c.evict(evicted)
+	}
+	if err == nil {
+		err = f.Truncate(off)
+	}
+	if err == nil {
+		_, err = f.Seek(off, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a := &aof{
+		path:     config.AOFPath,
+		f:        f,
+		w:        bufio.NewWriter(f),
+		sync:     config.AOFSync,
+		size:     off,
+		baseSize: off,
+		minSize:  config.AOFRewriteMinSize,
+		onError:  config.OnAOFError,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if a.minSize == 0 {
+		a.minSize = defaultAOFRewriteMinSize
+	}
+	c.aof = a
+	go a.run()
+	return nil
+}
+
+// run flushes the log in the background for the everysec and no policies.
+func (a *aof) run() {
+	defer close(a.done)
+	if a.sync == AOFSyncAlways {
+		<-a.stop
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			a.flush(a.sync == AOFSyncEverySec)
+			a.mu.Unlock()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// flush writes out buffered records. a.mu must be held.
+func (a *aof) flush(fsync bool) {
+	if a.err != nil {
+		return
+	}
+	if err := a.w.Flush(); err != nil {
+		a.fail(err)
+		return
+	}
+	if fsync {
+		if err := a.f.Sync(); err != nil {
+			a.fail(err)
+		}
+	}
+}
+
+// fail stops the log after a write error, which is reported at once. a.mu
+// must be held.
+func (a *aof) fail(err error) {
+	a.err = err
+	if a.onError != nil {
+		a.onError("", err)
+	}
+}
+
+// AOFErr returns the error that stopped the append-only file, if any. Once
+// it is set, writes are no longer logged.
+func (c *cache) AOFErr() error {
+	c.lockAll()
+	a := c.aof
+	c.unlockAll()
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// log appends r to the append-only file, if there is one. It must be called
+// with the lock of the shard owning r.Key held, so that records reach the
+// log in the order their operations were applied.
+func (c *cache) log(r aofRecord) {
+	a := c.aof
+	if a == nil {
+		return
+	}
+	r.Time = time.Now().UnixNano()
+	b, err := encodeRecord(&r)
+	if err != nil {
+		// Only this record is lost, e.g. for a value of a type not
+		// registered with gob.
+		if a.onError != nil {
+			a.onError(r.Key, err)
+		}
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return
+	}
+	if _, err := a.w.Write(b); err != nil {
+		a.fail(err)
+		return
+	}
+	a.size += int64(len(b))
+	if a.rewriting {
+		a.rewBuf.Write(b)
+	}
+	if a.sync == AOFSyncAlways {
+		a.flush(true)
+	}
+	if !a.rewriting && a.size >= a.minSize && a.size >= 2*a.baseSize {
+		a.rewriting = true
+		a.rewrites.Add(1)
+		go c.rewriteAOF(a)
+	}
+}
+
+// apply replays a logged operation. It runs before the log is opened, so
+// nothing it does is logged again, and keys and hash fields expire as they
+// had when the operation was applied, so that it is replayed exactly. Keys
+// logged by a rewrite, with no time, do not expire while replaying.
+func (c *cache) apply(r *aofRecord) {
+	c.clock = r.Time
+	if r.Op == opFlush {
+		c.Flush()
+		return
+	}
+	s := c.shardFor(r.Key)
+	var evicted []keyAndValue
+	switch r.Op {
+	case opSet:
+		s.mu.Lock()
+		item := Item{Object: r.Value, Expiration: r.Exp, cost: r.Cost}
+		if r.Cost > 0 {
+			evicted = s.storeItem(r.Key, item)
+		} else {
+			evicted = s.store(r.Key, item)
+		}
+		s.mu.Unlock()
+	case opRestore:
+		s.mu.Lock()
+		evicted = s.store(r.Key, r.Entry.item())
+		s.mu.Unlock()
+	case opDel:
+		s.mu.Lock()
+		s.delete(r.Key)
+		s.mu.Unlock()
+	case opHSet:
+		c.HSet(r.Key, r.Field, r.Value)
+		if r.Exp != 0 {
+			s.mu.Lock()
+			if h, found, _ := s.hash(r.Key); found {
+				delta := -h.fieldCost(r.Field)
+				h.expire(r.Field, r.Exp)
+				s.storeDelta(r.Key, s.items[r.Key], delta+h.fieldCost(r.Field))
+			}
+			s.mu.Unlock()
+		}
+	case opHDel:
+		c.HDel(r.Key, r.Field)
+	case opLPush:
+		c.LPush(r.Key, r.Value)
+	case opRPush:
+		c.RPush(r.Key, r.Value)
+	case opSAdd:
+		c.SAdd(r.Key, r.Members...)
+	case opSRem:
+		c.SRem(r.Key, r.Members...)
+	case opZAdd:
+		zs := make([]Z, len(r.Members))
+		for i, m := range r.Members {
+			zs[i] = Z{m, r.Scores[i]}
+		}
+		c.ZAdd(r.Key, 0, zs...)
+	case opZRem:
+		c.ZRem(r.Key, r.Members...)
+	case opLPop:
+		c.LPop(r.Key)
+	case opRPop:
+		c.RPop(r.Key)
+	case opLSet:
+		c.LSet(r.Key, r.Start, r.Value)
+	case opLInsert:
+		s.mu.Lock()
+		if d, found, _ := s.list(r.Key); found && r.Start <= d.Len() {
+			d.insert(r.Start, r.Value)
+			c.storeList(s, r.Key, d, elementCost(r.Value), "")
+		}
+		s.mu.Unlock()
+	case opLRem:
+		c.LRem(r.Key, r.Start, r.Value)
+	case opLTrim:
+		c.LTrim(r.Key, r.Start, r.Stop)
+	case opHExpire:
+		s.mu.Lock()
+		if h, found, _ := s.hash(r.Key); found {
+			var delta int64
+			for _, f := range r.Members {
+				if _, ok := h.fields[f]; ok {
+					delta -= h.fieldCost(f)
+					h.expire(f, r.Exp)
+					delta += h.fieldCost(f)
+				}
+			}
+			s.storeDelta(r.Key, s.items[r.Key], delta)
+		}
+		s.mu.Unlock()
+	case opXAdd, opXTrim, opXGroupCreate, opXReadGroup, opXAck, opXClaim:
+		evicted = c.applyStream(s, r)
+	case opExpire:
+		s.mu.Lock()
+		if item, found := s.items[r.Key]; found {
+			item.Expiration = r.Exp
+			item.version = s.nextVersion()
+			s.items[r.Key] = item
+		}
+		s.mu.Unlock()
+	}
+	c.evict(evicted)
+}
+
+// RewriteAOF compacts the append-only file into the shortest log that
+// recreates the current contents of the cache. Writes continue while the
+// new log is written in the background; RewriteAOF waits for it to finish.
+// Rewrites also start automatically whenever the log has doubled in size
+// since the last one and is larger than Config.AOFRewriteMinSize.
+func (c *cache) RewriteAOF() error {
+	c.lockAll()
+	a := c.aof
+	c.unlockAll()
+	if a == nil {
+		return errors.New("gocache: no append-only file configured")
+	}
+	a.mu.Lock()
+	if a.rewriting {
+		a.mu.Unlock()
+		return errors.New("gocache: append-only file rewrite already in progress")
+	}
+	a.rewriting = true
+	a.rewrites.Add(1)
+	a.mu.Unlock()
+	return c.rewriteAOF(a)
+}
+
+func (c *cache) rewriteAOF(a *aof) error {
+	defer a.rewrites.Done()
+	// Copy the cache and start buffering new records at the same instant:
+	// every write logs while holding its shard lock, so none can slip
+	// between the copy and the buffer.
+	c.lockAll()
+	a.mu.Lock()
+	a.rewBuf.Reset()
+	a.mu.Unlock()
+	entries := c.entriesLocked()
+	c.unlockAll()
+
+	err := a.rewrite(entries)
+	a.mu.Lock()
+	a.rewriting = false
+	a.rewBuf.Reset()
+	a.mu.Unlock()
+	return err
+}
+
+func (a *aof) rewrite(entries []snapshotEntry) error {
+	f, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".rewrite")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	var size int64
+	for i := range entries {
+		b, err := encodeRecord(&aofRecord{Op: opRestore, Key: entries[i].Key, Entry: &entries[i]})
+		if err != nil {
+			// The record was already dropped, and reported, when its
+			// write was logged.
+			continue
+		}
+		w.Write(b)
+		size += int64(len(b))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err = w.Write(a.rewBuf.Bytes()); err == nil {
+		size += int64(a.rewBuf.Len())
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), a.path)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// Switch to the new log. Records still buffered for the old file are
+	// already part of rewBuf.
+	a.w.Reset(f)
+	old := a.f
+	a.f = f
+	a.size = size
+	a.baseSize = size
+	old.Close()
+	return nil
+}
+
+// entriesLocked is like entries, for callers already holding every shard
+// lock.
+func (c *cache) entriesLocked() []snapshotEntry {
+	var out []snapshotEntry
+	now := time.Now().UnixNano()
+	for _, s := range c.shards {
+		for k, v := range s.items {
+			if !persisted(v, now) {
+				continue
+			}
+			out = append(out, newSnapshotEntry(k, v))
+		}
+	}
+	return out
+}
+
+// Close stops the janitor and flushes the writes queued for a write-behind
+// Writer, then flushes and closes the append-only file, if any, and reports
+// the first error encountered while writing it. The cache stays usable, but
+// expired items are no longer deleted in the background, and later writes
+// are no longer logged nor given to a write-behind Writer.
+func (c *cache) Close() error {
+	if c.janitor != nil {
+		c.janitor.Stop()
+	}
+	if c.writeBehind != nil {
+		c.writeBehind.close()
+	}
+	c.lockAll()
+	a := c.aof
+	c.aof = nil
+	c.unlockAll()
+	if a == nil {
+		return nil
+	}
+	close(a.stop)
+	<-a.done
+	a.rewrites.Wait()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flush(true)
+	if err := a.f.Close(); a.err == nil {
+		a.err = err
+	}
+	return a.err
+}
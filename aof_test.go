@@ -0,0 +1,324 @@
+package gocache
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func aofState(tc *Cache) map[string]any {
+	m := map[string]any{}
+	for k, v := range tc.Items() {
+		m[k] = newSnapshotEntry(k, v)
+	}
+	return m
+}
+
+func TestCache_AOF_Replay(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	cf := Config{AOFPath: fname, AOFSync: AOFSyncAlways}
+	tc := NewCache(cf)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Increment("a", 5)
+	tc.Decrement("a", 2)
+	tc.Set("b", "bar", time.Hour)
+	tc.SetExpiration("b", 2*time.Hour)
+	tc.Set("gone", 1, DefaultExpiration)
+	tc.Delete("gone")
+	tc.HSet("h", "f1", "v1")
+	tc.HSet("h", "f2", "v2")
+	tc.HDel("h", "f1")
+	tc.HIncrBy("h", "n", 3)
+	tc.HExpire("h", time.Hour, "n", "f2")
+	tc.HIncrBy("h", "n", 1)
+	tc.HPersist("h", "f2")
+	for i := 0; i < 4; i++ {
+		tc.LPush("l", i)
+		tc.RPush("l", -i)
+	}
+	tc.LPop("l")
+	tc.RPop("l")
+	tc.LSet("l", 1, "set")
+	tc.LInsert("l", true, "set", "ins")
+	tc.LRem("l", -1, -1)
+	tc.LTrim("l", 0, 3)
+	tc.LMove("l", "l2", Right, Left)
+	tc.SAdd("s", "a", "b", "c")
+	tc.SRem("s", "b")
+	tc.SAdd("s2", "c", "d")
+	tc.SMove("s", "s2", "a")
+	tc.SUnionStore("u", "s", "s2")
+	tc.SPop("s2", 1)
+	tc.ZAdd("z", 0, Z{"a", 1}, Z{"b", 2}, Z{"c", 3})
+	tc.ZIncrBy("z", 5, "a")
+	tc.ZRem("z", "b")
+	tc.ZPopMax("z", 1)
+	tc.SetWithCost("c", []byte("x"), 7, DefaultExpiration)
+	first, _ := tc.XAdd("x", XAddArgs{Values: map[string]any{"n": 1}})
+	tc.XGroupCreate("x", "g", MinStreamID, false)
+	tc.XGroupCreate("x", "h", MaxStreamID, false)
+	group := XReadGroupArgs{Group: "g", Consumer: "c1", Keys: []string{"x"}, IDs: []StreamID{MaxStreamID}}
+	tc.XReadGroup(context.Background(), group)
+	tc.XAdd("x", XAddArgs{Values: map[string]any{"n": 2}})
+	last, _ := tc.XAdd("x", XAddArgs{Values: map[string]any{"n": 3}, MaxLen: 2})
+	group.Consumer = "c2"
+	tc.XReadGroup(context.Background(), group)
+	tc.XClaim("x", "g", "c2", 0, first)
+	tc.XAck("x", "g", last)
+	want := aofState(tc)
+	if err := tc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tc2, err := OpenCache(cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc2.Close()
+	if got := aofState(tc2); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed state differs:\n got %v\nwant %v", got, want)
+	}
+	if x, _ := tc2.Get("a"); x.(int) != 4 {
+		t.Error("a should be 4, got", x)
+	}
+	if tc2.Cost() != 7 {
+		t.Error("the explicit cost of c was not replayed:", tc2.Cost())
+	}
+}
+
+func TestCache_AOF_FlushAndEviction(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	cf := Config{AOFPath: fname, AOFSync: AOFSyncNo, MaxEntries: 2, EvictionPolicy: NewRandomPolicy}
+	tc := NewCache(cf)
+	tc.Set("old", 1, DefaultExpiration)
+	tc.Flush()
+	for i := 0; i < 10; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	want := aofState(tc)
+	tc.Close()
+
+	// Random evictions are logged, so the replay ends with the same keys.
+	tc2 := NewCache(cf)
+	defer tc2.Close()
+	if got := aofState(tc2); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed state differs:\n got %v\nwant %v", got, want)
+	}
+}
+
+type unregistered struct{ N int }
+
+func TestCache_AOF_EncodeError(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	var failed []string
+	cf := Config{AOFPath: fname, AOFSync: AOFSyncAlways, OnAOFError: func(k string, err error) {
+		failed = append(failed, k)
+	}}
+	tc := NewCache(cf)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("t", unregistered{1}, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	if !reflect.DeepEqual(failed, []string{"t"}) {
+		t.Error("OnAOFError should report the record that failed to encode, got", failed)
+	}
+	if err := tc.AOFErr(); err != nil {
+		t.Error("an encoding error should not stop the log:", err)
+	}
+	if err := tc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tc2 := NewCache(Config{AOFPath: fname})
+	defer tc2.Close()
+	if _, found := tc2.Get("t"); found {
+		t.Error("t could not have been logged")
+	}
+	if x, _ := tc2.Get("b"); x != 2 {
+		t.Error("writes after a failed record were lost, b =", x)
+	}
+}
+
+func TestCache_AOF_ReplayExpired(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	cf := Config{AOFPath: fname}
+	tc := NewCache(cf)
+	tc.LPush("l", 1)
+	tc.SetExpiration("l", 20*time.Millisecond)
+	tc.LPush("l", 2)
+	tc.HSet("h", "f", 1)
+	tc.HExpire("h", 20*time.Millisecond, "f")
+	tc.HSet("h", "g", 2)
+	tc.SAdd("s", "a")
+	tc.SetExpiration("s", 10*time.Millisecond)
+	time.Sleep(15 * time.Millisecond)
+	tc.SAdd("s", "b") // s expired: a new set without a TTL
+	tc.Close()
+
+	time.Sleep(20 * time.Millisecond)
+	tc2 := NewCache(cf)
+	defer tc2.Close()
+	if n, _ := tc2.LLen("l"); n != 0 {
+		t.Error("an expired list came back with", n, "elements")
+	}
+	if _, found := tc2.HGet("h", "f"); found {
+		t.Error("an expired hash field came back")
+	}
+	if x, _ := tc2.HGet("h", "g"); x != 2 {
+		t.Error("h.g =", x)
+	}
+	if m, _ := tc2.SMembers("s"); len(m) != 1 || m[0] != "b" {
+		t.Error("a set recreated after it expired should only hold b, got", m)
+	}
+	if ttl, _ := tc2.TTL("s"); ttl != NoExpiration {
+		t.Error("a set recreated after it expired should not expire, TTL", ttl)
+	}
+}
+
+func TestCache_AOF_ReplayError(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	payload := []byte("not a record")
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(payload))
+	if err := os.WriteFile(fname, append(b, payload...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cf := Config{
+		AOFPath:         fname,
+		CleanupInterval: time.Millisecond,
+		Writer:          &mapStore{m: map[string]any{}},
+		WriteBehind:     time.Millisecond,
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		if _, err := OpenCache(cf); err == nil {
+			t.Fatal("OpenCache replayed a corrupt log")
+		}
+	}
+	if n := runtime.NumGoroutine(); n >= before+10 {
+		t.Errorf("failed OpenCache calls leaked goroutines: %d, was %d", n, before)
+	}
+}
+
+func TestCache_AOF_ReplayJanitor(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	cf := Config{AOFPath: fname}
+	tc := NewCache(cf)
+	for i := 0; i < 1000; i++ {
+		tc.Set(strconv.Itoa(i), i, time.Millisecond)
+	}
+	tc.Close()
+	// The janitor must not run while the log is replayed.
+	cf.CleanupInterval = time.Microsecond
+	tc2 := NewCache(cf)
+	defer tc2.Close()
+	time.Sleep(5 * time.Millisecond)
+	tc2.Set("a", 1, DefaultExpiration)
+}
+
+func TestCache_AOF_CloseStopsJanitor(t *testing.T) {
+	tc := NewCache(Config{AOFPath: filepath.Join(t.TempDir(), "cache.aof"), CleanupInterval: time.Millisecond})
+	tc.Set("a", 1, time.Millisecond)
+	if err := tc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tc.janitor.done:
+	default:
+		t.Fatal("Close did not stop the janitor")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if tc.ItemCount() != 1 {
+		t.Error("the janitor swept the cache after Close")
+	}
+	stopJanitor(tc) // as the finalizer does
+}
+
+func TestCache_AOF_TornWrite(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	cf := Config{AOFPath: fname}
+	tc := NewCache(cf)
+	tc.Set("a", "x", DefaultExpiration)
+	tc.Close()
+
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	f.Close()
+
+	tc2 := NewCache(cf)
+	tc2.Set("b", "y", DefaultExpiration)
+	tc2.Close()
+	tc3 := NewCache(cf)
+	defer tc3.Close()
+	if _, found := tc3.Get("a"); !found {
+		t.Error("a was lost")
+	}
+	if _, found := tc3.Get("b"); !found {
+		t.Error("b was lost behind the torn record")
+	}
+}
+
+func TestCache_AOF_Rewrite(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	cf := Config{AOFPath: fname}
+	tc := NewCache(cf)
+	for i := 0; i < 1000; i++ {
+		tc.Set("k"+strconv.Itoa(i%10), i, DefaultExpiration)
+		tc.LPush("l", i)
+		tc.LPop("l")
+	}
+	tc.HSet("h", "f", "v")
+	tc.LPush("l", "kept")
+	before, _ := os.Stat(fname)
+	tc.Close()
+	tc = NewCache(cf)
+	if err := tc.RewriteAOF(); err != nil {
+		t.Fatal(err)
+	}
+	tc.Set("after", 1, DefaultExpiration)
+	want := aofState(tc)
+	if err := tc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(fname)
+	if after.Size() >= before.Size()/10 {
+		t.Errorf("log was not compacted: %d -> %d bytes", before.Size(), after.Size())
+	}
+
+	tc2 := NewCache(cf)
+	defer tc2.Close()
+	if got := aofState(tc2); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed state differs:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestCache_AOF_AutoRewrite(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.aof")
+	cf := Config{AOFPath: fname, AOFRewriteMinSize: 4096}
+	tc := NewCache(cf)
+	for i := 0; i < 2000; i++ {
+		tc.Set("k", i, DefaultExpiration)
+	}
+	if err := tc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(fname)
+	if fi.Size() > 64*1024 {
+		t.Error("log was never rewritten, size", fi.Size())
+	}
+	tc2 := NewCache(cf)
+	defer tc2.Close()
+	if x, _ := tc2.Get("k"); x.(int) != 1999 {
+		t.Error("k should be 1999, got", x)
+	}
+}
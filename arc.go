@@ -0,0 +1,152 @@
+package gocache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// arc list identifiers.
+const (
+	arcT1 = iota // resident, seen once
+	arcT2        // resident, seen at least twice
+	arcB1        // ghost, evicted from t1
+	arcB2        // ghost, evicted from t2
+)
+
+type arcEntry struct {
+	key  string
+	list int
+}
+
+type arcPolicy struct {
+	mu       sync.Mutex
+	capacity int
+	// p is the adaptive target size of t1.
+	p     int
+	lists [4]*list.List
+	elems map[string]*list.Element
+}
+
+// NewARCPolicy returns an Adaptive Replacement Cache policy, which balances
+// recency and frequency by keeping ghost entries for recently evicted keys
+// and adapting to which of them get requested again.
+func NewARCPolicy(capacity int) EvictionPolicy {
+	if capacity < 1 {
+		capacity = 1
+	}
+	a := &arcPolicy{capacity: capacity}
+	for i := range a.lists {
+		a.lists[i] = list.New()
+	}
+	a.elems = make(map[string]*list.Element)
+	return a
+}
+
+func (a *arcPolicy) move(e *list.Element, to int) {
+	ent := e.Value.(*arcEntry)
+	a.lists[ent.list].Remove(e)
+	ent.list = to
+	a.elems[ent.key] = a.lists[to].PushFront(ent)
+}
+
+func (a *arcPolicy) Access(k string) {
+	a.mu.Lock()
+	if e, ok := a.elems[k]; ok {
+		if l := e.Value.(*arcEntry).list; l == arcT1 || l == arcT2 {
+			a.move(e, arcT2)
+		}
+	}
+	a.mu.Unlock()
+}
+
+func (a *arcPolicy) Insert(k string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.elems[k]
+	if !ok {
+		a.elems[k] = a.lists[arcT1].PushFront(&arcEntry{key: k, list: arcT1})
+		return
+	}
+	b1, b2 := a.lists[arcB1].Len(), a.lists[arcB2].Len()
+	switch e.Value.(*arcEntry).list {
+	case arcB1:
+		delta := 1
+		if b1 > 0 && b2 > b1 {
+			delta = b2 / b1
+		}
+		a.p += delta
+		if a.p > a.capacity {
+			a.p = a.capacity
+		}
+	case arcB2:
+		delta := 1
+		if b2 > 0 && b1 > b2 {
+			delta = b1 / b2
+		}
+		a.p -= delta
+		if a.p < 0 {
+			a.p = 0
+		}
+	}
+	a.move(e, arcT2)
+}
+
+func (a *arcPolicy) Remove(k string) {
+	a.mu.Lock()
+	if e, ok := a.elems[k]; ok {
+		// Evicted keys have already been turned into ghosts by Victim.
+		if l := e.Value.(*arcEntry).list; l == arcT1 || l == arcT2 {
+			a.lists[l].Remove(e)
+			delete(a.elems, k)
+		}
+	}
+	a.mu.Unlock()
+}
+
+func (a *arcPolicy) Victim() (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t1, t2 := a.lists[arcT1], a.lists[arcT2]
+	var e *list.Element
+	var ghost int
+	switch {
+	case t1.Len() > 0 && (t1.Len() > a.p || t2.Len() == 0):
+		e, ghost = t1.Back(), arcB1
+	case t2.Len() > 0:
+		e, ghost = t2.Back(), arcB2
+	default:
+		return "", false
+	}
+	key := e.Value.(*arcEntry).key
+	a.move(e, ghost)
+	a.trimGhosts()
+	return key, true
+}
+
+// trimGhosts keeps the directory within the bounds ARC requires:
+// |t1|+|b1| <= c and |t1|+|t2|+|b1|+|b2| <= 2c.
+func (a *arcPolicy) trimGhosts() {
+	b1, b2 := a.lists[arcB1], a.lists[arcB2]
+	for b1.Len() > 0 && a.lists[arcT1].Len()+b1.Len() > a.capacity {
+		a.drop(b1.Back())
+	}
+	for b2.Len() > 0 && len(a.elems) > 2*a.capacity {
+		a.drop(b2.Back())
+	}
+}
+
+func (a *arcPolicy) drop(e *list.Element) {
+	ent := e.Value.(*arcEntry)
+	a.lists[ent.list].Remove(e)
+	delete(a.elems, ent.key)
+}
+
+func (a *arcPolicy) Reset() {
+	a.mu.Lock()
+	for _, l := range a.lists {
+		l.Init()
+	}
+	a.p = 0
+	a.elems = make(map[string]*list.Element)
+	a.mu.Unlock()
+}
@@ -0,0 +1,211 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTimeout is returned by BLPop, BRPop and BLMove when the timeout elapses
+// before an element is available.
+var ErrTimeout = errors.New("gocache: timeout")
+
+// waiter is a goroutine blocked until an element is pushed onto one of its
+// keys. It is queued on every key it waits for; the first push onto any of
+// them claims it, pops an element for it and hands it over on ch.
+type waiter struct {
+	end     ListEnd
+	ch      chan keyAndValue
+	claimed uint32
+}
+
+func (w *waiter) claim() bool {
+	return atomic.CompareAndSwapUint32(&w.claimed, 0, 1)
+}
+
+// BLPop removes and returns the leftmost element of the first non-empty list
+// stored under keys, along with its key. If every list is empty it blocks
+// until an element is pushed onto one of them. Goroutines blocked on the
+// same key are served in the order they arrived.
+//
+// BLPop returns ErrTimeout if timeout elapses first, or ctx.Err() if ctx is
+// done first. A timeout of 0 blocks until an element arrives or ctx is done.
+func (c *cache) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (string, any, error) {
+	return c.bpop(ctx, timeout, keys, Left)
+}
+
+// BRPop is like BLPop, but pops from the right end of the lists.
+func (c *cache) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (string, any, error) {
+	return c.bpop(ctx, timeout, keys, Right)
+}
+
+func (c *cache) bpop(ctx context.Context, timeout time.Duration, keys []string, end ListEnd) (string, any, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	ss := c.shardsFor(keys)
+	lockShards(ss)
+	for _, k := range keys {
+		s := c.shardFor(k)
+		if _, found, err := s.list(k); err != nil || found {
+			var x any
+			if found {
+				x, _ = c.pop(s, k, end)
+			}
+			unlockShards(ss)
+			return k, x, err
+		}
+	}
+	w := c.enqueue(keys, end)
+	unlockShards(ss)
+	kv, err := c.wait(ctx, timeout, w, keys)
+	if err != nil {
+		return "", nil, err
+	}
+	return kv.key, kv.value, nil
+}
+
+// BLMove is the blocking variant of LMove: if the list stored under src is
+// empty, it blocks like BLPop until an element is pushed onto it, then moves
+// that element onto dst. An element that arrives while BLMove is blocked is
+// popped from src and pushed onto dst in two steps, so other goroutines may
+// briefly observe it in neither list.
+func (c *cache) BLMove(ctx context.Context, timeout time.Duration, src, dst string, from, to ListEnd) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ss := c.shardsFor([]string{src, dst})
+	lockShards(ss)
+	ssrc, sdst := c.shardFor(src), c.shardFor(dst)
+	_, found, err := ssrc.list(src)
+	if err == nil {
+		_, _, err = sdst.list(dst)
+	}
+	if err != nil || found {
+		var x any
+		var evicted []keyAndValue
+		if found {
+			x, _ = c.pop(ssrc, src, from)
+			_, evicted = c.push(sdst, dst, to, x)
+		}
+		unlockShards(ss)
+		c.evict(evicted)
+		return x, err
+	}
+	keys := []string{src}
+	w := c.enqueue(keys, from)
+	unlockShards(ss)
+	kv, err := c.wait(ctx, timeout, w, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	sdst.mu.Lock()
+	if _, _, err := sdst.list(dst); err != nil {
+		sdst.mu.Unlock()
+		// dst changed type while we were blocked; give the element back.
+		ssrc.mu.Lock()
+		_, evicted := c.push(ssrc, src, from, kv.value)
+		ssrc.mu.Unlock()
+		c.evict(evicted)
+		return nil, err
+	}
+	_, evicted := c.push(sdst, dst, to, kv.value)
+	sdst.mu.Unlock()
+	c.evict(evicted)
+	return kv.value, nil
+}
+
+// enqueue queues a new waiter on keys. The shards owning keys must be
+// locked.
+func (c *cache) enqueue(keys []string, end ListEnd) *waiter {
+	w := &waiter{end: end, ch: make(chan keyAndValue, 1)}
+	for _, k := range keys {
+		s := c.shardFor(k)
+		if s.waiters == nil {
+			s.waiters = make(map[string][]*waiter)
+		}
+		s.waiters[k] = append(s.waiters[k], w)
+	}
+	return w
+}
+
+// wait blocks until w is handed an element, ctx is done or timeout elapses,
+// and then removes w from the queues of keys.
+func (c *cache) wait(ctx context.Context, timeout time.Duration, w *waiter, keys []string) (keyAndValue, error) {
+	defer c.dequeue(w, keys)
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	var err error
+	select {
+	case kv := <-w.ch:
+		return kv, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-expired:
+		err = ErrTimeout
+	}
+	if w.claim() {
+		return keyAndValue{}, err
+	}
+	// A push claimed w before we could give up, so an element has already
+	// been popped for it and must not be lost.
+	return <-w.ch, nil
+}
+
+// dequeue removes w from the queues of keys.
+func (c *cache) dequeue(w *waiter, keys []string) {
+	ss := c.shardsFor(keys)
+	lockShards(ss)
+	for _, k := range keys {
+		s := c.shardFor(k)
+		ws := s.waiters[k]
+		n := 0
+		for _, x := range ws {
+			if x != w {
+				ws[n] = x
+				n++
+			}
+		}
+		for i := n; i < len(ws); i++ {
+			ws[i] = nil
+		}
+		if n == 0 {
+			delete(s.waiters, k)
+		} else {
+			s.waiters[k] = ws[:n]
+		}
+	}
+	unlockShards(ss)
+}
+
+// serveWaiters hands elements of the list under k to the goroutines blocked
+// on it, oldest first, until the list or the queue is empty. Waiters that
+// were already served through another key or gave up are skipped. s.mu must
+// be held.
+func (c *cache) serveWaiters(s *shard, k string) {
+	ws := s.waiters[k]
+	for len(ws) > 0 {
+		if _, found, _ := s.list(k); !found {
+			break
+		}
+		w := ws[0]
+		ws[0] = nil
+		ws = ws[1:]
+		if !w.claim() {
+			continue
+		}
+		x, _ := c.pop(s, k, w.end)
+		w.ch <- keyAndValue{k, x}
+	}
+	if len(ws) == 0 {
+		delete(s.waiters, k)
+	} else {
+		s.waiters[k] = ws
+	}
+}
@@ -0,0 +1,192 @@
+package gocache
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForWaiters waits until n goroutines are blocked on k.
+func waitForWaiters(t *testing.T, tc *Cache, k string, n int) {
+	t.Helper()
+	s := tc.shardFor(k)
+	for i := 0; i < 1000; i++ {
+		s.mu.RLock()
+		m := len(s.waiters[k])
+		s.mu.RUnlock()
+		if m == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d goroutines never blocked on %s", n, k)
+}
+
+func TestCache_BLPop_Available(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	ctx := context.Background()
+	newList(tc, "b", 1, 2)
+	k, x, err := tc.BLPop(ctx, 0, "a", "b")
+	if err != nil || k != "b" || x != 1 {
+		t.Error("BLPop:", k, x, err)
+	}
+	k, x, err = tc.BRPop(ctx, 0, "a", "b")
+	if err != nil || k != "b" || x != 2 {
+		t.Error("BRPop:", k, x, err)
+	}
+	tc.Set("str", "x", DefaultExpiration)
+	if _, _, err := tc.BLPop(ctx, 0, "str"); err != ErrWrongType {
+		t.Error("BLPop on a string should fail, got", err)
+	}
+}
+
+func TestCache_BLPop_TimeoutAndCancel(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if _, _, err := tc.BLPop(context.Background(), 10*time.Millisecond, "k"); err != ErrTimeout {
+		t.Error("expected ErrTimeout, got", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, _, err := tc.BLPop(ctx, 0, "k")
+		errc <- err
+	}()
+	waitForWaiters(t, tc, "k", 1)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+	if _, _, err := tc.BLPop(ctx, 0, "k"); err != context.Canceled {
+		t.Error("BLPop with a done context should fail, got", err)
+	}
+	waitForWaiters(t, tc, "k", 0)
+	tc.LPush("k", 1)
+	if n, _ := tc.LLen("k"); n != 1 {
+		t.Error("a canceled BLPop consumed a pushed element")
+	}
+}
+
+func TestCache_BLPop_FIFO(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	const n = 5
+	got := make([]chan any, n)
+	for i := range got {
+		got[i] = make(chan any, 1)
+		ch := got[i]
+		go func() {
+			_, x, _ := tc.BLPop(context.Background(), 0, "q")
+			ch <- x
+		}()
+		waitForWaiters(t, tc, "q", i+1)
+	}
+	for i := 0; i < n; i++ {
+		tc.RPush("q", i)
+	}
+	for i, ch := range got {
+		if x := <-ch; x != i {
+			t.Errorf("waiter %d got %v", i, x)
+		}
+	}
+	if n, _ := tc.LLen("q"); n != 0 {
+		t.Error("list not drained:", n)
+	}
+}
+
+func TestCache_BLPop_MultipleKeys(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	type result struct {
+		k string
+		x any
+	}
+	done := make(chan result)
+	go func() {
+		k, x, _ := tc.BRPop(context.Background(), 0, "a", "b")
+		done <- result{k, x}
+	}()
+	waitForWaiters(t, tc, "a", 1)
+	waitForWaiters(t, tc, "b", 1)
+	tc.LPush("b", "x")
+	if r := <-done; r.k != "b" || r.x != "x" {
+		t.Error("BRPop:", r)
+	}
+	waitForWaiters(t, tc, "a", 0)
+	tc.LPush("a", "y")
+	if n, _ := tc.LLen("a"); n != 1 {
+		t.Error("a served waiter consumed another element")
+	}
+}
+
+func TestCache_BLMove(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	ctx := context.Background()
+	newList(tc, "src", 1)
+	if x, err := tc.BLMove(ctx, 0, "src", "dst", Left, Right); err != nil || x != 1 {
+		t.Error("BLMove:", x, err)
+	}
+	done := make(chan any)
+	go func() {
+		x, _ := tc.BLMove(ctx, 0, "src", "dst", Right, Left)
+		done <- x
+	}()
+	waitForWaiters(t, tc, "src", 1)
+	tc.RPush("src", 2)
+	if x := <-done; x != 2 {
+		t.Error("BLMove moved", x)
+	}
+	if got, _ := tc.LRange("dst", 0, -1); !reflect.DeepEqual(got, []any{2, 1}) {
+		t.Error("dst holds", got)
+	}
+	if _, err := tc.BLMove(ctx, time.Millisecond, "src", "dst", Left, Left); err != ErrTimeout {
+		t.Error("expected ErrTimeout, got", err)
+	}
+}
+
+func TestCache_BLPop_Concurrent(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	const producers, consumers, per = 4, 8, 100
+	var wg sync.WaitGroup
+	results := make(chan any, producers*per)
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, x, err := tc.BLPop(context.Background(), 100*time.Millisecond, "q1", "q2")
+				if err != nil {
+					return
+				}
+				results <- x
+			}
+		}()
+	}
+	for i := 0; i < producers; i++ {
+		i := i
+		go func() {
+			for j := 0; j < per; j++ {
+				if j%2 == 0 {
+					tc.LPush("q1", i*per+j)
+				} else {
+					tc.RPush("q2", i*per+j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+	var got []int
+	for x := range results {
+		got = append(got, x.(int))
+	}
+	sort.Ints(got)
+	if len(got) != producers*per {
+		t.Fatalf("consumed %d elements, want %d", len(got), producers*per)
+	}
+	for i, x := range got {
+		if x != i {
+			t.Fatalf("element %d consumed as %d", i, x)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetMany returns the values of the keys that are in the cache, reading each
+// shard once. With a Loader, the missing keys are loaded in a single call to
+// LoadAll if it is a BatchLoader, and keys it does not find are left out.
+// The values loaded, and the errors, are cached as set by
+// Config.LoaderOptions, as they are by Get.
+func (c *cache) GetMany(keys ...string) map[string]any {
+	out, missing := c.getMany(keys)
+	if c.loader == nil || len(missing) == 0 {
+		return out
+	}
+	loaded, _ := c.memoizeMany(missing, c.loadAll, func(values map[string]any, failed []string, err error) {
+		for k, x := range values {
+			c.storeLoaded(k, x, c.loaderOptions)
+		}
+		if err == nil {
+			err = ErrNotFound
+		}
+		for _, k := range failed {
+			c.storeError(k, err, c.loaderOptions)
+		}
+	})
+	for k, x := range loaded {
+		out[k] = x
+	}
+	return out
+}
+
+// getMany returns the values of the keys in the cache, and the keys that are
+// missing. Keys holding an error cached by MemoizeCtx are neither.
+func (c *cache) getMany(keys []string) (map[string]any, []string) {
+	out := make(map[string]any, len(keys))
+	var missing []string
+	ss := c.shardsFor(keys)
+	rlockShards(ss)
+	for _, k := range keys {
+		x, found := c.shardFor(k).get(k)
+		if !found {
+			missing = append(missing, k)
+		} else if _, ok := x.(*CachedError); !ok {
+			out[k] = x
+		}
+	}
+	runlockShards(ss)
+	return out, missing
+}
+
+// loadAll loads keys with the Loader.
+func (c *cache) loadAll(keys []string) (map[string]any, error) {
+	ctx := context.Background()
+	if bl, ok := c.loader.(BatchLoader); ok {
+		return bl.LoadAll(ctx, keys)
+	}
+	out := make(map[string]any, len(keys))
+	for _, k := range keys {
+		x, err := c.loader.Load(ctx, k)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[k] = x
+	}
+	return out, nil
+}
+
+// SetMany sets the values of items, locking each shard once. It is not
+// atomic, unlike MSet: with a Writer, the keys it fails to write are left
+// unchanged.
+func (c *cache) SetMany(items map[string]any, d time.Duration) {
+	e := c.expiration(d)
+	ss := c.shardsFor(mapKeys(items))
+	lockShards(ss)
+	if failed := c.writeMany(items, nil); len(failed) > 0 {
+		items = withoutKeys(items, failed)
+	}
+	evicted := c.mset(items, e, "SetMany")
+	unlockShards(ss)
+	c.evict(evicted)
+}
+
+// DeleteMany deletes keys, locking each shard once, and returns the number
+// that were in the cache. With a Writer, the keys it fails to delete are
+// left unchanged.
+func (c *cache) DeleteMany(keys ...string) int {
+	ss := c.shardsFor(keys)
+	lockShards(ss)
+	failed := c.writeMany(nil, keys)
+	n := 0
+	var evicted []keyAndValue
+	for _, k := range keys {
+		if failed[k] != nil {
+			continue
+		}
+		s := c.shardFor(k)
+		if _, found := s.item(k); found {
+			n++
+		}
+		c.notifyDelete(s, EventDelete, k, "DeleteMany")
+		if v, ok := s.delete(k); ok {
+			evicted = append(evicted, keyAndValue{k, v})
+		}
+	}
+	unlockShards(ss)
+	c.evict(evicted)
+	return n
+}
+
+// withoutKeys returns a copy of items without the keys in failed.
+func withoutKeys(items map[string]any, failed map[string]error) map[string]any {
+	written := make(map[string]any, len(items))
+	for k, x := range items {
+		if failed[k] == nil {
+			written[k] = x
+		}
+	}
+	return written
+}
+
+// MemoizeMany returns the values of keys, calling fn once with the keys
+// missing from the cache and storing the values it returns. Keys being
+// loaded by a concurrent MemoizeMany or Memoize are waited for rather than
+// passed to fn. Keys fn does not return are left out. The error of fn, or
+// of a concurrent load waited for, is returned with the values obtained.
+func (c *cache) MemoizeMany(keys []string, fn func(missing []string) (map[string]any, error), d time.Duration) (map[string]any, error) {
+	out, missing := c.getMany(keys)
+	loaded, err := c.memoizeMany(missing, fn, func(values map[string]any, _ []string, _ error) {
+		e := c.expiration(d)
+		ss := c.shardsFor(mapKeys(values))
+		lockShards(ss)
+		evicted := c.mset(values, e, "MemoizeMany")
+		unlockShards(ss)
+		c.evict(evicted)
+	})
+	for k, x := range loaded {
+		out[k] = x
+	}
+	return out, err
+}
+
+// memoizeMany loads the missing keys, as MemoizeMany does, and gives store
+// the values fn returns and the keys it failed to load, with its error.
+func (c *cache) memoizeMany(missing []string, fn func([]string) (map[string]any, error), store func(values map[string]any, failed []string, err error)) (map[string]any, error) {
+	out := make(map[string]any, len(missing))
+	var owned []string
+	calls := make(map[string]*call[any], len(missing))
+	for _, k := range missing {
+		if _, dup := calls[k]; dup {
+			continue
+		}
+		call, started := c.group.claim(k)
+		calls[k] = call
+		if started {
+			owned = append(owned, k)
+		}
+	}
+
+	var err error
+	if len(owned) > 0 {
+		err = c.loadMany(owned, calls, fn, store, out)
+	}
+	for k, call := range calls {
+		if _, ok := out[k]; ok {
+			continue
+		}
+		<-call.done
+		switch {
+		case call.err == nil:
+			out[k] = call.val
+		case err == nil && !errors.Is(call.err, ErrNotFound):
+			err = call.err
+		}
+	}
+	return out, err
+}
+
+// loadMany calls fn with the keys claimed by memoizeMany that are still
+// missing from the cache, stores the values it returns in out and, with
+// store, the cache, and releases the keys. If fn panics, the keys are
+// released with an error before the panic goes on.
+func (c *cache) loadMany(owned []string, calls map[string]*call[any], fn func([]string) (map[string]any, error), store func(map[string]any, []string, error), out map[string]any) (err error) {
+	values := map[string]any{}
+	cached := map[string]error{}
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("gocache: MemoizeMany loader panicked: %v", r)
+		}
+		for _, k := range owned {
+			if x, ok := values[k]; ok {
+				c.group.release(k, calls[k], x, nil)
+			} else if e, ok := cached[k]; ok {
+				c.group.release(k, calls[k], nil, e)
+			} else if err != nil {
+				c.group.release(k, calls[k], nil, err)
+			} else {
+				c.group.release(k, calls[k], nil, ErrNotFound)
+			}
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	// A load that completed since the caller read the cache may have
+	// stored some of the keys.
+	var missing []string
+	ss := c.shardsFor(owned)
+	rlockShards(ss)
+	for _, k := range owned {
+		item, found := c.shardFor(k).memoized(k)
+		switch {
+		case !found:
+			missing = append(missing, k)
+		case isCachedError(item):
+			cached[k] = item.Object.(*CachedError)
+		default:
+			values[k] = item.Object
+			out[k] = item.Object
+		}
+	}
+	runlockShards(ss)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	loaded, err := fn(missing)
+	if err != nil {
+		store(nil, missing, err)
+		return err
+	}
+	stored := make(map[string]any, len(loaded))
+	var failed []string
+	for _, k := range missing {
+		if x, ok := loaded[k]; ok {
+			stored[k] = x
+			values[k] = x
+			out[k] = x
+		} else {
+			failed = append(failed, k)
+		}
+	}
+	store(stored, failed, nil)
+	return nil
+}
@@ -0,0 +1,171 @@
+package gocache
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_GetMany_SetMany_DeleteMany(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	var evicted []string
+	tc.OnEvicted(func(k string, v any) { evicted = append(evicted, k) })
+	tc.SetMany(map[string]any{"a": 1, "b": 2, "c": 3}, DefaultExpiration)
+	if got := tc.GetMany("a", "b", "x"); !reflect.DeepEqual(got, map[string]any{"a": 1, "b": 2}) {
+		t.Error("GetMany:", got)
+	}
+	if n := tc.DeleteMany("a", "c", "x"); n != 2 {
+		t.Error("DeleteMany:", n)
+	}
+	sort.Strings(evicted)
+	if !reflect.DeepEqual(evicted, []string{"a", "c"}) {
+		t.Error("OnEvicted:", evicted)
+	}
+	if got := tc.GetMany("a", "b", "c"); !reflect.DeepEqual(got, map[string]any{"b": 2}) {
+		t.Error("GetMany after DeleteMany:", got)
+	}
+
+	bst := batchStore{&mapStore{m: map[string]any{"y": 25, "z": 26}}}
+	tc = NewCache(Config{Shards: 4, Loader: bst, Writer: bst})
+	tc.Set("a", 1, DefaultExpiration)
+	if got := tc.GetMany("a", "y", "z", "none"); !reflect.DeepEqual(got, map[string]any{"a": 1, "y": 25, "z": 26}) {
+		t.Error("GetMany with a Loader:", got)
+	}
+	if len(bst.batches) != 1 || bst.loads != 0 {
+		t.Error("GetMany should load the misses at once:", bst.batches, bst.loads)
+	}
+
+	bst.fail = 1
+	tc.SetMany(map[string]any{"a": 2}, DefaultExpiration)
+	if x, _ := tc.Get("a"); x != 1 {
+		t.Error("SetMany should skip the keys it fails to write, got", x)
+	}
+}
+
+func TestCache_MemoizeMany(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	tc.Set("hit", 0, DefaultExpiration)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var batches [][]string
+	load := func(missing []string) (map[string]any, error) {
+		mu.Lock()
+		batches = append(batches, append([]string(nil), missing...))
+		mu.Unlock()
+		<-release
+		out := map[string]any{}
+		for _, k := range missing {
+			if k != "none" {
+				out[k] = k + "!"
+			}
+		}
+		return out, nil
+	}
+
+	done := make(chan map[string]any)
+	go func() {
+		got, err := tc.MemoizeMany([]string{"hit", "a", "b", "none"}, load, DefaultExpiration)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- got
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		got, err := tc.MemoizeMany([]string{"b", "c"}, load, DefaultExpiration)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- got
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	first, second := <-done, <-done
+	if len(first) == 2 {
+		first, second = second, first
+	}
+	if !reflect.DeepEqual(first, map[string]any{"hit": 0, "a": "a!", "b": "b!"}) {
+		t.Error("MemoizeMany:", first)
+	}
+	if !reflect.DeepEqual(second, map[string]any{"b": "b!", "c": "c!"}) {
+		t.Error("MemoizeMany:", second)
+	}
+	sort.Strings(batches[0])
+	if !reflect.DeepEqual(batches, [][]string{{"a", "b", "none"}, {"c"}}) {
+		t.Error("keys in flight should not be loaded again:", batches)
+	}
+	if x, _ := tc.Get("c"); x != "c!" {
+		t.Error("loaded values should be stored, got", x)
+	}
+
+	fail := errors.New("fail")
+	got, err := tc.MemoizeMany([]string{"a", "d"}, func([]string) (map[string]any, error) {
+		return nil, fail
+	}, DefaultExpiration)
+	if err != fail || !reflect.DeepEqual(got, map[string]any{"a": "a!"}) {
+		t.Error("MemoizeMany should return the hits with the error:", got, err)
+	}
+}
+
+func TestCache_MemoizeMany_Recheck(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	// As if a concurrent load stored a after the caller missed it.
+	tc.Set("a", 1, DefaultExpiration)
+	var asked []string
+	got, err := tc.memoizeMany([]string{"a", "b"}, func(keys []string) (map[string]any, error) {
+		asked = keys
+		return map[string]any{"b": 2}, nil
+	}, func(map[string]any, []string, error) {})
+	if err != nil || !reflect.DeepEqual(got, map[string]any{"a": 1, "b": 2}) {
+		t.Error("memoizeMany:", got, err)
+	}
+	if !reflect.DeepEqual(asked, []string{"b"}) {
+		t.Error("keys stored since the miss should not be loaded, loaded", asked)
+	}
+}
+
+func TestCache_GetMany_LoaderOptions(t *testing.T) {
+	st := &mapStore{m: map[string]any{"a": 1}}
+	tc := NewCache(Config{Loader: st, LoaderOptions: MemoizeOptions{TTL: time.Hour, NotFoundTTL: time.Hour}})
+	if got := tc.GetMany("a", "b"); !reflect.DeepEqual(got, map[string]any{"a": 1}) {
+		t.Error("GetMany:", got)
+	}
+	if ttl, _ := tc.TTL("a"); ttl < 59*time.Minute {
+		t.Error("the loaded value should have the TTL of LoaderOptions, has", ttl)
+	}
+	tc.GetMany("a", "b")
+	if st.loads != 2 {
+		t.Error("the missing key should be cached for NotFoundTTL, loads:", st.loads)
+	}
+}
+
+func TestCache_MemoizeMany_Panic(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	release := make(chan struct{})
+	waited := make(chan error)
+	go func() {
+		defer func() { recover() }()
+		tc.MemoizeMany([]string{"a"}, func([]string) (map[string]any, error) {
+			<-release
+			panic("boom")
+		}, DefaultExpiration)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		_, err := tc.Memoize("a", func() (any, error) { return 1, nil }, DefaultExpiration)
+		waited <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Error("a waiter should get an error when the loader panics")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a panicking loader left a waiter blocked")
+	}
+}
@@ -1,9 +1,9 @@
 package gocache
 
 import (
+	"context"
 	"fmt"
 	"runtime"
-	"sync"
 	"time"
 )
 
@@ -19,6 +19,16 @@ const (
 type Item struct {
 	Object     any
 	Expiration int64
+	cost       int64
+	version    uint64
+	// refreshAt is when MemoizeCtx reloads the item in the background, or
+	// 0 if it never does.
+	refreshAt int64
+	// staleUntil is when MemoizeCtx stops returning the expired item while
+	// reloading it, or 0. The janitor keeps the item until then. An expired
+	// *CachedError is never returned but is kept until then so that the
+	// next failure counts it.
+	staleUntil int64
 }
 
 // Returns true if the item has expired.
@@ -29,17 +39,38 @@ func (item Item) Expired() bool {
 	return time.Now().UnixNano() > item.Expiration
 }
 
+// now returns the current time, or while replaying the append-only file,
+// the time the operation being replayed was applied.
+func (c *cache) now() int64 {
+	if c.replaying {
+		return c.clock
+	}
+	return time.Now().UnixNano()
+}
+
 type Cache struct {
 	*cache
 	// If this is confusing, see the comment at the bottom of New()
 }
 type cache struct {
 	defaultExpiration time.Duration
-	items             map[string]Item
-	mu                sync.RWMutex
+	shards            []*shard
+	mask              uint64
 	onEvicted         func(string, any)
 	janitor           *janitor
 	group             Group[string, any]
+	sizer             func(any) int64
+	customSizer       bool // sizer is not DefaultSizer
+	aof               *aof
+	replaying         bool
+	clock             int64 // the time of the record being replayed
+	notifier          notifier
+	pubsub            pubsub
+	loader            Loader
+	loaderOptions     MemoizeOptions
+	writer            Writer
+	writeBehind       *writeBehind
+	onWriteError      func(string, error)
 }
 
 var DefaultConfig = Config{
@@ -50,21 +81,162 @@ var DefaultConfig = Config{
 type Config struct {
 	DefaultExpiration time.Duration
 	CleanupInterval   time.Duration
+	// MaxEntries bounds the number of items in the cache. When a write
+	// would exceed it, items chosen by EvictionPolicy are evicted. Zero
+	// means no limit.
+	MaxEntries int
+	// EvictionPolicy constructs the policy used to pick eviction victims
+	// for a cache holding up to capacity items, e.g. NewARCPolicy. It
+	// defaults to NewLRUPolicy.
+	EvictionPolicy func(capacity int) EvictionPolicy
+	// MaxCost bounds the total cost of the items in the cache, evicting
+	// like MaxEntries does. Zero means no limit.
+	MaxCost int64
+	// Sizer estimates the cost of values stored without an explicit cost
+	// when MaxCost is set. It defaults to DefaultSizer. A custom Sizer is
+	// given a hash, list, set, sorted set or stream again after every
+	// change, whereas the cost DefaultSizer would give is kept up to date
+	// as elements are added and removed.
+	Sizer func(any) int64
+	// Shards splits the cache into independently locked partitions to
+	// reduce lock contention. It is rounded up to a power of two; zero
+	// means a single shard. MaxEntries and MaxCost are divided evenly
+	// between shards, and each shard evicts on its own.
+	Shards int
+	// AOFPath enables the append-only file: every write is logged to it
+	// and the log is replayed when the cache is created. Values are
+	// encoded with encoding/gob, so custom types must be registered with
+	// gob.Register.
+	AOFPath string
+	// AOFSync is how often the append-only file is fsynced.
+	AOFSync AOFSyncPolicy
+	// AOFRewriteMinSize is the size below which the append-only file is
+	// never compacted automatically. It defaults to 64MB.
+	AOFRewriteMinSize int64
+	// OnAOFError is called when a write cannot be logged to the
+	// append-only file: with the key of a record that failed to encode,
+	// which alone is skipped, or with an empty key for a write or sync
+	// error, which stops the log (see AOFErr). It is called with a shard
+	// lock held, so it must not use the cache.
+	OnAOFError func(key string, err error)
+	// Loader loads the keys Get misses, making the cache read-through.
+	// Loads are deduplicated and cached as MemoizeCtx does with
+	// LoaderOptions.
+	Loader        Loader
+	LoaderOptions MemoizeOptions
+	// Writer is given the values written to plain keys, by Set, SetNX,
+	// Increment, MSet, CompareAndSwap, Tx.Exec and the like, and the keys
+	// deleted by Delete, GetDel, DeleteMany and the like. Hashes, lists,
+	// sets, sorted sets and streams are not given to it, nor changes of
+	// expiration, expirations, evictions, Flush, values loaded by
+	// Memoize, MemoizeCtx, MemoizeMany or the Loader, and values restored
+	// from a snapshot or the append-only file. By default it is called
+	// with the lock of the key held, before the cache is updated, which is
+	// skipped if it fails (write-through): the Writer is given the writes
+	// of a key in the order they are applied, so it must not use the
+	// cache, and it holds up the keys sharing its shard. If WriteBehind is
+	// set, writes are instead queued in that order, keeping the last one
+	// of each key, and flushed every WriteBehind, failed writes being
+	// retried up to WriteRetries times (write-behind). Close flushes the
+	// queue.
+	Writer       Writer
+	WriteBehind  time.Duration
+	WriteRetries int
+	// OnWriteError is called with the errors returned by Writer; for
+	// write-behind, once a write has exhausted its retries.
+	OnWriteError func(key string, err error)
 }
 
+// defaultPolicyCapacity is the capacity given to the eviction policy of a
+// cache bounded only by MaxCost.
+const defaultPolicyCapacity = 10000
+
+// NewCache returns a cache configured by config. It panics if the
+// append-only file configured by AOFPath cannot be opened or replayed; use
+// OpenCache to handle that error instead.
 func NewCache(config Config) *Cache {
-	c := &cache{
-		defaultExpiration: config.DefaultExpiration,
-		items:             make(map[string]Item),
-		group:             Group[string, any]{},
+	c, err := OpenCache(config)
+	if err != nil {
+		panic(err)
 	}
-	C := &Cache{c}
+	return c
+}
 
+// OpenCache is like NewCache, but returns an error if the append-only file
+// cannot be opened or replayed.
+func OpenCache(config Config) (*Cache, error) {
+	C := newCache(config)
+	if config.AOFPath != "" {
+		if err := C.openAOF(config); err != nil {
+			return nil, err
+		}
+	}
+	// Start the goroutines only once the log is replayed, so that they do
+	// not race with the replay and are not leaked if it fails.
+	c := C.cache
+	if config.Writer != nil && config.WriteBehind > 0 {
+		c.writeBehind = newWriteBehind(config)
+	}
 	if config.CleanupInterval > 0 {
 		runJanitor(c, config.CleanupInterval)
 		runtime.SetFinalizer(C, stopJanitor)
 	}
-	return C
+	return C, nil
+}
+
+func newCache(config Config) *Cache {
+	n := 1
+	for n < config.Shards {
+		n <<= 1
+	}
+	c := &cache{
+		defaultExpiration: config.DefaultExpiration,
+		shards:            make([]*shard, n),
+		mask:              uint64(n - 1),
+		group:             Group[string, any]{},
+		sizer:             config.Sizer,
+		customSizer:       config.Sizer != nil,
+		loader:            config.Loader,
+		loaderOptions:     config.LoaderOptions,
+		writer:            config.Writer,
+		onWriteError:      config.OnWriteError,
+	}
+	if c.sizer == nil {
+		c.sizer = DefaultSizer
+	}
+	newPolicy := config.EvictionPolicy
+	if newPolicy == nil {
+		newPolicy = NewLRUPolicy
+	}
+	for i := range c.shards {
+		s := &shard{
+			c:          c,
+			items:      make(map[string]Item),
+			maxEntries: (config.MaxEntries + n - 1) / n,
+			maxCost:    (config.MaxCost + int64(n) - 1) / int64(n),
+		}
+		if s.maxEntries > 0 || s.maxCost > 0 {
+			capacity := s.maxEntries
+			if capacity <= 0 {
+				capacity = defaultPolicyCapacity / n
+			}
+			s.policy = newPolicy(capacity)
+		}
+		c.shards[i] = s
+	}
+	return &Cache{c}
+}
+
+// expiration converts a duration given to Set and friends into an absolute
+// expiration time, or 0 for items that never expire.
+func (c *cache) expiration(d time.Duration) int64 {
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	if d > 0 {
+		return time.Now().Add(d).UnixNano()
+	}
+	return 0
 }
 
 // Increment an item of type int, int8, int16, int32, int64, uintptr, uint,
@@ -73,10 +245,11 @@ func NewCache(config Config) *Cache {
 // possible to increment it by n. To retrieve the incremented value, use one
 // of the specialized methods, e.g. IncrementInt64.
 func (c *cache) Increment(k string, n int64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
+	s := c.shardFor(k)
+	s.mu.Lock()
+	v, found := s.item(k)
+	if !found {
+		s.mu.Unlock()
 		return fmt.Errorf("Item %s not found", k)
 	}
 	switch v.Object.(type) {
@@ -107,11 +280,17 @@ func (c *cache) Increment(k string, n int64) error {
 	case float64:
 		v.Object = v.Object.(float64) + float64(n)
 	default:
-		c.mu.Unlock()
+		s.mu.Unlock()
 		return fmt.Errorf("the value for %s is not an integer", k)
 	}
-	c.items[k] = v
-	c.mu.Unlock()
+	if err := c.write(k, v.Object, false); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	c.notifySet(s, EventIncr, k, v.Object, "Increment")
+	s.store(k, v)
+	c.log(aofRecord{Op: opSet, Key: k, Value: v.Object, Exp: v.Expiration})
+	s.mu.Unlock()
 	return nil
 }
 
@@ -123,10 +302,11 @@ func (c *cache) Increment(k string, n int64) error {
 func (c *cache) Decrement(k string, n int64) error {
 	// TODO: Implement Increment and Decrement more cleanly.
 	// (Cannot do Increment(k, n*-1) for uints.)
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
+	s := c.shardFor(k)
+	s.mu.Lock()
+	v, found := s.item(k)
+	if !found {
+		s.mu.Unlock()
 		return fmt.Errorf("Item not found")
 	}
 	switch v.Object.(type) {
@@ -157,191 +337,123 @@ func (c *cache) Decrement(k string, n int64) error {
 	case float64:
 		v.Object = v.Object.(float64) - float64(n)
 	default:
-		c.mu.Unlock()
+		s.mu.Unlock()
 		return fmt.Errorf("the value for %s is not an integer", k)
 	}
-	c.items[k] = v
-	c.mu.Unlock()
+	if err := c.write(k, v.Object, false); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	c.notifySet(s, EventIncr, k, v.Object, "Decrement")
+	s.store(k, v)
+	c.log(aofRecord{Op: opSet, Key: k, Value: v.Object, Exp: v.Expiration})
+	s.mu.Unlock()
 	return nil
 }
 
 func (c *cache) Set(k string, x any, d time.Duration) {
-	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
-	}
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+	e := c.expiration(d)
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if c.write(k, x, false) != nil {
+		s.mu.Unlock()
+		return
 	}
-	c.mu.Lock()
-	c.items[k] = Item{
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e})
+	c.notifySet(s, EventSet, k, x, "Set")
+	evicted := s.store(k, Item{
 		Object:     x,
 		Expiration: e,
-	}
-
-	c.mu.Unlock()
+	})
+	s.mu.Unlock()
+	c.evict(evicted)
 }
 
-func (c *cache) set(k string, x any, d time.Duration) {
-	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
-	}
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+// SetWithCost is like Set, but charges the item cost against MaxCost instead
+// of asking the Sizer. An item costing more than MaxCost is evicted at once.
+func (c *cache) SetWithCost(k string, x any, cost int64, d time.Duration) {
+	e := c.expiration(d)
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if c.write(k, x, false) != nil {
+		s.mu.Unlock()
+		return
 	}
-	c.items[k] = Item{
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e, Cost: cost})
+	c.notifySet(s, EventSet, k, x, "SetWithCost")
+	evicted := s.storeItem(k, Item{
 		Object:     x,
 		Expiration: e,
-	}
+		cost:       cost,
+	})
+	s.mu.Unlock()
+	c.evict(evicted)
 }
 
-func (c *cache) get(k string) (any, bool) {
-	item, found := c.items[k]
-	if !found {
-		return nil, false
-	}
-
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			return nil, false
-		}
+// evict calls the OnEvicted callback for items removed by store.
+func (c *cache) evict(items []keyAndValue) {
+	for _, v := range items {
+		c.onEvicted(v.key, v.value)
 	}
-	return item.Object, true
 }
+
 func (c *cache) Get(k string) (any, bool) {
-	c.mu.RLock()
-	item, found := c.items[k]
+	s := c.shardFor(k)
+	s.mu.RLock()
+	item, found := s.items[k]
 	if !found {
-		c.mu.RUnlock()
-		return nil, false
+		s.mu.RUnlock()
+		return c.readThrough(k)
 	}
 	if item.Expiration > 0 {
 		if time.Now().UnixNano() > item.Expiration {
-			c.mu.RUnlock()
-			return nil, false
+			s.mu.RUnlock()
+			return c.readThrough(k)
 		}
 	}
-	c.mu.RUnlock()
+	s.touch(k)
+	s.mu.RUnlock()
+	if isCachedError(item) {
+		return nil, false
+	}
 	return item.Object, true
 }
 
 func (c *cache) Delete(k string) {
-	c.mu.Lock()
-	v, evicted := c.delete(k)
-	c.mu.Unlock()
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if c.write(k, nil, true) != nil {
+		s.mu.Unlock()
+		return
+	}
+	c.notifyDelete(s, EventDelete, k, "Delete")
+	v, evicted := s.delete(k)
+	s.mu.Unlock()
 	if evicted {
 		c.onEvicted(k, v)
 	}
 }
 
-func (c *cache) delete(k string) (any, bool) {
-	if c.onEvicted != nil {
-		if v, found := c.items[k]; found {
-			delete(c.items, k)
-			return v.Object, true
-		}
-	}
-	delete(c.items, k)
-	return nil, false
-}
-
-func (c *cache) HSet(k, f string, x any) {
-	var obj map[string]any
-	c.mu.Lock()
-	item, found := c.items[k]
-	if !found {
-		obj = make(map[string]any)
-	} else {
-
-		switch item.Object.(type) {
-		case map[string]any:
-			obj = item.Object.(map[string]any)
-		default:
-			obj = make(map[string]any)
-
-		}
-	}
-
-	obj[f] = x
-	c.items[k] = Item{
-		Object:     obj,
-		Expiration: 0, //Hset can not
-	}
-	c.mu.Unlock()
-}
-
-func (c *cache) HGet(k, f string) (any, bool) {
-	c.mu.RLock()
-	item, found := c.items[k]
-	if !found {
-		c.mu.RUnlock()
-		return nil, false
-	}
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.RUnlock()
-			return nil, false
-		}
-	}
-	obj := item.Object.(map[string]any)
-	val, found := obj[f]
-	if !found {
-		c.mu.RUnlock()
-		return nil, false
-	}
-	c.mu.RUnlock()
-	return val, true
+// Sets an (optional) function that is called with the key and value when an
+// item is evicted from the cache. (Including when it is deleted manually, but
+// not when it is overwritten.) Set to nil to disable.
+func (c *cache) OnEvicted(f func(string, any)) {
+	c.lockAll()
+	c.onEvicted = f
+	c.unlockAll()
 }
 
-func (c *cache) HGetAll(k string) (any, bool) {
-	c.mu.RLock()
-	item, found := c.items[k]
-	if !found {
-		c.mu.RUnlock()
-		return nil, false
-	}
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.RUnlock()
-			return nil, false
-		}
+// lockAll write-locks every shard, in order.
+func (c *cache) lockAll() {
+	for _, s := range c.shards {
+		s.mu.Lock()
 	}
-	obj := item.Object.(map[string]any)
-	c.mu.RUnlock()
-	return obj, true
 }
 
-func (c *cache) HDel(k, f string) {
-	c.mu.Lock()
-	item, found := c.items[k]
-	if !found {
-		c.mu.RUnlock()
-		return
+func (c *cache) unlockAll() {
+	for _, s := range c.shards {
+		s.mu.Unlock()
 	}
-
-	obj := item.Object.(map[string]any)
-	_, found = obj[f]
-	if !found {
-		c.mu.Unlock()
-		return
-	}
-	delete(obj, f)
-	c.items[k] = Item{
-		Object:     obj,
-		Expiration: item.Expiration,
-	}
-	c.mu.Unlock()
-	return
-}
-
-// Sets an (optional) function that is called with the key and value when an
-// item is evicted from the cache. (Including when it is deleted manually, but
-// not when it is overwritten.) Set to nil to disable.
-func (c *cache) OnEvicted(f func(string, any)) {
-	c.mu.Lock()
-	c.onEvicted = f
-	c.mu.Unlock()
 }
 
 //SetExpiration sets the expiration time for the cache.
@@ -350,16 +462,19 @@ func (c *cache) SetExpiration(k string, d time.Duration) {
 	if d > 0 {
 		e = time.Now().Add(d).UnixNano()
 	}
-	c.mu.Lock()
-	item, found := c.items[k]
-	if !found {
-		c.mu.Unlock()
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, found := s.items[k]
+	if !found || isCachedError(item) {
+		s.mu.Unlock()
 		return
 	}
 	item.Expiration = e
-	c.items[k] = item
+	item.version = s.nextVersion()
+	s.items[k] = item
+	c.log(aofRecord{Op: opExpire, Key: k, Exp: e})
 
-	c.mu.Unlock()
+	s.mu.Unlock()
 }
 
 type keyAndValue struct {
@@ -369,78 +484,115 @@ type keyAndValue struct {
 
 //DeleteExpired deletes expired items
 func (c *cache) DeleteExpired() {
-	var evictedItems []keyAndValue
 	now := time.Now().UnixNano()
-	c.mu.Lock()
-	for k, v := range c.items {
-		// "Inlining" of expired
-		if v.Expiration > 0 && now > v.Expiration {
-			ov, evicted := c.delete(k)
-			if evicted {
-				evictedItems = append(evictedItems, keyAndValue{k, ov})
-			}
-		}
-	}
-	c.mu.Unlock()
-	for _, v := range evictedItems {
-		c.onEvicted(v.key, v.value)
+	for _, s := range c.shards {
+		// Each shard is swept under its own lock, so writers to the
+		// other shards are not held up.
+		c.evict(s.deleteExpired(now))
 	}
 }
 
 // Copies all unexpired items in the cache into a new map and returns it.
+// Errors cached by MemoizeCtx are left out.
 func (c *cache) Items() map[string]Item {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	m := make(map[string]Item, len(c.items))
+	m := make(map[string]Item, c.ItemCount())
 	now := time.Now().UnixNano()
-	for k, v := range c.items {
-		// "Inlining" of Expired
-		if v.Expiration > 0 {
-			if now > v.Expiration {
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k, v := range s.items {
+			// "Inlining" of Expired
+			if v.Expiration > 0 {
+				if now > v.Expiration {
+					continue
+				}
+			}
+			if isCachedError(v) {
 				continue
 			}
+			m[k] = v
 		}
-		m[k] = v
+		s.mu.RUnlock()
 	}
 	return m
 }
 
+// TTL returns the time left before k expires, or NoExpiration if it never
+// does. The boolean is false if k is not in the cache.
+func (c *cache) TTL(k string) (time.Duration, bool) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	item, found := s.items[k]
+	s.mu.RUnlock()
+	if !found || item.Expired() || isCachedError(item) {
+		return 0, false
+	}
+	if item.Expiration == 0 {
+		return NoExpiration, true
+	}
+	return time.Duration(item.Expiration - time.Now().UnixNano()), true
+}
+
+// Keys returns the unexpired keys matching pattern, a glob-style pattern as
+// understood by Redis: '*' and '?' wildcards, '[...]' classes and '\'
+// escapes.
+func (c *cache) Keys(pattern string) []string {
+	var keys []string
+	now := time.Now().UnixNano()
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k, v := range s.items {
+			if (v.Expiration > 0 && now > v.Expiration) || isCachedError(v) {
+				continue
+			}
+			if matchGlob(pattern, k) {
+				keys = append(keys, k)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return keys
+}
+
 // Returns the number of items in the cache. This may include items that have
 // expired, but have not yet been cleaned up.
 func (c *cache) ItemCount() int {
-	c.mu.RLock()
-	n := len(c.items)
-	c.mu.RUnlock()
+	n := 0
+	for _, s := range c.shards {
+		s.mu.RLock()
+		n += len(s.items)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Cost returns the total cost of the items in the cache. Costs are only
+// tracked when MaxCost is set or items are stored with SetWithCost.
+func (c *cache) Cost() int64 {
+	var n int64
+	for _, s := range c.shards {
+		s.mu.RLock()
+		n += s.cost
+		s.mu.RUnlock()
+	}
 	return n
 }
 
 // Delete all items from the cache.
 func (c *cache) Flush() {
-	c.mu.Lock()
-	c.items = map[string]Item{}
-	c.mu.Unlock()
+	c.lockAll()
+	c.log(aofRecord{Op: opFlush})
+	c.notify(Event{Type: EventFlush, Cause: "Flush"})
+	for _, s := range c.shards {
+		s.clear()
+	}
+	c.unlockAll()
 }
 
 // Memoize executes and returns the results of the given function, unless there was a cached value of the same key.
-// Only one execution is in-flight for a given key at a time.
-// The boolean return value indicates whether v was previously stored.
+// Only one execution is in-flight for a given key at a time. The cache is not
+// locked while fn runs. If fn panics, so does Memoize.
 func (c *cache) Memoize(k string, fn func() (any, error), d time.Duration) (any, error) {
-	c.mu.Lock()
-	// Check cache
-	value, found := c.get(k)
-	if found {
-		c.mu.Unlock()
-		return value, nil
-	}
-
-	value, err, _ := c.group.Do(k, func() (any, error) {
-		data, innerErr := fn()
-
-		if innerErr == nil {
-			c.set(k, data, d)
-		}
-		return data, innerErr
-	})
-	c.mu.Unlock()
-	return value, err
+	return c.MemoizeCtx(context.Background(), k, func(context.Context) (any, error) {
+		return fn()
+	}, MemoizeOptions{TTL: d})
 }
@@ -2,6 +2,7 @@ package gocache
 
 import (
 	"math/rand"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -244,6 +245,45 @@ func benchmarkCacheGet(b *testing.B, exp time.Duration) {
 	}
 }
 
+func BenchmarkCacheGetParallel(b *testing.B) {
+	benchmarkCacheParallel(b, 1, false)
+}
+
+func BenchmarkCacheGetParallelSharded(b *testing.B) {
+	benchmarkCacheParallel(b, 64, false)
+}
+
+func BenchmarkCacheSetParallel(b *testing.B) {
+	benchmarkCacheParallel(b, 1, true)
+}
+
+func BenchmarkCacheSetParallelSharded(b *testing.B) {
+	benchmarkCacheParallel(b, 64, true)
+}
+
+func benchmarkCacheParallel(b *testing.B, shards int, write bool) {
+	b.StopTimer()
+	tc := NewCache(Config{DefaultExpiration: NoExpiration, Shards: shards})
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		tc.Set(keys[i], i, DefaultExpiration)
+	}
+	b.StartTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Intn(len(keys))
+		for pb.Next() {
+			k := keys[i%len(keys)]
+			if write {
+				tc.Set(k, i, DefaultExpiration)
+			} else {
+				tc.Get(k)
+			}
+			i++
+		}
+	})
+}
+
 func BenchmarkCacheHGet(b *testing.B) {
 	b.StopTimer()
 	tc := NewCache(DefaultConfig)
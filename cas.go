@@ -0,0 +1,105 @@
+package gocache
+
+import "time"
+
+// Version returns the version of the item. Every write to a key gives it a
+// greater version than any it had before.
+func (item Item) Version() uint64 {
+	return item.version
+}
+
+// GetWithVersion returns the value of k and its version, to pass to
+// CompareAndSwap or CompareAndDelete.
+func (c *cache) GetWithVersion(k string) (any, uint64, bool) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, found := s.item(k)
+	if !found {
+		return nil, 0, false
+	}
+	s.touch(k)
+	return item.Object, item.version, true
+}
+
+// CompareAndSwap sets k to x if its version is still version, as returned by
+// GetWithVersion, and returns the new version. A version of 0 only matches a
+// missing key, so that CompareAndSwap can create it.
+func (c *cache) CompareAndSwap(k string, version uint64, x any, d time.Duration) (uint64, bool) {
+	e := c.expiration(d)
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if s.version(k) != version {
+		s.mu.Unlock()
+		return 0, false
+	}
+	if c.write(k, x, false) != nil {
+		s.mu.Unlock()
+		return 0, false
+	}
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e})
+	c.notifySet(s, EventSet, k, x, "CompareAndSwap")
+	evicted := s.store(k, Item{Object: x, Expiration: e})
+	version = s.items[k].version
+	s.mu.Unlock()
+	c.evict(evicted)
+	return version, true
+}
+
+// CompareAndDelete deletes k if its version is still version, and reports
+// whether it did.
+func (c *cache) CompareAndDelete(k string, version uint64) bool {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if version == 0 || s.version(k) != version || c.write(k, nil, true) != nil {
+		s.mu.Unlock()
+		return false
+	}
+	c.notifyDelete(s, EventDelete, k, "CompareAndDelete")
+	v, evicted := s.delete(k)
+	s.mu.Unlock()
+	if evicted {
+		c.onEvicted(k, v)
+	}
+	return true
+}
+
+// UpdateKey replaces the value of k with the one returned by fn, which is
+// called with the current value under the lock of k, so that no other write
+// to k interleaves. If fn returns keep false, k is deleted instead. fn must
+// not call methods of the cache. UpdateKey returns the new value and whether
+// k was kept. With a Writer, a failed write leaves k unchanged, and its
+// value is returned.
+func (c *cache) UpdateKey(k string, fn func(old any, exists bool) (x any, d time.Duration, keep bool)) (any, bool) {
+	x, keep, evicted := c.updateKey(k, fn)
+	c.evict(evicted)
+	return x, keep
+}
+
+func (c *cache) updateKey(k string, fn func(any, bool) (any, time.Duration, bool)) (any, bool, []keyAndValue) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, found := s.item(k)
+	x, d, keep := fn(old.Object, found)
+	if !keep {
+		if !found {
+			return nil, false, nil
+		}
+		if c.write(k, nil, true) != nil {
+			return old.Object, true, nil
+		}
+		c.notifyDelete(s, EventDelete, k, "UpdateKey")
+		if v, evicted := s.delete(k); evicted {
+			return nil, false, []keyAndValue{{k, v}}
+		}
+		return nil, false, nil
+	}
+	if c.write(k, x, false) != nil {
+		return old.Object, found, nil
+	}
+	e := c.expiration(d)
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e})
+	c.notifySet(s, EventSet, k, x, "UpdateKey")
+	return x, true, s.store(k, Item{Object: x, Expiration: e})
+}
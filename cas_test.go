@@ -0,0 +1,82 @@
+package gocache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_CompareAndSwap(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if _, ok := tc.CompareAndSwap("a", 1, "x", DefaultExpiration); ok {
+		t.Error("CompareAndSwap on a missing key should need version 0")
+	}
+	v1, ok := tc.CompareAndSwap("a", 0, "x", DefaultExpiration)
+	if !ok || v1 == 0 {
+		t.Fatal("CompareAndSwap should create a missing key:", v1, ok)
+	}
+	if x, v, found := tc.GetWithVersion("a"); !found || x != "x" || v != v1 {
+		t.Error("GetWithVersion:", x, v, found)
+	}
+	v2, ok := tc.CompareAndSwap("a", v1, "y", DefaultExpiration)
+	if !ok || v2 <= v1 {
+		t.Error("CompareAndSwap should succeed with the current version:", v2, ok)
+	}
+	if _, ok := tc.CompareAndSwap("a", v1, "z", DefaultExpiration); ok {
+		t.Error("CompareAndSwap should fail with a stale version")
+	}
+	if x, _ := tc.Get("a"); x != "y" {
+		t.Error("a failed CompareAndSwap changed the value:", x)
+	}
+
+	tc.SetExpiration("a", time.Hour)
+	if tc.CompareAndDelete("a", v2) {
+		t.Error("SetExpiration should change the version")
+	}
+	_, v3, _ := tc.GetWithVersion("a")
+	if !tc.CompareAndDelete("a", v3) {
+		t.Error("CompareAndDelete should succeed with the current version")
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("a was not deleted")
+	}
+	if tc.CompareAndDelete("a", 0) {
+		t.Error("CompareAndDelete should not delete a missing key")
+	}
+}
+
+func TestCache_UpdateKey(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.UpdateKey("list", func(old any, exists bool) (any, time.Duration, bool) {
+					l, _ := old.([]int)
+					return append(l, j), DefaultExpiration, true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if x, _ := tc.Get("list"); len(x.([]int)) != 800 {
+		t.Error("lost updates:", len(x.([]int)))
+	}
+
+	var evicted []string
+	tc.OnEvicted(func(k string, v any) { evicted = append(evicted, k) })
+	x, kept := tc.UpdateKey("list", func(old any, exists bool) (any, time.Duration, bool) {
+		if !exists {
+			t.Error("UpdateKey did not pass the current value")
+		}
+		return nil, 0, false
+	})
+	if x != nil || kept {
+		t.Error("UpdateKey should report the deletion:", x, kept)
+	}
+	if _, found := tc.Get("list"); found || len(evicted) != 1 {
+		t.Error("UpdateKey did not delete the key:", evicted)
+	}
+}
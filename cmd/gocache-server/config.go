@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+// config holds the daemon settings. Every setting can be given as a
+// command-line flag or as a "name value" line in the config file; flags win.
+type config struct {
+	addr              string
+	unixSocket        string
+	defaultExpiration time.Duration
+	cleanupInterval   time.Duration
+	maxMemory         byteSize
+	maxEntries        int
+	shards            int
+	snapshot          string
+	aof               string
+	appendFsync       string
+	logLevel          string
+}
+
+// byteSize is a flag value accepting sizes such as 512mb or 2gb.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}, {"b", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+func newFlagSet(cfg *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("gocache-server", flag.ContinueOnError)
+	fs.StringVar(&cfg.addr, "addr", ":6379", "TCP address to listen on; empty to disable")
+	fs.StringVar(&cfg.unixSocket, "unixsocket", "", "Unix socket path to listen on")
+	fs.DurationVar(&cfg.defaultExpiration, "default-expiration", 0, "expiration for keys set without one; 0 means never")
+	fs.DurationVar(&cfg.cleanupInterval, "cleanup-interval", 5*time.Minute, "interval between sweeps of expired keys")
+	fs.Var(&cfg.maxMemory, "maxmemory", "approximate memory limit, e.g. 512mb; 0 means unlimited")
+	fs.IntVar(&cfg.maxEntries, "maxentries", 0, "maximum number of keys; 0 means unlimited")
+	fs.IntVar(&cfg.shards, "shards", 16, "number of cache shards")
+	fs.StringVar(&cfg.snapshot, "snapshot", "", "snapshot file loaded at startup and saved at shutdown")
+	fs.StringVar(&cfg.aof, "appendfilename", "", "append-only file; empty disables it")
+	fs.StringVar(&cfg.appendFsync, "appendfsync", "everysec", "append-only file fsync policy: always, everysec or no")
+	fs.StringVar(&cfg.logLevel, "loglevel", "info", "log level: debug, info, warn or error")
+	return fs
+}
+
+// parseConfig parses the command line and the config file it names with
+// -config.
+func parseConfig(args []string, stderr io.Writer) (*config, error) {
+	cfg := new(config)
+	fs := newFlagSet(cfg)
+	fs.SetOutput(stderr)
+	configFile := fs.String("config", "", "config file with one 'name value' setting per line")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *configFile != "" {
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		f, err := os.Open(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := readConfigFile(f, fs, set); err != nil {
+			return nil, fmt.Errorf("%s: %w", *configFile, err)
+		}
+	}
+	return cfg, nil
+}
+
+// readConfigFile applies "name value" lines to fs, skipping the flags in
+// skip. Blank lines and lines starting with '#' are ignored.
+func readConfigFile(r io.Reader, fs *flag.FlagSet, skip map[string]bool) error {
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value := text, ""
+		if i := strings.IndexAny(text, " \t"); i >= 0 {
+			name, value = text[:i], strings.TrimSpace(text[i+1:])
+		}
+		value = strings.Trim(value, `"`)
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("line %d: unknown setting %q", line, name)
+		}
+		if skip[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// cacheConfig translates the daemon settings into a gocache.Config.
+func (cfg *config) cacheConfig() (gocache.Config, error) {
+	c := gocache.Config{
+		DefaultExpiration: cfg.defaultExpiration,
+		CleanupInterval:   cfg.cleanupInterval,
+		MaxEntries:        cfg.maxEntries,
+		MaxCost:           int64(cfg.maxMemory),
+		Shards:            cfg.shards,
+		AOFPath:           cfg.aof,
+	}
+	if c.DefaultExpiration == 0 {
+		c.DefaultExpiration = gocache.NoExpiration
+	}
+	switch cfg.appendFsync {
+	case "always":
+		c.AOFSync = gocache.AOFSyncAlways
+	case "everysec":
+		c.AOFSync = gocache.AOFSyncEverySec
+	case "no":
+		c.AOFSync = gocache.AOFSyncNo
+	default:
+		return c, fmt.Errorf("invalid appendfsync %q", cfg.appendFsync)
+	}
+	return c, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"1024":  1024,
+		"10kb":  10 << 10,
+		"512mb": 512 << 20,
+		"2GB":   2 << 30,
+		"3m":    3 << 20,
+	}
+	for s, want := range tests {
+		if n, err := parseByteSize(s); err != nil || n != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", s, n, err, want)
+		}
+	}
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "gocache.conf")
+	conf := `# sample config
+addr 127.0.0.1:7000
+maxmemory 64mb
+default-expiration 1h
+appendfsync always
+loglevel "debug"
+`
+	if err := os.WriteFile(fname, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig([]string{"-config", fname, "-loglevel", "warn"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.addr != "127.0.0.1:7000" || cfg.maxMemory != 64<<20 || cfg.defaultExpiration != time.Hour {
+		t.Errorf("config file was not applied: %+v", cfg)
+	}
+	if cfg.logLevel != "warn" {
+		t.Error("command-line flags should override the config file, got", cfg.logLevel)
+	}
+	cc, err := cfg.cacheConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc.AOFSync != gocache.AOFSyncAlways || cc.MaxCost != 64<<20 || cc.CleanupInterval != 5*time.Minute {
+		t.Errorf("unexpected cache config: %+v", cc)
+	}
+
+	if err := os.WriteFile(fname, []byte("bogus 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseConfig([]string{"-config", fname}, io.Discard); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+}
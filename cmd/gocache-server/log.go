@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func parseLogLevel(s string) (logLevel, error) {
+	for i, name := range levelNames {
+		if s == name {
+			return logLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q", s)
+}
+
+// logger is a minimal leveled wrapper around the log package.
+type logger struct {
+	*log.Logger
+	level logLevel
+}
+
+func newLogger(w io.Writer, level logLevel) *logger {
+	return &logger{Logger: log.New(w, "", log.LstdFlags), level: level}
+}
+
+func (l *logger) logf(level logLevel, format string, args ...any) {
+	if level >= l.level {
+		l.Printf("["+levelNames[level]+"] "+format, args...)
+	}
+}
+
+func (l *logger) Debugf(format string, args ...any) { l.logf(levelDebug, format, args...) }
+func (l *logger) Infof(format string, args ...any)  { l.logf(levelInfo, format, args...) }
+func (l *logger) Warnf(format string, args ...any)  { l.logf(levelWarn, format, args...) }
+func (l *logger) Errorf(format string, args ...any) { l.logf(levelError, format, args...) }
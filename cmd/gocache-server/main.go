@@ -0,0 +1,113 @@
+// Command gocache-server runs a gocache as a standalone cache daemon that
+// speaks the Redis protocol.
+//
+// Usage:
+//
+//	gocache-server [-config file] [flags]
+//
+// Run with -h for the list of settings. On SIGINT or SIGTERM the server
+// stops accepting clients, saves the snapshot file if one is configured,
+// and flushes the append-only file before exiting.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/millken/gocache"
+	"github.com/millken/gocache/server"
+)
+
+func main() {
+	cfg, err := parseConfig(os.Args[1:], os.Stderr)
+	if err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "gocache-server:", err)
+		os.Exit(2)
+	}
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "gocache-server:", err)
+		os.Exit(1)
+	}
+}
+
+func run(cfg *config) error {
+	level, err := parseLogLevel(cfg.logLevel)
+	if err != nil {
+		return err
+	}
+	logger := newLogger(os.Stderr, level)
+	cc, err := cfg.cacheConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.addr == "" && cfg.unixSocket == "" {
+		return errors.New("nothing to listen on: set -addr or -unixsocket")
+	}
+
+	c, err := gocache.OpenCache(cc)
+	if err != nil {
+		return err
+	}
+	if cfg.snapshot != "" {
+		switch err := c.LoadFile(cfg.snapshot); {
+		case err == nil:
+			logger.Infof("loaded %d keys from %s", c.ItemCount(), cfg.snapshot)
+		case errors.Is(err, os.ErrNotExist):
+			logger.Infof("no snapshot at %s, starting empty", cfg.snapshot)
+		default:
+			return err
+		}
+	}
+
+	srv := server.New(c)
+	srv.ErrorLog = logger.Logger
+	errc := make(chan error, 2)
+	if cfg.addr != "" {
+		logger.Infof("listening on %s", cfg.addr)
+		go func() { errc <- srv.ListenAndServe("tcp", cfg.addr) }()
+	}
+	if cfg.unixSocket != "" {
+		os.Remove(cfg.unixSocket)
+		logger.Infof("listening on %s", cfg.unixSocket)
+		go func() { errc <- srv.ListenAndServe("unix", cfg.unixSocket) }()
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	var serveErr error
+	select {
+	case sig := <-sigc:
+		logger.Infof("received %v, shutting down", sig)
+	case serveErr = <-errc:
+		logger.Errorf("server stopped: %v", serveErr)
+	}
+	srv.Close()
+
+	if cfg.snapshot != "" {
+		if err := c.SaveFile(cfg.snapshot); err != nil {
+			logger.Errorf("saving snapshot: %v", err)
+			if serveErr == nil {
+				serveErr = err
+			}
+		} else {
+			logger.Infof("saved %d keys to %s", c.ItemCount(), cfg.snapshot)
+		}
+	}
+	if err := c.Close(); err != nil {
+		logger.Errorf("closing append-only file: %v", err)
+		if serveErr == nil {
+			serveErr = err
+		}
+	}
+	if errors.Is(serveErr, server.ErrServerClosed) {
+		serveErr = nil
+	}
+	return serveErr
+}
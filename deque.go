@@ -0,0 +1,148 @@
+package gocache
+
+// deque is the value stored under a key by LPush and RPush: a growable ring
+// buffer in Redis order, so index 0 is the left end of the list. Both ends
+// support O(1) pushes and pops, and elements can be read by index in O(1).
+type deque struct {
+	buf  []any
+	head int
+	n    int
+}
+
+const minDequeCap = 8
+
+func newDeque(elems ...any) *deque {
+	c := minDequeCap
+	for c < len(elems) {
+		c <<= 1
+	}
+	d := &deque{buf: make([]any, c)}
+	copy(d.buf, elems)
+	d.n = len(elems)
+	return d
+}
+
+func (d *deque) Len() int {
+	return d.n
+}
+
+// index maps a logical index to a position in buf. len(buf) is always a
+// power of two.
+func (d *deque) index(i int) int {
+	return (d.head + i) & (len(d.buf) - 1)
+}
+
+func (d *deque) resize(c int) {
+	buf := make([]any, c)
+	d.copyTo(buf, 0, d.n)
+	d.buf = buf
+	d.head = 0
+}
+
+// copyTo copies the elements from start to end, exclusive, into dst.
+func (d *deque) copyTo(dst []any, start, end int) {
+	if start >= end {
+		return
+	}
+	i, j := d.index(start), d.index(end-1)
+	if i <= j {
+		copy(dst, d.buf[i:j+1])
+		return
+	}
+	n := copy(dst, d.buf[i:])
+	copy(dst[n:], d.buf[:j+1])
+}
+
+func (d *deque) grow() {
+	if d.n == len(d.buf) {
+		d.resize(2 * len(d.buf))
+	}
+}
+
+func (d *deque) shrink() {
+	c := len(d.buf)
+	for c > minDequeCap && d.n <= c/4 {
+		c /= 2
+	}
+	if c != len(d.buf) {
+		d.resize(c)
+	}
+}
+
+func (d *deque) pushFront(x any) {
+	d.grow()
+	d.head = (d.head - 1) & (len(d.buf) - 1)
+	d.buf[d.head] = x
+	d.n++
+}
+
+func (d *deque) pushBack(x any) {
+	d.grow()
+	d.buf[d.index(d.n)] = x
+	d.n++
+}
+
+func (d *deque) popFront() any {
+	x := d.buf[d.head]
+	d.buf[d.head] = nil
+	d.head = d.index(1)
+	d.n--
+	d.shrink()
+	return x
+}
+
+func (d *deque) popBack() any {
+	i := d.index(d.n - 1)
+	x := d.buf[i]
+	d.buf[i] = nil
+	d.n--
+	d.shrink()
+	return x
+}
+
+func (d *deque) at(i int) any {
+	return d.buf[d.index(i)]
+}
+
+func (d *deque) set(i int, x any) {
+	d.buf[d.index(i)] = x
+}
+
+// insert puts x at index i, shifting the shorter side of the deque.
+func (d *deque) insert(i int, x any) {
+	if i <= d.n/2 {
+		d.pushFront(nil)
+		for j := 0; j < i; j++ {
+			d.set(j, d.at(j+1))
+		}
+	} else {
+		d.pushBack(nil)
+		for j := d.n - 1; j > i; j-- {
+			d.set(j, d.at(j-1))
+		}
+	}
+	d.set(i, x)
+}
+
+// slice returns a copy of the elements from start to stop, inclusive.
+func (d *deque) slice(start, stop int) []any {
+	out := make([]any, stop-start+1)
+	d.copyTo(out, start, stop+1)
+	return out
+}
+
+// filter keeps the elements for which keep returns true, in order.
+func (d *deque) filter(keep func(i int, x any) bool) {
+	n := 0
+	for i := 0; i < d.n; i++ {
+		if x := d.at(i); keep(i, x) {
+			d.set(n, x)
+			n++
+		}
+	}
+	for i := n; i < d.n; i++ {
+		d.set(i, nil)
+	}
+	d.n = n
+	d.shrink()
+}
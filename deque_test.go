@@ -0,0 +1,68 @@
+package gocache
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func dequeElems(d *deque) []any {
+	if d.Len() == 0 {
+		return []any{}
+	}
+	return d.slice(0, d.Len()-1)
+}
+
+func TestDeque(t *testing.T) {
+	d := newDeque()
+	ref := []any{}
+	for i := 0; i < 5000; i++ {
+		switch op := rand.Intn(7); {
+		case op == 0:
+			d.pushFront(i)
+			ref = append([]any{i}, ref...)
+		case op == 1:
+			d.pushBack(i)
+			ref = append(ref, i)
+		case op == 2 && len(ref) > 0:
+			if x := d.popFront(); x != ref[0] {
+				t.Fatalf("popFront returned %v, want %v", x, ref[0])
+			}
+			ref = ref[1:]
+		case op == 3 && len(ref) > 0:
+			if x := d.popBack(); x != ref[len(ref)-1] {
+				t.Fatalf("popBack returned %v, want %v", x, ref[len(ref)-1])
+			}
+			ref = ref[:len(ref)-1]
+		case op == 4:
+			j := rand.Intn(len(ref) + 1)
+			d.insert(j, i)
+			ref = append(ref[:j], append([]any{i}, ref[j:]...)...)
+		case op == 5 && len(ref) > 0:
+			j := rand.Intn(len(ref))
+			d.set(j, -i)
+			ref[j] = -i
+		case op == 6 && rand.Intn(20) == 0:
+			d.filter(func(j int, x any) bool { return j%3 != 0 })
+			var kept []any
+			for j, x := range ref {
+				if j%3 != 0 {
+					kept = append(kept, x)
+				}
+			}
+			ref = append([]any{}, kept...)
+		}
+		if d.Len() != len(ref) {
+			t.Fatalf("length %d, want %d", d.Len(), len(ref))
+		}
+	}
+	if got := dequeElems(d); !reflect.DeepEqual(got, ref) {
+		t.Fatalf("deque holds %v, want %v", got, ref)
+	}
+	for d.Len() > 0 {
+		d.popBack()
+	}
+	if len(d.buf) != minDequeCap {
+		t.Error("an empty deque should shrink to the minimum capacity, has", len(d.buf))
+	}
+}
@@ -0,0 +1,260 @@
+package gocache
+
+import (
+	"container/list"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// EvictionPolicy decides which key a bounded cache evicts when it is full.
+// The cache notifies the policy of every access, insert and delete, and asks
+// it for a victim while it is over capacity. Access may be called
+// concurrently by readers, so implementations must do their own locking.
+type EvictionPolicy interface {
+	// Access records a read of a key that is in the cache.
+	Access(key string)
+	// Insert records a write of key, which may or may not be new.
+	Insert(key string)
+	// Remove forgets key because it was deleted, expired or evicted.
+	Remove(key string)
+	// Victim returns the key that should be evicted next. The cache
+	// deletes it, which in turn calls Remove.
+	Victim() (string, bool)
+	// Reset forgets every key.
+	Reset()
+}
+
+type lruPolicy struct {
+	mu    sync.Mutex
+	ll    *list.List
+	elems map[string]*list.Element
+	// fifo disables promotion on access and overwrite.
+	fifo bool
+}
+
+// NewLRUPolicy returns a policy that evicts the least recently used key.
+func NewLRUPolicy(capacity int) EvictionPolicy {
+	return &lruPolicy{
+		ll:    list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+// NewFIFOPolicy returns a policy that evicts the oldest inserted key,
+// regardless of how often it has been read since.
+func NewFIFOPolicy(capacity int) EvictionPolicy {
+	p := NewLRUPolicy(capacity).(*lruPolicy)
+	p.fifo = true
+	return p
+}
+
+func (l *lruPolicy) Access(k string) {
+	if l.fifo {
+		return
+	}
+	l.mu.Lock()
+	if e, ok := l.elems[k]; ok {
+		l.ll.MoveToFront(e)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lruPolicy) Insert(k string) {
+	l.mu.Lock()
+	if e, ok := l.elems[k]; ok {
+		if !l.fifo {
+			l.ll.MoveToFront(e)
+		}
+	} else {
+		l.elems[k] = l.ll.PushFront(k)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lruPolicy) Remove(k string) {
+	l.mu.Lock()
+	if e, ok := l.elems[k]; ok {
+		l.ll.Remove(e)
+		delete(l.elems, k)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lruPolicy) Victim() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := l.ll.Back()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+func (l *lruPolicy) Reset() {
+	l.mu.Lock()
+	l.ll.Init()
+	l.elems = make(map[string]*list.Element)
+	l.mu.Unlock()
+}
+
+type randomPolicy struct {
+	mu    sync.Mutex
+	keys  []string
+	index map[string]int
+	rnd   *rand.Rand
+}
+
+// NewRandomPolicy returns a policy that evicts a uniformly random key.
+func NewRandomPolicy(capacity int) EvictionPolicy {
+	return &randomPolicy{
+		index: make(map[string]int),
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (r *randomPolicy) Access(k string) {}
+
+func (r *randomPolicy) Insert(k string) {
+	r.mu.Lock()
+	if _, ok := r.index[k]; !ok {
+		r.index[k] = len(r.keys)
+		r.keys = append(r.keys, k)
+	}
+	r.mu.Unlock()
+}
+
+func (r *randomPolicy) Remove(k string) {
+	r.mu.Lock()
+	if i, ok := r.index[k]; ok {
+		last := len(r.keys) - 1
+		r.keys[i] = r.keys[last]
+		r.index[r.keys[i]] = i
+		r.keys = r.keys[:last]
+		delete(r.index, k)
+	}
+	r.mu.Unlock()
+}
+
+func (r *randomPolicy) Victim() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.keys) == 0 {
+		return "", false
+	}
+	return r.keys[r.rnd.Intn(len(r.keys))], true
+}
+
+func (r *randomPolicy) Reset() {
+	r.mu.Lock()
+	r.keys = nil
+	r.index = make(map[string]int)
+	r.mu.Unlock()
+}
+
+// lfuBucket holds the keys that share an access count, oldest at the back.
+type lfuBucket struct {
+	freq int
+	keys *list.List
+}
+
+type lfuEntry struct {
+	bucket *list.Element // of *lfuBucket
+	elem   *list.Element // of string, inside the bucket
+}
+
+type lfuPolicy struct {
+	mu      sync.Mutex
+	buckets *list.List // of *lfuBucket, ascending freq
+	entries map[string]*lfuEntry
+}
+
+// NewLFUPolicy returns a policy that evicts the least frequently used key,
+// breaking ties by recency. All operations are O(1).
+func NewLFUPolicy(capacity int) EvictionPolicy {
+	return &lfuPolicy{
+		buckets: list.New(),
+		entries: make(map[string]*lfuEntry),
+	}
+}
+
+func (l *lfuPolicy) Access(k string) {
+	l.mu.Lock()
+	if e, ok := l.entries[k]; ok {
+		l.increment(k, e)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lfuPolicy) Insert(k string) {
+	l.mu.Lock()
+	if e, ok := l.entries[k]; ok {
+		l.increment(k, e)
+		l.mu.Unlock()
+		return
+	}
+	front := l.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = l.buckets.PushFront(&lfuBucket{freq: 1, keys: list.New()})
+	}
+	l.entries[k] = &lfuEntry{
+		bucket: front,
+		elem:   front.Value.(*lfuBucket).keys.PushFront(k),
+	}
+	l.mu.Unlock()
+}
+
+// increment moves k to the bucket for the next frequency.
+func (l *lfuPolicy) increment(k string, e *lfuEntry) {
+	cur := e.bucket.Value.(*lfuBucket)
+	next := e.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != cur.freq+1 {
+		next = l.buckets.InsertAfter(&lfuBucket{freq: cur.freq + 1, keys: list.New()}, e.bucket)
+	}
+	cur.keys.Remove(e.elem)
+	if cur.keys.Len() == 0 {
+		l.buckets.Remove(e.bucket)
+	}
+	e.bucket = next
+	e.elem = next.Value.(*lfuBucket).keys.PushFront(k)
+}
+
+func (l *lfuPolicy) Remove(k string) {
+	l.mu.Lock()
+	if e, ok := l.entries[k]; ok {
+		b := e.bucket.Value.(*lfuBucket)
+		b.keys.Remove(e.elem)
+		if b.keys.Len() == 0 {
+			l.buckets.Remove(e.bucket)
+		}
+		delete(l.entries, k)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lfuPolicy) Victim() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	front := l.buckets.Front()
+	if front == nil {
+		return "", false
+	}
+	return front.Value.(*lfuBucket).keys.Back().Value.(string), true
+}
+
+func (l *lfuPolicy) Reset() {
+	l.mu.Lock()
+	l.buckets.Init()
+	l.entries = make(map[string]*lfuEntry)
+	l.mu.Unlock()
+}
+
+// hashKey is 64-bit FNV-1a, inlined to avoid allocating a hash.Hash.
+func hashKey(k string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(k); i++ {
+		h ^= uint64(k[i])
+		h *= 1099511628211
+	}
+	return h
+}
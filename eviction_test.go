@@ -0,0 +1,240 @@
+package gocache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestCache_MaxEntries(t *testing.T) {
+	tc := NewCache(Config{MaxEntries: 3})
+	var evicted []string
+	tc.OnEvicted(func(k string, v any) {
+		evicted = append(evicted, k)
+	})
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	// Reading a makes b the least recently used key.
+	if _, found := tc.Get("a"); !found {
+		t.Fatal("a was not found")
+	}
+	tc.Set("d", 4, DefaultExpiration)
+
+	if tc.ItemCount() != 3 {
+		t.Error("count error :", tc.ItemCount())
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("b should have been evicted")
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Error("unexpected evictions:", evicted)
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, found := tc.Get(k); !found {
+			t.Errorf("%s was evicted", k)
+		}
+	}
+}
+
+func TestCache_MaxEntries_HSet_LPush(t *testing.T) {
+	tc := NewCache(Config{MaxEntries: 2})
+	tc.HSet("h", "f", "v")
+	tc.LPush("l", 1)
+	tc.HSet("h", "f2", "v2")
+	tc.LPush("l2", 2)
+
+	if _, found := tc.HGet("h", "f2"); !found {
+		t.Error("h should have survived, it was written last")
+	}
+	if _, found := tc.LPop("l"); found {
+		t.Error("l should have been evicted")
+	}
+	if tc.ItemCount() != 2 {
+		t.Error("count error :", tc.ItemCount())
+	}
+}
+
+func TestCache_MaxEntries_DeleteAndFlush(t *testing.T) {
+	tc := NewCache(Config{MaxEntries: 2})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Delete("a")
+	tc.Set("c", 3, DefaultExpiration)
+	if _, found := tc.Get("b"); !found {
+		t.Error("b should not be evicted after a was deleted")
+	}
+	tc.Flush()
+	for i := 0; i < 10; i++ {
+		tc.Set(fmt.Sprint(i), i, DefaultExpiration)
+	}
+	if tc.ItemCount() != 2 {
+		t.Error("count error :", tc.ItemCount())
+	}
+}
+
+func BenchmarkCacheSetMaxEntries(b *testing.B) {
+	b.StopTimer()
+	tc := NewCache(Config{MaxEntries: 1000})
+	keys := make([]string, 4096)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Set(keys[i%len(keys)], i, DefaultExpiration)
+	}
+}
+
+var policies = map[string]func(int) EvictionPolicy{
+	"LRU":     NewLRUPolicy,
+	"LFU":     NewLFUPolicy,
+	"FIFO":    NewFIFOPolicy,
+	"Random":  NewRandomPolicy,
+	"ARC":     NewARCPolicy,
+	"TinyLFU": NewTinyLFUPolicy,
+}
+
+func TestEvictionPolicies_Bounded(t *testing.T) {
+	for name, newPolicy := range policies {
+		tc := NewCache(Config{MaxEntries: 100, EvictionPolicy: newPolicy})
+		evictions := 0
+		tc.OnEvicted(func(string, any) { evictions++ })
+		for i := 0; i < 1000; i++ {
+			k := fmt.Sprint(i % 300)
+			if _, found := tc.Get(k); !found {
+				tc.Set(k, i, DefaultExpiration)
+			}
+		}
+		if n := tc.ItemCount(); n != 100 {
+			t.Errorf("%s: count error : %d", name, n)
+		}
+		if evictions == 0 {
+			t.Errorf("%s: nothing was evicted", name)
+		}
+		tc.Flush()
+		tc.Set("a", 1, DefaultExpiration)
+		if _, found := tc.Get("a"); !found {
+			t.Errorf("%s: a was not found after Flush", name)
+		}
+	}
+}
+
+func TestLFUPolicy(t *testing.T) {
+	p := NewLFUPolicy(3)
+	p.Insert("a")
+	p.Insert("b")
+	p.Insert("c")
+	p.Access("a")
+	p.Access("a")
+	p.Access("c")
+	if v, _ := p.Victim(); v != "b" {
+		t.Error("expected b to be the least frequently used, got", v)
+	}
+	p.Remove("b")
+	if v, _ := p.Victim(); v != "c" {
+		t.Error("expected c, got", v)
+	}
+}
+
+func TestFIFOPolicy(t *testing.T) {
+	p := NewFIFOPolicy(2)
+	p.Insert("a")
+	p.Insert("b")
+	p.Access("a")
+	p.Insert("a")
+	if v, _ := p.Victim(); v != "a" {
+		t.Error("expected a to be evicted first, got", v)
+	}
+}
+
+func TestARCPolicy_GhostHit(t *testing.T) {
+	p := NewARCPolicy(2).(*arcPolicy)
+	p.Insert("a")
+	p.Insert("b")
+	v, _ := p.Victim()
+	p.Remove(v)
+	if v != "a" {
+		t.Fatal("expected a, got", v)
+	}
+	// a is now a ghost in b1; requesting it again grows the t1 target and
+	// brings it straight into t2.
+	p.Insert("a")
+	if p.p != 1 {
+		t.Error("p was not adapted:", p.p)
+	}
+	if e := p.elems["a"]; e.Value.(*arcEntry).list != arcT2 {
+		t.Error("a should be in t2")
+	}
+}
+
+func TestTinyLFUPolicy_Admission(t *testing.T) {
+	tc := NewCache(Config{MaxEntries: 100, EvictionPolicy: NewTinyLFUPolicy})
+	for i := 0; i < 100; i++ {
+		tc.Set(fmt.Sprint("hot", i), i, DefaultExpiration)
+	}
+	for r := 0; r < 5; r++ {
+		for i := 0; i < 100; i++ {
+			tc.Get(fmt.Sprint("hot", i))
+		}
+	}
+	// A scan of one-hit wonders must not flush the popular keys.
+	for i := 0; i < 1000; i++ {
+		tc.Set(fmt.Sprint("cold", i), i, DefaultExpiration)
+	}
+	hot := 0
+	for i := 0; i < 100; i++ {
+		if _, found := tc.Get(fmt.Sprint("hot", i)); found {
+			hot++
+		}
+	}
+	if hot < 90 {
+		t.Error("scan evicted too many popular keys, kept", hot)
+	}
+}
+
+func TestCMSketch(t *testing.T) {
+	s := newCMSketch(64)
+	h := hashKey("a")
+	for i := 0; i < 20; i++ {
+		s.increment(h)
+	}
+	if e := s.estimate(h); e != 15 {
+		t.Error("counter should saturate at 15, got", e)
+	}
+	s.reset()
+	if e := s.estimate(h); e != 7 {
+		t.Error("reset should halve counters, got", e)
+	}
+	if e := s.estimate(hashKey("b")); e > 7 {
+		t.Error("unexpected estimate for b:", e)
+	}
+}
+
+// BenchmarkEvictionPolicies_Zipf reports the hit ratio of each policy for a
+// cache holding 1% of a Zipf-distributed key space.
+func BenchmarkEvictionPolicies_Zipf(b *testing.B) {
+	const keySpace = 100000
+	keys := make([]string, keySpace)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+	for _, name := range []string{"LRU", "LFU", "FIFO", "Random", "ARC", "TinyLFU"} {
+		b.Run(name, func(b *testing.B) {
+			tc := NewCache(Config{MaxEntries: keySpace / 100, EvictionPolicy: policies[name]})
+			z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, keySpace-1)
+			hits := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				k := keys[z.Uint64()]
+				if _, found := tc.Get(k); found {
+					hits++
+				} else {
+					tc.Set(k, i, DefaultExpiration)
+				}
+			}
+			b.ReportMetric(float64(hits)/float64(b.N), "hit-ratio")
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package gocache
 
 import (
-	"runtime"
+	"context"
+	"io"
 	"time"
 )
 
@@ -15,18 +16,7 @@ func InitConfig(config Config) {
 	if config.DefaultExpiration == 0 {
 		config.DefaultExpiration = -1
 	}
-	c := &cache{
-		defaultExpiration: config.DefaultExpiration,
-		items:             make(map[string]Item),
-		group:             Group[string, any]{},
-	}
-	instance = &Cache{c}
-
-	if config.CleanupInterval > 0 {
-		runJanitor(c, config.CleanupInterval)
-		runtime.SetFinalizer(instance, stopJanitor)
-	}
-
+	instance = NewCache(config)
 }
 
 func Increment(k string, n int64) error {
@@ -41,6 +31,66 @@ func Set(k string, x any, d time.Duration) {
 	instance.Set(k, x, d)
 }
 
+func SetWithCost(k string, x any, cost int64, d time.Duration) {
+	instance.SetWithCost(k, x, cost, d)
+}
+
+func SetNX(k string, x any, d time.Duration) bool {
+	return instance.SetNX(k, x, d)
+}
+
+func SetXX(k string, x any, d time.Duration) bool {
+	return instance.SetXX(k, x, d)
+}
+
+func IncrBy(k string, n int64) (int64, error) {
+	return instance.IncrBy(k, n)
+}
+
+func IncrByFloat(k string, f float64) (float64, error) {
+	return instance.IncrByFloat(k, f)
+}
+
+func GetSet(k string, x any, d time.Duration) (any, bool) {
+	return instance.GetSet(k, x, d)
+}
+
+func GetDel(k string) (any, bool) {
+	return instance.GetDel(k)
+}
+
+func GetEx(k string, d time.Duration) (any, bool) {
+	return instance.GetEx(k, d)
+}
+
+func MSet(items map[string]any, d time.Duration) {
+	instance.MSet(items, d)
+}
+
+func MSetNX(items map[string]any, d time.Duration) bool {
+	return instance.MSetNX(items, d)
+}
+
+func MGet(keys ...string) []any {
+	return instance.MGet(keys...)
+}
+
+func Append(k string, v string) (int, error) {
+	return instance.Append(k, v)
+}
+
+func StrLen(k string) (int, error) {
+	return instance.StrLen(k)
+}
+
+func GetRange(k string, start, end int) (string, error) {
+	return instance.GetRange(k, start, end)
+}
+
+func SetRange(k string, offset int, v string) (int, error) {
+	return instance.SetRange(k, offset, v)
+}
+
 func Get(k string) (any, bool) {
 	return instance.Get(k)
 }
@@ -57,38 +107,390 @@ func HGet(k, f string) (any, bool) {
 	return instance.HGet(k, f)
 }
 
-func HGetAll(k string) (any, bool) {
+func HGetAll(k string) (map[string]any, bool) {
 	return instance.HGetAll(k)
 }
 
-func HDel(k, f string) {
-	instance.HDel(k, f)
+func HDel(k, f string) bool {
+	return instance.HDel(k, f)
+}
+
+func HMSet(k string, fields map[string]any) error {
+	return instance.HMSet(k, fields)
+}
+
+func HSetNX(k, f string, x any) (bool, error) {
+	return instance.HSetNX(k, f, x)
+}
+
+func HMGet(k string, fields ...string) ([]any, error) {
+	return instance.HMGet(k, fields...)
+}
+
+func HIncrBy(k, f string, n int64) (int64, error) {
+	return instance.HIncrBy(k, f, n)
+}
+
+func HIncrByFloat(k, f string, x float64) (float64, error) {
+	return instance.HIncrByFloat(k, f, x)
+}
+
+func HExists(k, f string) (bool, error) {
+	return instance.HExists(k, f)
+}
+
+func HLen(k string) (int, error) {
+	return instance.HLen(k)
+}
+
+func HKeys(k string) ([]string, error) {
+	return instance.HKeys(k)
+}
+
+func HVals(k string) ([]any, error) {
+	return instance.HVals(k)
+}
+
+func HScan(k string, cursor uint64, match string, count int) (map[string]any, uint64, error) {
+	return instance.HScan(k, cursor, match, count)
+}
+
+func HExpire(k string, d time.Duration, fields ...string) ([]int, error) {
+	return instance.HExpire(k, d, fields...)
 }
 
-func LPush(k string, x any) {
-	instance.LPush(k, x)
+func HPersist(k string, fields ...string) ([]int, error) {
+	return instance.HPersist(k, fields...)
+}
+
+func HTTL(k, f string) (time.Duration, bool, error) {
+	return instance.HTTL(k, f)
+}
+
+func LPush(k string, x any) int {
+	return instance.LPush(k, x)
 }
 
 func LPop(k string) (any, bool) {
 	return instance.LPop(k)
 }
 
-func RPush(k string, x any) {
-	instance.RPush(k, x)
+func RPush(k string, x any) int {
+	return instance.RPush(k, x)
 }
 
 func RPop(k string) (any, bool) {
 	return instance.RPop(k)
 }
 
+func LLen(k string) (int, error) {
+	return instance.LLen(k)
+}
+
+func LRange(k string, start, stop int) ([]any, error) {
+	return instance.LRange(k, start, stop)
+}
+
+func LIndex(k string, i int) (any, bool, error) {
+	return instance.LIndex(k, i)
+}
+
+func LSet(k string, i int, x any) error {
+	return instance.LSet(k, i, x)
+}
+
+func LInsert(k string, before bool, pivot, x any) (int, error) {
+	return instance.LInsert(k, before, pivot, x)
+}
+
+func LRem(k string, count int, x any) (int, error) {
+	return instance.LRem(k, count, x)
+}
+
+func LTrim(k string, start, stop int) error {
+	return instance.LTrim(k, start, stop)
+}
+
+func LPos(k string, x any, opts LPosOptions) ([]int, error) {
+	return instance.LPos(k, x, opts)
+}
+
+func LMove(src, dst string, from, to ListEnd) (any, bool, error) {
+	return instance.LMove(src, dst, from, to)
+}
+
+func RPopLPush(src, dst string) (any, bool, error) {
+	return instance.RPopLPush(src, dst)
+}
+
+func BLPop(ctx context.Context, timeout time.Duration, keys ...string) (string, any, error) {
+	return instance.BLPop(ctx, timeout, keys...)
+}
+
+func BRPop(ctx context.Context, timeout time.Duration, keys ...string) (string, any, error) {
+	return instance.BRPop(ctx, timeout, keys...)
+}
+
+func BLMove(ctx context.Context, timeout time.Duration, src, dst string, from, to ListEnd) (any, error) {
+	return instance.BLMove(ctx, timeout, src, dst, from, to)
+}
+
+func SAdd(k string, members ...string) (int, error) {
+	return instance.SAdd(k, members...)
+}
+
+func SRem(k string, members ...string) (int, error) {
+	return instance.SRem(k, members...)
+}
+
+func SIsMember(k, m string) (bool, error) {
+	return instance.SIsMember(k, m)
+}
+
+func SMembers(k string) ([]string, error) {
+	return instance.SMembers(k)
+}
+
+func SCard(k string) (int, error) {
+	return instance.SCard(k)
+}
+
+func SPop(k string, count int) ([]string, error) {
+	return instance.SPop(k, count)
+}
+
+func SRandMember(k string, count int) ([]string, error) {
+	return instance.SRandMember(k, count)
+}
+
+func SMove(src, dst, m string) (bool, error) {
+	return instance.SMove(src, dst, m)
+}
+
+func SInter(keys ...string) ([]string, error) {
+	return instance.SInter(keys...)
+}
+
+func SUnion(keys ...string) ([]string, error) {
+	return instance.SUnion(keys...)
+}
+
+func SDiff(keys ...string) ([]string, error) {
+	return instance.SDiff(keys...)
+}
+
+func SInterStore(dst string, keys ...string) (int, error) {
+	return instance.SInterStore(dst, keys...)
+}
+
+func SUnionStore(dst string, keys ...string) (int, error) {
+	return instance.SUnionStore(dst, keys...)
+}
+
+func SDiffStore(dst string, keys ...string) (int, error) {
+	return instance.SDiffStore(dst, keys...)
+}
+
+func ZAdd(k string, flags ZAddFlag, members ...Z) (int, error) {
+	return instance.ZAdd(k, flags, members...)
+}
+
+func ZAddIncr(k string, flags ZAddFlag, m Z) (float64, bool, error) {
+	return instance.ZAddIncr(k, flags, m)
+}
+
+func ZIncrBy(k string, incr float64, member string) (float64, error) {
+	return instance.ZIncrBy(k, incr, member)
+}
+
+func ZRem(k string, members ...string) (int, error) {
+	return instance.ZRem(k, members...)
+}
+
+func ZScore(k, member string) (float64, bool, error) {
+	return instance.ZScore(k, member)
+}
+
+func ZCard(k string) (int, error) {
+	return instance.ZCard(k)
+}
+
+func ZRank(k, member string) (int, bool, error) {
+	return instance.ZRank(k, member)
+}
+
+func ZRevRank(k, member string) (int, bool, error) {
+	return instance.ZRevRank(k, member)
+}
+
+func ZRange(k string, start, stop int) ([]Z, error) {
+	return instance.ZRange(k, start, stop)
+}
+
+func ZRevRange(k string, start, stop int) ([]Z, error) {
+	return instance.ZRevRange(k, start, stop)
+}
+
+func ZRangeByScore(k string, r ScoreRange, offset, count int) ([]Z, error) {
+	return instance.ZRangeByScore(k, r, offset, count)
+}
+
+func ZRevRangeByScore(k string, r ScoreRange, offset, count int) ([]Z, error) {
+	return instance.ZRevRangeByScore(k, r, offset, count)
+}
+
+func ZRangeByLex(k string, r LexRange, offset, count int) ([]string, error) {
+	return instance.ZRangeByLex(k, r, offset, count)
+}
+
+func ZCount(k string, r ScoreRange) (int, error) {
+	return instance.ZCount(k, r)
+}
+
+func ZPopMin(k string, count int) ([]Z, error) {
+	return instance.ZPopMin(k, count)
+}
+
+func ZPopMax(k string, count int) ([]Z, error) {
+	return instance.ZPopMax(k, count)
+}
+
+func ZRemRangeByScore(k string, r ScoreRange) (int, error) {
+	return instance.ZRemRangeByScore(k, r)
+}
+
+func XAdd(k string, a XAddArgs) (StreamID, error) {
+	return instance.XAdd(k, a)
+}
+
+func XLen(k string) (int, error) {
+	return instance.XLen(k)
+}
+
+func XRange(k string, start, end StreamID, count int) ([]XMessage, error) {
+	return instance.XRange(k, start, end, count)
+}
+
+func XRevRange(k string, end, start StreamID, count int) ([]XMessage, error) {
+	return instance.XRevRange(k, end, start, count)
+}
+
+func XRead(ctx context.Context, a XReadArgs) ([]XStream, error) {
+	return instance.XRead(ctx, a)
+}
+
+func XGroupCreate(k, group string, start StreamID, mkStream bool) error {
+	return instance.XGroupCreate(k, group, start, mkStream)
+}
+
+func XReadGroup(ctx context.Context, a XReadGroupArgs) ([]XStream, error) {
+	return instance.XReadGroup(ctx, a)
+}
+
+func XAck(k, group string, ids ...StreamID) (int, error) {
+	return instance.XAck(k, group, ids...)
+}
+
+func XPending(k, group string) (XPendingSummary, error) {
+	return instance.XPending(k, group)
+}
+
+func XPendingExt(k, group string, a XPendingExtArgs) ([]XPendingEntry, error) {
+	return instance.XPendingExt(k, group, a)
+}
+
+func XClaim(k, group, consumer string, minIdle time.Duration, ids ...StreamID) ([]XMessage, error) {
+	return instance.XClaim(k, group, consumer, minIdle, ids...)
+}
+
+func Watch(keys ...string) *Tx {
+	return instance.Watch(keys...)
+}
+
+func Update(fn func(tx *Tx) error) error {
+	return instance.Update(fn)
+}
+
+func GetWithVersion(k string) (any, uint64, bool) {
+	return instance.GetWithVersion(k)
+}
+
+func CompareAndSwap(k string, version uint64, x any, d time.Duration) (uint64, bool) {
+	return instance.CompareAndSwap(k, version, x, d)
+}
+
+func CompareAndDelete(k string, version uint64) bool {
+	return instance.CompareAndDelete(k, version)
+}
+
+func UpdateKey(k string, fn func(old any, exists bool) (x any, d time.Duration, keep bool)) (any, bool) {
+	return instance.UpdateKey(k, fn)
+}
+
 func OnEvicted(f func(string, any)) {
 	instance.OnEvicted(f)
 }
 
+func Subscribe(pattern string, events EventMask) (<-chan Event, func()) {
+	return instance.Subscribe(pattern, events)
+}
+
+func SubscribeWithOptions(pattern string, events EventMask, opts SubscribeOptions) (<-chan Event, func()) {
+	return instance.SubscribeWithOptions(pattern, events, opts)
+}
+
+func Publish(channel string, msg any) int {
+	return instance.Publish(channel, msg)
+}
+
+func SubscribeChannels(channels ...string) *Subscription {
+	return instance.SubscribeChannels(channels...)
+}
+
+func PSubscribe(patterns ...string) *Subscription {
+	return instance.PSubscribe(patterns...)
+}
+
 func SetExpiration(k string, d time.Duration) {
 	instance.SetExpiration(k, d)
 }
 
+func TTL(k string) (time.Duration, bool) {
+	return instance.TTL(k)
+}
+
+func Keys(pattern string) []string {
+	return instance.Keys(pattern)
+}
+
+func GetCtx(ctx context.Context, k string) (any, error) {
+	return instance.GetCtx(ctx, k)
+}
+
+func Preload(ctx context.Context, keys ...string) error {
+	return instance.Preload(ctx, keys...)
+}
+
+func GetMany(keys ...string) map[string]any {
+	return instance.GetMany(keys...)
+}
+
+func SetMany(items map[string]any, d time.Duration) {
+	instance.SetMany(items, d)
+}
+
+func DeleteMany(keys ...string) int {
+	return instance.DeleteMany(keys...)
+}
+
+func MemoizeMany(keys []string, fn func(missing []string) (map[string]any, error), d time.Duration) (map[string]any, error) {
+	return instance.MemoizeMany(keys, fn, d)
+}
+
+func MemoizeCtx(ctx context.Context, k string, fn func(ctx context.Context) (any, error), opts MemoizeOptions) (any, error) {
+	return instance.MemoizeCtx(ctx, k, fn, opts)
+}
+
 func Memoize(k string, fn func() (any, error), d time.Duration) (any, error) {
 	return instance.Memoize(k, fn, d)
 }
@@ -108,3 +510,37 @@ func ItemCount() int {
 func Flush() {
 	instance.Flush()
 }
+
+// Save writes every unexpired item in the cache to w.
+func Save(w io.Writer) error {
+	return instance.Save(w)
+}
+
+// SaveFile saves the cache to the named file, replacing it atomically.
+func SaveFile(fname string) error {
+	return instance.SaveFile(fname)
+}
+
+// Load adds the items saved by Save to the cache.
+func Load(r io.Reader) error {
+	return instance.Load(r)
+}
+
+// LoadFile loads the cache from the named file written by SaveFile.
+func LoadFile(fname string) error {
+	return instance.LoadFile(fname)
+}
+
+// RewriteAOF compacts the append-only file of the cache.
+func RewriteAOF() error {
+	return instance.RewriteAOF()
+}
+
+// Close flushes and closes the append-only file of the cache, if any.
+func AOFErr() error {
+	return instance.AOFErr()
+}
+
+func Close() error {
+	return instance.Close()
+}
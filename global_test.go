@@ -1,6 +1,7 @@
 package gocache
 
 import (
+	"context"
 	"math/rand"
 	"testing"
 	"time"
@@ -184,6 +185,23 @@ func TestGlobalHDel(t *testing.T) {
 	}
 }
 
+func TestGlobalStrings(t *testing.T) {
+	InitConfig(DefaultConfig)
+	MSet(map[string]any{"a": "x", "b": "y"}, DefaultExpiration)
+	if n, err := Append("a", "yz"); err != nil || n != 3 {
+		t.Error("Append:", n, err)
+	}
+	if s, _ := GetRange("a", 1, 2); s != "yz" {
+		t.Error("GetRange returned", s)
+	}
+	if values := MGet("a", "b"); values[0] != "xyz" || values[1] != "y" {
+		t.Error("unexpected MGet result:", values)
+	}
+	if x, found := GetDel("b"); !found || x != "y" {
+		t.Error("GetDel returned", x, found)
+	}
+}
+
 func BenchmarkGlobalGetExpiring(b *testing.B) {
 	benchmarkGlobalGet(b, 5*time.Minute)
 }
@@ -306,3 +324,16 @@ func BenchmarkGlobal_RPush_RPop(b *testing.B) {
 	}
 
 }
+
+func TestGlobal_BLPop(t *testing.T) {
+	done := make(chan any)
+	go func() {
+		_, x, _ := BLPop(context.Background(), time.Second, "global-queue")
+		done <- x
+	}()
+	waitForWaiters(t, instance, "global-queue", 1)
+	RPush("global-queue", 1)
+	if x := <-done; x != 1 {
+		t.Error("BLPop got", x)
+	}
+}
@@ -0,0 +1,582 @@
+package gocache
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// hash is the value stored under a key by HSet. Fields given a TTL by
+// HExpire have their expiration, in Unix nanoseconds, in expires. Expired
+// fields are hidden from readers and removed by the next write to the hash
+// or by the janitor.
+type hash struct {
+	fields  map[string]any
+	expires map[string]int64
+}
+
+func newHash() *hash {
+	return &hash{fields: make(map[string]any)}
+}
+
+func (h *hash) expired(f string, now int64) bool {
+	e, ok := h.expires[f]
+	return ok && now > e
+}
+
+// get returns the value of f unless it is missing or expired.
+func (h *hash) get(f string, now int64) (any, bool) {
+	x, ok := h.fields[f]
+	if !ok || h.expired(f, now) {
+		return nil, false
+	}
+	return x, true
+}
+
+// set sets f to x. As in Redis, overwriting a field clears its TTL.
+func (h *hash) set(f string, x any) {
+	h.fields[f] = x
+	delete(h.expires, f)
+}
+
+func (h *hash) del(f string) {
+	delete(h.fields, f)
+	delete(h.expires, f)
+}
+
+// expire sets the expiration of f, or clears it if e is 0.
+func (h *hash) expire(f string, e int64) {
+	if e == 0 {
+		delete(h.expires, f)
+		return
+	}
+	if h.expires == nil {
+		h.expires = make(map[string]int64)
+	}
+	h.expires[f] = e
+}
+
+// purge deletes the expired fields and reports whether any were deleted.
+func (h *hash) purge(now int64) bool {
+	purged := false
+	for f, e := range h.expires {
+		if now > e {
+			h.del(f)
+			purged = true
+		}
+	}
+	return purged
+}
+
+// each calls fn for every unexpired field.
+func (h *hash) each(now int64, fn func(f string, x any)) {
+	for f, x := range h.fields {
+		if !h.expired(f, now) {
+			fn(f, x)
+		}
+	}
+}
+
+func (h *hash) len(now int64) int {
+	if len(h.expires) == 0 {
+		return len(h.fields)
+	}
+	n := 0
+	h.each(now, func(string, any) { n++ })
+	return n
+}
+
+// hash returns the unexpired hash stored under k. It returns ErrWrongType if
+// k holds something else. s.mu must be held.
+func (s *shard) hash(k string) (*hash, bool, error) {
+	item, found := s.item(k)
+	if !found {
+		return nil, false, nil
+	}
+	h, ok := item.Object.(*hash)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+	return h, true, nil
+}
+
+// writableHash returns the hash stored under k with its expired fields
+// purged, or a new empty hash if k does not exist, along with the item to
+// store it in. s.mu must be held for writing.
+func (s *shard) writableHash(k string, now int64) (*hash, Item, error) {
+	item, found := s.item(k)
+	if !found {
+		h := newHash()
+		return h, Item{Object: h}, nil
+	}
+	h, ok := item.Object.(*hash)
+	if !ok {
+		return nil, Item{}, ErrWrongType
+	}
+	if h.purge(now) {
+		item.cost = 0 // measured again by storeDelta
+	}
+	return h, item, nil
+}
+
+// storeHash stores the modified hash under k, whose cost changed by delta,
+// or deletes k if the hash is empty. s.mu must be held.
+func (c *cache) storeHash(s *shard, k string, h *hash, item Item, delta int64, cause string) []keyAndValue {
+	if len(h.fields) == 0 {
+		c.notifyDelete(s, EventDelete, k, cause)
+		s.delete(k)
+		return nil
+	}
+	return s.storeDelta(k, item, delta)
+}
+
+// notifyField publishes the write (EventHSet) or deletion (EventHDel) of
+// the field f of h, the hash under k. It must be called before the change,
+// with the shard lock held.
+func (c *cache) notifyField(t EventMask, k string, h *hash, f string, x any, cause string) {
+	if c.watching(t) {
+		c.notify(Event{Type: t, Key: k, Field: f, Old: h.fields[f], New: x, Cause: cause})
+	}
+}
+
+// HSet sets the field f of the hash stored under k to x. A value of another
+// type stored under k is replaced by a new hash.
+func (c *cache) HSet(k, f string, x any) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	h, item, err := s.writableHash(k, c.now())
+	if err != nil {
+		h = newHash()
+		item = Item{Object: h}
+	}
+	c.notifyField(EventHSet, k, h, f, x, "HSet")
+	delta := -h.fieldCost(f)
+	h.set(f, x)
+	delta += h.fieldCost(f)
+	c.log(aofRecord{Op: opHSet, Key: k, Field: f, Value: x})
+	evicted := s.storeDelta(k, item, delta)
+	s.mu.Unlock()
+	c.evict(evicted)
+}
+
+// HGet returns the field f of the hash stored under k.
+func (c *cache) HGet(k, f string) (any, bool) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, _ := s.hash(k)
+	if !found {
+		return nil, false
+	}
+	x, ok := h.get(f, time.Now().UnixNano())
+	if ok {
+		s.touch(k)
+	}
+	return x, ok
+}
+
+// HGetAll returns a copy of the hash stored under k.
+func (c *cache) HGetAll(k string) (map[string]any, bool) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, _ := s.hash(k)
+	if !found {
+		return nil, false
+	}
+	m := make(map[string]any, len(h.fields))
+	h.each(time.Now().UnixNano(), func(f string, x any) { m[f] = x })
+	s.touch(k)
+	return m, true
+}
+
+// HDel removes the field f from the hash stored under k, and reports whether
+// it was there. The key is deleted once the hash is empty.
+func (c *cache) HDel(k, f string) bool {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	h, found, _ := s.hash(k)
+	if !found {
+		s.mu.Unlock()
+		return false
+	}
+	_, ok := h.get(f, c.now())
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	c.notifyField(EventHDel, k, h, f, nil, "HDel")
+	delta := -h.fieldCost(f)
+	h.del(f)
+	c.log(aofRecord{Op: opHDel, Key: k, Field: f})
+	evicted := c.storeHash(s, k, h, s.items[k], delta, "HDel")
+	s.mu.Unlock()
+	c.evict(evicted)
+	return true
+}
+
+// HMSet sets several fields of the hash stored under k, creating it if
+// needed.
+func (c *cache) HMSet(k string, fields map[string]any) error {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	h, item, err := s.writableHash(k, c.now())
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	var delta int64
+	for f, x := range fields {
+		c.notifyField(EventHSet, k, h, f, x, "HMSet")
+		delta -= h.fieldCost(f)
+		h.set(f, x)
+		delta += h.fieldCost(f)
+		c.log(aofRecord{Op: opHSet, Key: k, Field: f, Value: x})
+	}
+	evicted := c.storeHash(s, k, h, item, delta, "HMSet")
+	s.mu.Unlock()
+	c.evict(evicted)
+	return nil
+}
+
+// HSetNX sets the field f of the hash stored under k only if it does not
+// exist, and reports whether it was set.
+func (c *cache) HSetNX(k, f string, x any) (bool, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	h, item, err := s.writableHash(k, c.now())
+	if err != nil {
+		s.mu.Unlock()
+		return false, err
+	}
+	if _, ok := h.fields[f]; ok {
+		s.mu.Unlock()
+		return false, nil
+	}
+	c.notifyField(EventHSet, k, h, f, x, "HSetNX")
+	h.set(f, x)
+	c.log(aofRecord{Op: opHSet, Key: k, Field: f, Value: x})
+	evicted := s.storeDelta(k, item, h.fieldCost(f))
+	s.mu.Unlock()
+	c.evict(evicted)
+	return true, nil
+}
+
+// HMGet returns the given fields of the hash stored under k, with nil for
+// missing fields.
+func (c *cache) HMGet(k string, fields ...string) ([]any, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, err := s.hash(k)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, len(fields))
+	if !found {
+		return out, nil
+	}
+	now := time.Now().UnixNano()
+	for i, f := range fields {
+		out[i], _ = h.get(f, now)
+	}
+	s.touch(k)
+	return out, nil
+}
+
+// HIncrBy adds n to the integer in the field f of the hash stored under k
+// and returns the result, with the semantics of IncrBy. The field keeps its
+// TTL.
+func (c *cache) HIncrBy(k, f string, n int64) (int64, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	h, item, err := s.writableHash(k, c.now())
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	x, ok := h.fields[f]
+	if !ok {
+		x = int64(0)
+	}
+	cur, ok := toInt64(x)
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrNotInteger
+	}
+	r := cur + n
+	if (n > 0 && r < cur) || (n < 0 && r > cur) {
+		s.mu.Unlock()
+		return 0, ErrNotInteger
+	}
+	v, ok := fromInt64(x, r)
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrNotInteger
+	}
+	c.notifyField(EventHSet, k, h, f, v, "HIncrBy")
+	delta := -h.fieldCost(f)
+	h.fields[f] = v
+	delta += h.fieldCost(f)
+	c.log(aofRecord{Op: opHSet, Key: k, Field: f, Value: v, Exp: h.expires[f]})
+	evicted := s.storeDelta(k, item, delta)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return r, nil
+}
+
+// HIncrByFloat adds x to the number in the field f of the hash stored under
+// k and returns the result, with the semantics of IncrByFloat. The field
+// keeps its TTL.
+func (c *cache) HIncrByFloat(k, f string, x float64) (float64, error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0, ErrNotFloat
+	}
+	s := c.shardFor(k)
+	s.mu.Lock()
+	h, item, err := s.writableHash(k, c.now())
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	old, ok := h.fields[f]
+	if !ok {
+		old = float64(0)
+	}
+	cur, ok := toFloat64(old)
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrNotFloat
+	}
+	r := cur + x
+	if math.IsNaN(r) || math.IsInf(r, 0) {
+		s.mu.Unlock()
+		return 0, ErrNotFloat
+	}
+	var v any
+	switch old.(type) {
+	case float32:
+		v = float32(r)
+	case string:
+		v = strconv.FormatFloat(r, 'f', -1, 64)
+	case []byte:
+		v = []byte(strconv.FormatFloat(r, 'f', -1, 64))
+	default:
+		v = r
+	}
+	c.notifyField(EventHSet, k, h, f, v, "HIncrByFloat")
+	delta := -h.fieldCost(f)
+	h.fields[f] = v
+	delta += h.fieldCost(f)
+	c.log(aofRecord{Op: opHSet, Key: k, Field: f, Value: v, Exp: h.expires[f]})
+	evicted := s.storeDelta(k, item, delta)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return r, nil
+}
+
+// HExists reports whether the hash stored under k has the field f.
+func (c *cache) HExists(k, f string) (bool, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, err := s.hash(k)
+	if !found {
+		return false, err
+	}
+	_, ok := h.get(f, time.Now().UnixNano())
+	return ok, nil
+}
+
+// HLen returns the number of fields in the hash stored under k.
+func (c *cache) HLen(k string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, err := s.hash(k)
+	if !found {
+		return 0, err
+	}
+	return h.len(time.Now().UnixNano()), nil
+}
+
+// HKeys returns the field names of the hash stored under k, in no
+// particular order.
+func (c *cache) HKeys(k string) ([]string, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, err := s.hash(k)
+	if !found {
+		return nil, err
+	}
+	keys := make([]string, 0, len(h.fields))
+	h.each(time.Now().UnixNano(), func(f string, _ any) { keys = append(keys, f) })
+	s.touch(k)
+	return keys, nil
+}
+
+// HVals returns the values of the hash stored under k, in no particular
+// order.
+func (c *cache) HVals(k string) ([]any, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, err := s.hash(k)
+	if !found {
+		return nil, err
+	}
+	vals := make([]any, 0, len(h.fields))
+	h.each(time.Now().UnixNano(), func(_ string, x any) { vals = append(vals, x) })
+	s.touch(k)
+	return vals, nil
+}
+
+// HScan iterates over the hash stored under k like the Redis HSCAN command.
+// Start with cursor 0 and pass the returned cursor to the next call until it
+// is 0 again. Each call examines about count fields (10 if count is not
+// positive) and returns those matching the glob-style pattern match, or all
+// of them if match is empty. Fields present for the whole iteration are
+// returned at least once; fields added or removed meanwhile may or may not
+// be.
+func (c *cache) HScan(k string, cursor uint64, match string, count int) (map[string]any, uint64, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, err := s.hash(k)
+	if !found {
+		return nil, 0, err
+	}
+	if count <= 0 {
+		count = 10
+	}
+	// Fields are visited in the order of their hashes, and the cursor is
+	// the hash to resume from, so the iteration survives changes to the
+	// hash between calls.
+	type scanField struct {
+		hash uint64
+		f    string
+	}
+	var fs []scanField
+	h.each(time.Now().UnixNano(), func(f string, _ any) {
+		if hk := hashKey(f); hk >= cursor {
+			fs = append(fs, scanField{hk, f})
+		}
+	})
+	sort.Slice(fs, func(i, j int) bool {
+		if fs[i].hash != fs[j].hash {
+			return fs[i].hash < fs[j].hash
+		}
+		return fs[i].f < fs[j].f
+	})
+	out := make(map[string]any)
+	i := 0
+	// Never stop between fields with the same hash, which the cursor could
+	// not tell apart.
+	for ; i < len(fs) && (i < count || fs[i].hash == fs[i-1].hash); i++ {
+		if match == "" || matchGlob(match, fs[i].f) {
+			out[fs[i].f] = h.fields[fs[i].f]
+		}
+	}
+	var next uint64
+	if i < len(fs) {
+		next = fs[i].hash
+	}
+	s.touch(k)
+	return out, next, nil
+}
+
+// HExpire sets a TTL of d on the given fields of the hash stored under k.
+// For each field it returns, as in Redis, -2 if the field does not exist, 1
+// if its TTL was set, or 2 if it was deleted because d is not positive.
+// Setting a field with HSet clears its TTL.
+func (c *cache) HExpire(k string, d time.Duration, fields ...string) ([]int, error) {
+	now := time.Now().UnixNano()
+	e := now + int64(d)
+	return c.hexpire(k, fields, func(h *hash, f string) int {
+		if d <= 0 {
+			c.notifyField(EventHDel, k, h, f, nil, "HExpire")
+			h.del(f)
+			c.log(aofRecord{Op: opHDel, Key: k, Field: f})
+			return 2
+		}
+		h.expire(f, e)
+		c.log(aofRecord{Op: opHExpire, Key: k, Members: []string{f}, Exp: e})
+		return 1
+	})
+}
+
+// HPersist removes the TTL from the given fields of the hash stored under k.
+// For each field it returns -2 if the field does not exist, -1 if it has no
+// TTL, or 1 if its TTL was removed.
+func (c *cache) HPersist(k string, fields ...string) ([]int, error) {
+	return c.hexpire(k, fields, func(h *hash, f string) int {
+		if _, ok := h.expires[f]; !ok {
+			return -1
+		}
+		h.expire(f, 0)
+		c.log(aofRecord{Op: opHExpire, Key: k, Members: []string{f}})
+		return 1
+	})
+}
+
+// hexpire applies fn to each existing field of the hash stored under k and
+// collects the results, with -2 for missing fields.
+func (c *cache) hexpire(k string, fields []string, fn func(h *hash, f string) int) ([]int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	h, found, err := s.hash(k)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	out := make([]int, len(fields))
+	if !found {
+		s.mu.Unlock()
+		for i := range out {
+			out[i] = -2
+		}
+		return out, nil
+	}
+	item := s.items[k]
+	if h.purge(c.now()) {
+		item.cost = 0 // measured again by storeDelta
+	}
+	var delta int64
+	for i, f := range fields {
+		if _, ok := h.fields[f]; !ok {
+			out[i] = -2
+			continue
+		}
+		delta -= h.fieldCost(f)
+		out[i] = fn(h, f)
+		delta += h.fieldCost(f)
+	}
+	evicted := c.storeHash(s, k, h, item, delta, "HExpire")
+	s.mu.Unlock()
+	c.evict(evicted)
+	return out, nil
+}
+
+// HTTL returns the time left before the field f of the hash stored under k
+// expires, or NoExpiration if it has no TTL. The boolean is false if the
+// field does not exist.
+func (c *cache) HTTL(k, f string) (time.Duration, bool, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, found, err := s.hash(k)
+	if !found {
+		return 0, false, err
+	}
+	now := time.Now().UnixNano()
+	if _, ok := h.get(f, now); !ok {
+		return 0, false, nil
+	}
+	e, ok := h.expires[f]
+	if !ok {
+		return NoExpiration, true, nil
+	}
+	return time.Duration(e - now), true, nil
+}
@@ -0,0 +1,172 @@
+package gocache
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCache_HMSet_HMGet(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if err := tc.HMSet("h", map[string]any{"a": 1, "b": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := tc.HMGet("h", "a", "missing", "b")
+	if err != nil || !reflect.DeepEqual(got, []any{1, nil, "x"}) {
+		t.Error("HMGet:", got, err)
+	}
+	if ok, _ := tc.HSetNX("h", "a", 2); ok {
+		t.Error("HSetNX overwrote an existing field")
+	}
+	if ok, _ := tc.HSetNX("h", "c", 3); !ok {
+		t.Error("HSetNX did not set a new field")
+	}
+	if n, _ := tc.HLen("h"); n != 3 {
+		t.Error("HLen:", n)
+	}
+	if ok, _ := tc.HExists("h", "c"); !ok {
+		t.Error("HExists: c not found")
+	}
+	keys, _ := tc.HKeys("h")
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Error("HKeys:", keys)
+	}
+	if vals, _ := tc.HVals("h"); len(vals) != 3 {
+		t.Error("HVals:", vals)
+	}
+
+	m, _ := tc.HGetAll("h")
+	m["a"] = 100
+	if x, _ := tc.HGet("h", "a"); x != 1 {
+		t.Error("HGetAll returned the live hash")
+	}
+
+	tc.Set("str", "x", DefaultExpiration)
+	if err := tc.HMSet("str", map[string]any{"a": 1}); err != ErrWrongType {
+		t.Error("HMSet on a string should fail, got", err)
+	}
+	if _, err := tc.HLen("str"); err != ErrWrongType {
+		t.Error("HLen on a string should fail, got", err)
+	}
+
+	tc.HDel("h", "a")
+	tc.HDel("h", "b")
+	tc.HDel("h", "c")
+	if _, found := tc.Get("h"); found {
+		t.Error("an empty hash was not deleted")
+	}
+}
+
+func TestCache_HIncrBy(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if n, err := tc.HIncrBy("h", "n", 5); err != nil || n != 5 {
+		t.Error("HIncrBy on a missing field:", n, err)
+	}
+	tc.HSet("h", "s", "10")
+	if n, _ := tc.HIncrBy("h", "s", -3); n != 7 {
+		t.Error("HIncrBy on a numeric string:", n)
+	}
+	if x, _ := tc.HGet("h", "s"); x != "7" {
+		t.Errorf("HIncrBy should keep the field a string, got %#v", x)
+	}
+	tc.HSet("h", "max", int64(1<<63-1))
+	if _, err := tc.HIncrBy("h", "max", 1); err != ErrNotInteger {
+		t.Error("expected overflow, got", err)
+	}
+	if f, err := tc.HIncrByFloat("h", "n", 0.5); err != nil || f != 5.5 {
+		t.Error("HIncrByFloat:", f, err)
+	}
+	tc.HSet("h", "word", "abc")
+	if _, err := tc.HIncrByFloat("h", "word", 1); err != ErrNotFloat {
+		t.Error("expected ErrNotFloat, got", err)
+	}
+}
+
+func TestCache_HScan(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	want := map[string]any{}
+	for i := 0; i < 100; i++ {
+		f := "f" + strconv.Itoa(i)
+		tc.HSet("h", f, i)
+		want[f] = i
+	}
+	got := map[string]any{}
+	var cursor uint64
+	calls := 0
+	for {
+		m, next, err := tc.HScan("h", cursor, "", 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for f, x := range m {
+			got[f] = x
+		}
+		calls++
+		if cursor = next; cursor == 0 {
+			break
+		}
+		// Fields removed during the iteration must not break it.
+		tc.HDel("h", "f0")
+	}
+	delete(want, "f0")
+	delete(got, "f0")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HScan returned %d fields, want %d", len(got), len(want))
+	}
+	if calls < 100/7 {
+		t.Error("HScan ignored count:", calls)
+	}
+	m, _, _ := tc.HScan("h", 0, "f1?", 1000)
+	if len(m) != 10 {
+		t.Error("HScan with a pattern returned", len(m))
+	}
+}
+
+func TestCache_HExpire(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.HMSet("h", map[string]any{"a": 1, "b": 2, "c": 3})
+	codes, err := tc.HExpire("h", 20*time.Millisecond, "a", "missing")
+	if err != nil || !reflect.DeepEqual(codes, []int{1, -2}) {
+		t.Error("HExpire:", codes, err)
+	}
+	if d, ok, _ := tc.HTTL("h", "a"); !ok || d <= 0 || d > 20*time.Millisecond {
+		t.Error("HTTL:", d, ok)
+	}
+	if d, ok, _ := tc.HTTL("h", "b"); !ok || d != NoExpiration {
+		t.Error("HTTL of a field without a TTL:", d, ok)
+	}
+	if codes, _ := tc.HExpire("h", 0, "c"); !reflect.DeepEqual(codes, []int{2}) {
+		t.Error("HExpire with 0 should delete:", codes)
+	}
+	tc.HExpire("h", time.Hour, "b")
+	tc.HSet("h", "b", 2)
+	if d, _, _ := tc.HTTL("h", "b"); d != NoExpiration {
+		t.Error("HSet should clear the TTL of a field, got", d)
+	}
+	tc.HExpire("h", time.Hour, "b")
+	if codes, _ := tc.HPersist("h", "b", "b"); !reflect.DeepEqual(codes, []int{1, -1}) {
+		t.Error("HPersist:", codes)
+	}
+	tc.HIncrBy("h", "a", 1)
+	if d, _, _ := tc.HTTL("h", "a"); d == NoExpiration {
+		t.Error("HIncrBy should keep the TTL of a field")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, found := tc.HGet("h", "a"); found {
+		t.Error("an expired field was returned")
+	}
+	if n, _ := tc.HLen("h"); n != 1 {
+		t.Error("HLen counts expired fields:", n)
+	}
+
+	tc.HSet("h2", "a", 1)
+	tc.HExpire("h2", time.Millisecond, "a")
+	time.Sleep(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if _, found := tc.Get("h2"); found {
+		t.Error("the janitor kept a hash whose fields all expired")
+	}
+}
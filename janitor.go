@@ -1,13 +1,24 @@
 package gocache
 
-import "time"
+import (
+	"sync"
+	"time"
+)
+
+// expirer is implemented by every cache flavour the janitor can sweep.
+type expirer interface {
+	DeleteExpired()
+}
 
 type janitor struct {
 	Interval time.Duration
 	stop     chan bool
+	done     chan struct{}
+	once     sync.Once
 }
 
-func (j *janitor) Run(c *cache) {
+func (j *janitor) Run(c expirer) {
+	defer close(j.done)
 	ticker := time.NewTicker(j.Interval)
 	for {
 		select {
@@ -20,15 +31,29 @@ func (j *janitor) Run(c *cache) {
 	}
 }
 
+// Stop stops the janitor and waits for a sweep in progress to finish. It
+// may be called more than once.
+func (j *janitor) Stop() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	<-j.done
+}
+
 func stopJanitor(c *Cache) {
-	c.janitor.stop <- true
+	c.janitor.Stop()
 }
 
 func runJanitor(c *cache, ci time.Duration) {
+	c.janitor = newJanitor(c, ci)
+}
+
+func newJanitor(c expirer, ci time.Duration) *janitor {
 	j := &janitor{
 		Interval: ci,
 		stop:     make(chan bool),
+		done:     make(chan struct{}),
 	}
-	c.janitor = j
 	go j.Run(c)
+	return j
 }
@@ -1,123 +1,418 @@
 package gocache
 
 import (
-	"container/list"
-	"time"
+	"bytes"
+	"errors"
+	"reflect"
 )
 
-func (c *cache) LPush(k string, x any) {
-	var obj *list.List
-	c.mu.Lock()
-	item, found := c.items[k]
+var (
+	// ErrNoSuchKey is returned by LSet for a key that does not exist.
+	ErrNoSuchKey = errors.New("gocache: no such key")
+	// ErrIndexOutOfRange is returned by LSet for an index past either end
+	// of the list.
+	ErrIndexOutOfRange = errors.New("gocache: index out of range")
+)
+
+// ListEnd selects the left or right end of a list. Lists are indexed from
+// the left, as in Redis.
+type ListEnd int
+
+const (
+	Left ListEnd = iota
+	Right
+)
+
+// list returns the unexpired list stored under k. It returns ErrWrongType
+// if k holds something else. s.mu must be held.
+func (s *shard) list(k string) (*deque, bool, error) {
+	item, found := s.item(k)
 	if !found {
-		obj = list.New()
+		return nil, false, nil
+	}
+	d, ok := item.Object.(*deque)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+	return d, true, nil
+}
+
+// LPush adds x to the left end of the list stored under k and returns the
+// new length of the list. A value of another type stored under k is
+// replaced by a new list.
+func (c *cache) LPush(k string, x any) int {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	n, evicted := c.push(s, k, Left, x)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return n
+}
+
+// RPush adds x to the right end of the list stored under k and returns the
+// new length of the list. A value of another type stored under k is
+// replaced by a new list.
+func (c *cache) RPush(k string, x any) int {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	n, evicted := c.push(s, k, Right, x)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return n
+}
+
+// push adds x to one end of the list under k, keeping the expiration of an
+// existing list, and wakes the goroutines blocked on k. It returns the
+// length of the list before any of them popped from it. s.mu must be held.
+func (c *cache) push(s *shard, k string, end ListEnd, x any) (int, []keyAndValue) {
+	item, _ := s.item(k)
+	d, ok := item.Object.(*deque)
+	if !ok {
+		d = newDeque()
+		item = Item{Object: d}
+	}
+	if end == Left {
+		d.pushFront(x)
+		c.log(aofRecord{Op: opLPush, Key: k, Value: x})
+		c.notify(Event{Type: EventLPush, Key: k, New: x, Cause: "LPush"})
 	} else {
-		switch item.Object.(type) {
-		case *list.List:
-			obj = item.Object.(*list.List)
-		default:
-			obj = list.New()
+		d.pushBack(x)
+		c.log(aofRecord{Op: opRPush, Key: k, Value: x})
+		c.notify(Event{Type: EventLPush, Key: k, New: x, Cause: "RPush"})
+	}
+	n := d.Len()
+	evicted := s.storeDelta(k, item, elementCost(x))
+	if len(s.waiters[k]) > 0 {
+		c.serveWaiters(s, k)
+	}
+	return n, evicted
+}
 
-		}
+// LPop removes and returns the leftmost element of the list stored under k.
+func (c *cache) LPop(k string) (any, bool) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	x, found := c.pop(s, k, Left)
+	s.mu.Unlock()
+	return x, found
+}
+
+// RPop removes and returns the rightmost element of the list stored under k.
+func (c *cache) RPop(k string) (any, bool) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	x, found := c.pop(s, k, Right)
+	s.mu.Unlock()
+	return x, found
+}
+
+// pop removes an element from one end of the list under k, deleting the
+// key once the list is empty. s.mu must be held.
+func (c *cache) pop(s *shard, k string, end ListEnd) (any, bool) {
+	d, found, _ := s.list(k)
+	if !found {
+		return nil, false
 	}
+	var x any
+	cause := "LPop"
+	if end == Left {
+		x = d.popFront()
+		c.log(aofRecord{Op: opLPop, Key: k})
+	} else {
+		x = d.popBack()
+		c.log(aofRecord{Op: opRPop, Key: k})
+		cause = "RPop"
+	}
+	c.notify(Event{Type: EventLPop, Key: k, Old: x, Cause: cause})
+	c.storeList(s, k, d, -elementCost(x), cause)
+	return x, true
+}
 
-	obj.PushBack(x)
-	c.items[k] = Item{
-		Object:     obj,
-		Expiration: 0,
+// storeList stores the modified list under k, whose cost changed by delta,
+// or deletes k if the list is empty. s.mu must be held.
+func (c *cache) storeList(s *shard, k string, d *deque, delta int64, cause string) {
+	if d.Len() == 0 {
+		c.notifyDelete(s, EventDelete, k, cause)
+		s.delete(k)
+	} else {
+		s.storeDelta(k, s.items[k], delta)
 	}
+}
 
-	c.mu.Unlock()
+// LLen returns the length of the list stored under k.
+func (c *cache) LLen(k string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, found, err := s.list(k)
+	if !found {
+		return 0, err
+	}
+	return d.Len(), nil
 }
 
-func (c *cache) LPop(k string) (any, bool) {
-	c.mu.Lock()
-	item, found := c.items[k]
+// LRange returns the elements of the list stored under k between start and
+// stop, inclusive. Negative indexes count from the right end, as in Redis.
+func (c *cache) LRange(k string, start, stop int) ([]any, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, found, err := s.list(k)
 	if !found {
-		c.mu.Unlock()
-		return nil, false
+		return nil, err
 	}
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.Unlock()
-			return nil, false
-		}
+	s.touch(k)
+	start, stop, ok := rankRange(start, stop, d.Len())
+	if !ok {
+		return []any{}, nil
 	}
-	switch item.Object.(type) {
-	case *list.List:
-		obj := item.Object.(*list.List)
-		ele := obj.Back()
-		obj.Remove(ele)
-		item.Object = obj
-		if obj.Len() == 0 {
-			c.delete(k)
-		} else {
-			c.items[k] = item
-		}
-		c.mu.Unlock()
-		return ele.Value, true
-	default:
-		c.mu.Unlock()
-		return nil, false
+	return d.slice(start, stop), nil
+}
+
+// LIndex returns the element at index i of the list stored under k. A
+// negative index counts from the right end.
+func (c *cache) LIndex(k string, i int) (any, bool, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, found, err := s.list(k)
+	if !found {
+		return nil, false, err
+	}
+	s.touch(k)
+	if i < 0 {
+		i += d.Len()
+	}
+	if i < 0 || i >= d.Len() {
+		return nil, false, nil
+	}
+	return d.at(i), true, nil
+}
 
+// LSet replaces the element at index i of the list stored under k. A
+// negative index counts from the right end.
+func (c *cache) LSet(k string, i int, x any) error {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, found, err := s.list(k)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNoSuchKey
 	}
+	if i < 0 {
+		i += d.Len()
+	}
+	if i < 0 || i >= d.Len() {
+		return ErrIndexOutOfRange
+	}
+	delta := elementCost(x) - elementCost(d.at(i))
+	d.set(i, x)
+	c.log(aofRecord{Op: opLSet, Key: k, Start: i, Value: x})
+	c.storeList(s, k, d, delta, "LSet")
+	return nil
 }
 
-// Rpush
-func (c *cache) RPush(k string, x any) {
-	var obj *list.List
-	c.mu.Lock()
-	item, found := c.items[k]
+// LInsert inserts x before or after the first occurrence of pivot in the
+// list stored under k and returns the new length. It returns -1 if pivot
+// was not found and 0 if k does not exist.
+func (c *cache) LInsert(k string, before bool, pivot, x any) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, found, err := s.list(k)
 	if !found {
-		obj = list.New()
-	} else {
-		switch item.Object.(type) {
-		case *list.List:
-			obj = item.Object.(*list.List)
-		default:
-			obj = list.New()
+		return 0, err
+	}
+	for i := 0; i < d.Len(); i++ {
+		if equalValues(d.at(i), pivot) {
+			if !before {
+				i++
+			}
+			d.insert(i, x)
+			c.log(aofRecord{Op: opLInsert, Key: k, Start: i, Value: x})
+			c.storeList(s, k, d, elementCost(x), "LInsert")
+			return d.Len(), nil
+		}
+	}
+	return -1, nil
+}
 
+// LRem removes elements equal to x from the list stored under k and returns
+// how many were removed. As in Redis, a positive count removes up to count
+// elements starting from the left, a negative count removes up to -count
+// starting from the right, and 0 removes them all.
+func (c *cache) LRem(k string, count int, x any) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, found, err := s.list(k)
+	if !found {
+		return 0, err
+	}
+	remove := make([]bool, d.Len())
+	n := 0
+	if count >= 0 {
+		for i := 0; i < d.Len() && (count == 0 || n < count); i++ {
+			if equalValues(d.at(i), x) {
+				remove[i] = true
+				n++
+			}
+		}
+	} else {
+		for i := d.Len() - 1; i >= 0 && n < -count; i-- {
+			if equalValues(d.at(i), x) {
+				remove[i] = true
+				n++
+			}
 		}
 	}
+	if n == 0 {
+		return 0, nil
+	}
+	var delta int64
+	d.filter(func(i int, y any) bool {
+		if remove[i] {
+			delta -= elementCost(y)
+		}
+		return !remove[i]
+	})
+	c.log(aofRecord{Op: opLRem, Key: k, Start: count, Value: x})
+	c.storeList(s, k, d, delta, "LRem")
+	return n, nil
+}
 
-	obj.PushFront(x)
-	c.items[k] = Item{
-		Object:     obj,
-		Expiration: 0,
+// LTrim trims the list stored under k to the elements between start and
+// stop, inclusive. Negative indexes count from the right end. The key is
+// deleted if no elements remain.
+func (c *cache) LTrim(k string, start, stop int) error {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, found, err := s.list(k)
+	if !found {
+		return err
 	}
+	start, stop, ok := rankRange(start, stop, d.Len())
+	if !ok {
+		start, stop = d.Len(), d.Len()-1
+	}
+	if start == 0 && stop == d.Len()-1 {
+		return nil
+	}
+	var delta int64
+	d.filter(func(i int, y any) bool {
+		keep := i >= start && i <= stop
+		if !keep {
+			delta -= elementCost(y)
+		}
+		return keep
+	})
+	c.log(aofRecord{Op: opLTrim, Key: k, Start: start, Stop: stop})
+	c.storeList(s, k, d, delta, "LTrim")
+	return nil
+}
 
-	c.mu.Unlock()
+// LPosOptions holds the optional arguments of LPos, which mirror those of
+// the Redis LPOS command.
+type LPosOptions struct {
+	// Rank skips to the Rank-th match; a negative Rank searches from the
+	// right end. 0 is the same as 1.
+	Rank int
+	// Count is the maximum number of matches to return. 0 returns only the
+	// first match and a negative Count returns every match.
+	Count int
+	// MaxLen limits the search to the first MaxLen elements. 0 means no
+	// limit.
+	MaxLen int
 }
 
-func (c *cache) RPop(k string) (any, bool) {
-	c.mu.Lock()
-	item, found := c.items[k]
+// LPos returns the indexes of the elements equal to x in the list stored
+// under k.
+func (c *cache) LPos(k string, x any, opts LPosOptions) ([]int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, found, err := s.list(k)
 	if !found {
-		c.mu.Unlock()
-		return nil, false
+		return nil, err
 	}
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			c.mu.Unlock()
-			return nil, false
-		}
+	s.touch(k)
+	rank, count := opts.Rank, opts.Count
+	if rank == 0 {
+		rank = 1
+	}
+	if count == 0 {
+		count = 1
+	}
+	n := d.Len()
+	if opts.MaxLen > 0 && opts.MaxLen < n {
+		n = opts.MaxLen
 	}
-	switch item.Object.(type) {
-	case *list.List:
-		obj := item.Object.(*list.List)
-		ele := obj.Front()
-		obj.Remove(ele)
-		item.Object = obj
-		if obj.Len() == 0 {
-			c.delete(k)
+	var out []int
+	for j := 0; j < n && count != 0; j++ {
+		i := j
+		if rank < 0 {
+			i = d.Len() - 1 - j
+		}
+		if !equalValues(d.at(i), x) {
+			continue
+		}
+		if rank > 1 {
+			rank--
+		} else if rank < -1 {
+			rank++
 		} else {
-			c.items[k] = item
+			out = append(out, i)
+			count--
 		}
-		c.mu.Unlock()
-		return ele.Value, true
-	default:
-		c.mu.Unlock()
-		return nil, false
+	}
+	return out, nil
+}
+
+// LMove pops an element from one end of the list stored under src and
+// pushes it onto one end of the list stored under dst, atomically. It
+// returns the element moved.
+func (c *cache) LMove(src, dst string, from, to ListEnd) (any, bool, error) {
+	ss := c.shardsFor([]string{src, dst})
+	lockShards(ss)
+	ssrc, sdst := c.shardFor(src), c.shardFor(dst)
+	_, found, err := ssrc.list(src)
+	if err == nil {
+		_, _, err = sdst.list(dst)
+	}
+	if err != nil || !found {
+		unlockShards(ss)
+		return nil, false, err
+	}
+	x, _ := c.pop(ssrc, src, from)
+	_, evicted := c.push(sdst, dst, to, x)
+	unlockShards(ss)
+	c.evict(evicted)
+	return x, true, nil
+}
 
+// RPopLPush moves the rightmost element of the list stored under src to the
+// left end of the list stored under dst. It is LMove(src, dst, Right, Left).
+func (c *cache) RPopLPush(src, dst string) (any, bool, error) {
+	return c.LMove(src, dst, Right, Left)
+}
+
+// equalValues compares list elements without panicking on values, such as
+// slices, that do not support ==.
+func equalValues(a, b any) bool {
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case []byte:
+		y, ok := b.([]byte)
+		return ok && bytes.Equal(x, y)
+	}
+	if t := reflect.TypeOf(a); t != nil && !t.Comparable() {
+		return reflect.DeepEqual(a, b)
 	}
+	return a == b
 }
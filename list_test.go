@@ -1,6 +1,10 @@
 package gocache
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestCache_LPush_LPop(t *testing.T) {
 
@@ -93,3 +97,165 @@ func BenchmarkCache_RPush_RPop(b *testing.B) {
 	}
 
 }
+
+func newList(tc *Cache, k string, elems ...any) {
+	for _, x := range elems {
+		tc.RPush(k, x)
+	}
+}
+
+func TestCache_ListOrder(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.LPush("l", "b")
+	tc.LPush("l", "a")
+	tc.RPush("l", "c")
+	if got, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(got, []any{"a", "b", "c"}) {
+		t.Error("lists should be indexed from the left, as in Redis:", got)
+	}
+	if x, _ := tc.RPop("l"); x != "c" {
+		t.Error("RPop should take the right end, got", x)
+	}
+	if n, _ := tc.LLen("l"); n != 2 {
+		t.Error("LLen:", n)
+	}
+	tc.SetExpiration("l", time.Hour)
+	tc.RPush("l", "d")
+	if d, _ := tc.TTL("l"); d <= 0 {
+		t.Error("pushing should keep the expiration of an existing list:", d)
+	}
+}
+
+func TestCache_LRange_LIndex_LSet(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	newList(tc, "l", 0, 1, 2, 3, 4)
+	if got, _ := tc.LRange("l", 1, -2); !reflect.DeepEqual(got, []any{1, 2, 3}) {
+		t.Error("LRange:", got)
+	}
+	if got, _ := tc.LRange("l", -100, 100); len(got) != 5 {
+		t.Error("LRange should clamp out of range indexes:", got)
+	}
+	if got, _ := tc.LRange("l", 3, 1); len(got) != 0 {
+		t.Error("LRange with start > stop:", got)
+	}
+	if x, found, _ := tc.LIndex("l", -1); !found || x != 4 {
+		t.Error("LIndex(-1):", x, found)
+	}
+	if _, found, _ := tc.LIndex("l", 5); found {
+		t.Error("LIndex found an out of range index")
+	}
+	if err := tc.LSet("l", -2, 30); err != nil {
+		t.Error("LSet:", err)
+	}
+	if x, _, _ := tc.LIndex("l", 3); x != 30 {
+		t.Error("LSet did not replace the element:", x)
+	}
+	if err := tc.LSet("l", 5, 0); err != ErrIndexOutOfRange {
+		t.Error("LSet past the end should fail, got", err)
+	}
+	if err := tc.LSet("missing", 0, 0); err != ErrNoSuchKey {
+		t.Error("LSet on a missing key should fail, got", err)
+	}
+	tc.Set("str", "x", DefaultExpiration)
+	if _, err := tc.LRange("str", 0, -1); err != ErrWrongType {
+		t.Error("LRange of a string should fail, got", err)
+	}
+}
+
+func TestCache_LInsert_LRem(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	newList(tc, "l", "a", "b", "a", "c", "a")
+	if n, _ := tc.LInsert("l", true, "b", "x"); n != 6 {
+		t.Error("LInsert before:", n)
+	}
+	if n, _ := tc.LInsert("l", false, "c", "y"); n != 7 {
+		t.Error("LInsert after:", n)
+	}
+	if n, _ := tc.LInsert("l", false, "missing", "z"); n != -1 {
+		t.Error("LInsert with a missing pivot should return -1, got", n)
+	}
+	if n, _ := tc.LInsert("missing", false, "a", "z"); n != 0 {
+		t.Error("LInsert on a missing key should return 0, got", n)
+	}
+	if got, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(got, []any{"a", "x", "b", "a", "c", "y", "a"}) {
+		t.Error("after LInsert:", got)
+	}
+	if n, _ := tc.LRem("l", -2, "a"); n != 2 {
+		t.Error("LRem from the right:", n)
+	}
+	if got, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(got, []any{"a", "x", "b", "c", "y"}) {
+		t.Error("after LRem:", got)
+	}
+	newList(tc, "m", 1, 2, 1, 1)
+	if n, _ := tc.LRem("m", 1, 1); n != 1 {
+		t.Error("LRem from the left:", n)
+	}
+	if n, _ := tc.LRem("m", 0, 1); n != 2 {
+		t.Error("LRem of every match:", n)
+	}
+	tc.LRem("m", 0, 2)
+	if _, found := tc.Get("m"); found {
+		t.Error("an empty list should be deleted")
+	}
+	newList(tc, "b", []byte("x"), []int{1})
+	if n, _ := tc.LRem("b", 0, []int{1}); n != 1 {
+		t.Error("LRem should compare uncomparable values:", n)
+	}
+}
+
+func TestCache_LTrim_LPos(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	newList(tc, "l", "a", "b", "c", "b", "d", "b")
+	if got, _ := tc.LPos("l", "b", LPosOptions{}); !reflect.DeepEqual(got, []int{1}) {
+		t.Error("LPos:", got)
+	}
+	if got, _ := tc.LPos("l", "b", LPosOptions{Rank: 2, Count: -1}); !reflect.DeepEqual(got, []int{3, 5}) {
+		t.Error("LPos with a rank:", got)
+	}
+	if got, _ := tc.LPos("l", "b", LPosOptions{Rank: -1, Count: 2}); !reflect.DeepEqual(got, []int{5, 3}) {
+		t.Error("LPos from the right:", got)
+	}
+	if got, _ := tc.LPos("l", "b", LPosOptions{Count: -1, MaxLen: 4}); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Error("LPos with MaxLen:", got)
+	}
+	if got, _ := tc.LPos("l", "z", LPosOptions{}); len(got) != 0 {
+		t.Error("LPos found a missing element:", got)
+	}
+	tc.LTrim("l", 1, -2)
+	if got, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(got, []any{"b", "c", "b", "d"}) {
+		t.Error("after LTrim:", got)
+	}
+	tc.LTrim("l", 5, 10)
+	if _, found := tc.Get("l"); found {
+		t.Error("trimming every element should delete the list")
+	}
+}
+
+func TestCache_LMove(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	newList(tc, "src", 1, 2, 3)
+	if x, ok, _ := tc.LMove("src", "dst", Left, Right); !ok || x != 1 {
+		t.Error("LMove:", x, ok)
+	}
+	if x, ok, _ := tc.RPopLPush("src", "dst"); !ok || x != 3 {
+		t.Error("RPopLPush:", x, ok)
+	}
+	if got, _ := tc.LRange("dst", 0, -1); !reflect.DeepEqual(got, []any{3, 1}) {
+		t.Error("dst holds", got)
+	}
+	if x, _, _ := tc.LMove("dst", "dst", Left, Right); x != 3 {
+		t.Error("LMove should rotate a list onto itself, got", x)
+	}
+	if got, _ := tc.LRange("dst", 0, -1); !reflect.DeepEqual(got, []any{1, 3}) {
+		t.Error("after rotating dst:", got)
+	}
+	tc.Set("str", "x", DefaultExpiration)
+	if _, _, err := tc.LMove("src", "str", Left, Left); err != ErrWrongType {
+		t.Error("LMove to a string should fail, got", err)
+	}
+	if n, _ := tc.LLen("src"); n != 1 {
+		t.Error("a failed LMove should leave the source untouched")
+	}
+	if _, ok, _ := tc.LMove("missing", "dst", Left, Left); ok {
+		t.Error("LMove from a missing key moved an element")
+	}
+}
@@ -0,0 +1,328 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Loader loads the keys missing from the cache, making Get read through to
+// a backing store.
+type Loader interface {
+	// Load returns the value of key, or ErrNotFound if it does not exist.
+	Load(ctx context.Context, key string) (any, error)
+}
+
+// BatchLoader is implemented by Loaders that can load several keys in one
+// call. Preload uses it.
+type BatchLoader interface {
+	Loader
+	// LoadAll returns the values of the keys that exist.
+	LoadAll(ctx context.Context, keys []string) (map[string]any, error)
+}
+
+// Writer stores the values written to the cache and deletes the keys
+// deleted from it in a backing store. See Config.Writer for the operations
+// it is given.
+type Writer interface {
+	Write(ctx context.Context, key string, value any) error
+	Delete(ctx context.Context, key string) error
+}
+
+// BatchWriter is implemented by Writers that can apply several writes in one
+// call. Write-behind flushes use it.
+type BatchWriter interface {
+	Writer
+	// WriteAll stores values and deletes the keys in deleted.
+	WriteAll(ctx context.Context, values map[string]any, deleted []string) error
+}
+
+// GetCtx is like Get, but reports why a key could not be loaded by the
+// Loader: it returns the error of Loader.Load, or ErrNotFound if the key is
+// missing.
+func (c *cache) GetCtx(ctx context.Context, k string) (any, error) {
+	if c.loader == nil {
+		if x, found := c.Get(k); found {
+			return x, nil
+		}
+		return nil, ErrNotFound
+	}
+	return c.MemoizeCtx(ctx, k, c.loaderFor(k), c.loaderOptions)
+}
+
+// loaderFor returns a MemoizeCtx loader of k calling the Loader.
+func (c *cache) loaderFor(k string) func(ctx context.Context) (any, error) {
+	return func(ctx context.Context) (any, error) {
+		return c.loader.Load(ctx, k)
+	}
+}
+
+// readThrough loads k, missed by Get, with the Loader, if any.
+func (c *cache) readThrough(k string) (any, bool) {
+	if c.loader == nil {
+		return nil, false
+	}
+	x, err := c.MemoizeCtx(context.Background(), k, c.loaderFor(k), c.loaderOptions)
+	return x, err == nil
+}
+
+// Preload loads the keys missing from the cache with the Loader, in a single
+// call to LoadAll if it is a BatchLoader.
+func (c *cache) Preload(ctx context.Context, keys ...string) error {
+	if c.loader == nil {
+		return nil
+	}
+	var missing []string
+	for _, k := range keys {
+		s := c.shardFor(k)
+		s.mu.RLock()
+		_, found := s.item(k)
+		s.mu.RUnlock()
+		if !found {
+			missing = append(missing, k)
+		}
+	}
+	bl, ok := c.loader.(BatchLoader)
+	if !ok {
+		for _, k := range missing {
+			if _, err := c.MemoizeCtx(ctx, k, c.loaderFor(k), c.loaderOptions); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	values, err := bl.LoadAll(ctx, missing)
+	if err != nil {
+		return err
+	}
+	for _, k := range missing {
+		if x, ok := values[k]; ok {
+			c.storeLoaded(k, x, c.loaderOptions)
+		} else {
+			c.storeError(k, ErrNotFound, c.loaderOptions)
+		}
+	}
+	return nil
+}
+
+// write gives a Set (or, if deleted, a Delete) of k to the Writer. It is
+// called with the lock of k held, before k is updated, so that the Writer
+// is given the writes of each key in the order they are applied. With
+// write-through, it returns the error of the Writer, and k must then be
+// left unchanged; with write-behind, the write is queued.
+func (c *cache) write(k string, x any, deleted bool) error {
+	if c.writer == nil {
+		return nil
+	}
+	if c.writeBehind != nil {
+		c.writeBehind.queue(k, x, deleted)
+		return nil
+	}
+	var err error
+	if deleted {
+		err = c.writer.Delete(context.Background(), k)
+	} else {
+		err = c.writer.Write(context.Background(), k, x)
+	}
+	if err != nil && c.onWriteError != nil {
+		c.onWriteError(k, err)
+	}
+	return err
+}
+
+// writeMany is like write for several keys, whose locks must be held, in a
+// single call to WriteAll if the Writer is a BatchWriter. It returns the
+// errors of the keys that failed, which must be left unchanged.
+func (c *cache) writeMany(values map[string]any, deleted []string) map[string]error {
+	if c.writer == nil {
+		return nil
+	}
+	bw, ok := c.writer.(BatchWriter)
+	if !ok || c.writeBehind != nil {
+		var failed map[string]error
+		fail := func(k string, err error) {
+			if err != nil {
+				if failed == nil {
+					failed = make(map[string]error)
+				}
+				failed[k] = err
+			}
+		}
+		for k, x := range values {
+			fail(k, c.write(k, x, false))
+		}
+		for _, k := range deleted {
+			fail(k, c.write(k, nil, true))
+		}
+		return failed
+	}
+	if len(values) == 0 && len(deleted) == 0 {
+		return nil
+	}
+	err := bw.WriteAll(context.Background(), values, deleted)
+	if err == nil {
+		return nil
+	}
+	failed := make(map[string]error, len(values)+len(deleted))
+	for k := range values {
+		failed[k] = err
+	}
+	for _, k := range deleted {
+		failed[k] = err
+	}
+	if c.onWriteError != nil {
+		for k := range failed {
+			c.onWriteError(k, err)
+		}
+	}
+	return failed
+}
+
+// queue queues a write of k, replacing any queued write of k.
+func (wb *writeBehind) queue(k string, x any, deleted bool) {
+	wb.mu.Lock()
+	if !wb.closed {
+		wb.pending[k] = &pendingWrite{value: x, deleted: deleted}
+	}
+	wb.mu.Unlock()
+}
+
+// writeBehind queues the writes given to the Writer, keeping the last one
+// of each key, and flushes them periodically.
+type writeBehind struct {
+	w       Writer
+	retries int
+	onError func(string, error)
+
+	mu      sync.Mutex
+	pending map[string]*pendingWrite
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type pendingWrite struct {
+	value    any
+	deleted  bool
+	attempts int
+}
+
+func newWriteBehind(config Config) *writeBehind {
+	wb := &writeBehind{
+		w:       config.Writer,
+		retries: config.WriteRetries,
+		onError: config.OnWriteError,
+		pending: make(map[string]*pendingWrite),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go wb.run(config.WriteBehind)
+	return wb
+}
+
+func (wb *writeBehind) run(interval time.Duration) {
+	defer close(wb.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			wb.flush(false)
+		case <-wb.stop:
+			wb.flush(true)
+			return
+		}
+	}
+}
+
+// flush gives the queued writes to the Writer. Failed writes are queued
+// again, unless the key was written since, until they have been attempted
+// retries+1 times or last is set.
+func (wb *writeBehind) flush(last bool) {
+	wb.mu.Lock()
+	batch := wb.pending
+	wb.pending = make(map[string]*pendingWrite)
+	wb.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(batch))
+	for k := range batch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ctx := context.Background()
+	failed := make(map[string]error)
+	if bw, ok := wb.w.(BatchWriter); ok {
+		values := make(map[string]any)
+		var deleted []string
+		for _, k := range keys {
+			if p := batch[k]; p.deleted {
+				deleted = append(deleted, k)
+			} else {
+				values[k] = p.value
+			}
+		}
+		if err := bw.WriteAll(ctx, values, deleted); err != nil {
+			for _, k := range keys {
+				failed[k] = err
+			}
+		}
+	} else {
+		for _, k := range keys {
+			var err error
+			if p := batch[k]; p.deleted {
+				err = wb.w.Delete(ctx, k)
+			} else {
+				err = wb.w.Write(ctx, k, p.value)
+			}
+			if err != nil {
+				failed[k] = err
+			}
+		}
+	}
+
+	var dropped []string
+	wb.mu.Lock()
+	for _, k := range keys {
+		if _, ok := failed[k]; !ok {
+			continue
+		}
+		p := batch[k]
+		p.attempts++
+		if _, rewritten := wb.pending[k]; rewritten {
+			continue
+		}
+		if last || p.attempts > wb.retries {
+			dropped = append(dropped, k)
+			continue
+		}
+		wb.pending[k] = p
+	}
+	wb.mu.Unlock()
+	if wb.onError != nil {
+		for _, k := range dropped {
+			wb.onError(k, failed[k])
+		}
+	}
+}
+
+// close flushes the queued writes and stops queueing new ones.
+func (wb *writeBehind) close() {
+	wb.mu.Lock()
+	if wb.closed {
+		wb.mu.Unlock()
+		return
+	}
+	wb.closed = true
+	wb.mu.Unlock()
+	close(wb.stop)
+	<-wb.done
+}
@@ -0,0 +1,209 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mapStore is a Loader and Writer backed by a map.
+type mapStore struct {
+	mu      sync.Mutex
+	m       map[string]any
+	loads   int
+	batches [][]string
+	fail    int // number of writes to fail
+}
+
+func (st *mapStore) Load(ctx context.Context, k string) (any, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.loads++
+	x, ok := st.m[k]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return x, nil
+}
+
+func (st *mapStore) Write(ctx context.Context, k string, x any) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.fail > 0 {
+		st.fail--
+		return errors.New("write failed")
+	}
+	st.m[k] = x
+	return nil
+}
+
+func (st *mapStore) Delete(ctx context.Context, k string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.m, k)
+	return nil
+}
+
+func (st *mapStore) get(k string) (any, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	x, ok := st.m[k]
+	return x, ok
+}
+
+// batchStore adds LoadAll to mapStore.
+type batchStore struct{ *mapStore }
+
+func (st batchStore) LoadAll(ctx context.Context, keys []string) (map[string]any, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.batches = append(st.batches, keys)
+	out := make(map[string]any)
+	for _, k := range keys {
+		if x, ok := st.m[k]; ok {
+			out[k] = x
+		}
+	}
+	return out, nil
+}
+
+func TestCache_Loader(t *testing.T) {
+	st := &mapStore{m: map[string]any{"a": 1, "b": 2}}
+	tc := NewCache(Config{Loader: st, LoaderOptions: MemoizeOptions{NotFoundTTL: time.Hour}})
+	if x, found := tc.Get("a"); !found || x != 1 {
+		t.Error("Get should load a miss:", x, found)
+	}
+	tc.Get("a")
+	if st.loads != 1 {
+		t.Error("a loaded key should be cached, loads:", st.loads)
+	}
+	if _, found := tc.Get("none"); found {
+		t.Error("a key the Loader does not find should be missing")
+	}
+	if _, err := tc.GetCtx(context.Background(), "none"); !errors.Is(err, ErrNotFound) {
+		t.Error("GetCtx should return ErrNotFound, got", err)
+	}
+	if st.loads != 2 {
+		t.Error("a missing key should be cached, loads:", st.loads)
+	}
+
+	bst := batchStore{&mapStore{m: map[string]any{"a": 1, "b": 2}}}
+	tc = NewCache(Config{Loader: bst})
+	tc.Get("a")
+	if err := tc.Preload(context.Background(), "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bst.batches, [][]string{{"b", "c"}}) {
+		t.Error("Preload should load the missing keys at once:", bst.batches)
+	}
+	if x, _ := tc.Get("b"); x != 2 || bst.loads != 1 {
+		t.Error("Preload did not store b:", x, bst.loads)
+	}
+}
+
+func TestCache_WriteThrough(t *testing.T) {
+	st := &mapStore{m: map[string]any{}}
+	var failed []string
+	tc := NewCache(Config{Writer: st, OnWriteError: func(k string, err error) {
+		failed = append(failed, k)
+	}})
+	tc.Set("a", 1, DefaultExpiration)
+	if x, _ := st.get("a"); x != 1 {
+		t.Error("Set was not written through:", x)
+	}
+	st.fail = 1
+	tc.Set("a", 2, DefaultExpiration)
+	if x, _ := tc.Get("a"); x != 1 || !reflect.DeepEqual(failed, []string{"a"}) {
+		t.Error("a failed write should leave the cache unchanged:", x, failed)
+	}
+	tc.Delete("a")
+	if _, found := st.get("a"); found {
+		t.Error("Delete was not written through")
+	}
+
+	tc.SetNX("a", 1, DefaultExpiration)
+	tc.Increment("a", 1)
+	tc.GetSet("b", "x", DefaultExpiration)
+	tc.MSet(map[string]any{"c": 1, "d": 1}, DefaultExpiration)
+	tc.GetDel("d")
+	tc.UpdateKey("c", func(old any, exists bool) (any, time.Duration, bool) {
+		return old.(int) + 1, DefaultExpiration, true
+	})
+	_, v, _ := tc.GetWithVersion("b")
+	tc.CompareAndSwap("b", v, "y", DefaultExpiration)
+	tc.Update(func(tx *Tx) error {
+		tx.Set("e", 1, DefaultExpiration)
+		tx.Delete("c")
+		return nil
+	})
+	want := map[string]any{"a": 2, "b": "y", "e": 1}
+	if !reflect.DeepEqual(st.m, want) {
+		t.Errorf("writes were not all written through: got %v, want %v", st.m, want)
+	}
+	st.fail = 1
+	if _, err := tc.IncrBy("a", 1); err == nil {
+		t.Error("IncrBy should return the error of the Writer")
+	}
+	if x, _ := tc.Get("a"); x != 2 {
+		t.Error("a failed IncrBy should leave the cache unchanged:", x)
+	}
+
+	// Concurrent writes reach the Writer in the order they are applied.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.Set("f", i*100+j, DefaultExpiration)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if x, _ := tc.Get("f"); x != st.m["f"] {
+		t.Error("the cache and the Writer diverged:", x, st.m["f"])
+	}
+}
+
+func TestCache_WriteBehind(t *testing.T) {
+	st := &mapStore{m: map[string]any{}}
+	errs := make(chan string, 10)
+	tc := NewCache(Config{Writer: st, WriteBehind: 10 * time.Millisecond, WriteRetries: 1, OnWriteError: func(k string, err error) {
+		errs <- k
+	}})
+	st.fail = 1
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("a", 2, DefaultExpiration)
+	tc.Set("b", 1, DefaultExpiration)
+	tc.Delete("b")
+	if _, found := st.get("a"); found {
+		t.Error("write-behind should not write synchronously")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if x, _ := st.get("a"); x != 2 {
+		t.Error("a failed write should be retried with the last value, got", x)
+	}
+	if _, found := st.get("b"); found {
+		t.Error("b should be deleted")
+	}
+
+	st.fail = 2
+	tc.Set("c", 1, DefaultExpiration)
+	select {
+	case k := <-errs:
+		if k != "c" {
+			t.Error("OnWriteError:", k)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a write that exhausted its retries was not reported")
+	}
+
+	tc.Set("d", 1, DefaultExpiration)
+	tc.Close()
+	if x, _ := st.get("d"); x != 1 {
+		t.Error("Close should flush queued writes")
+	}
+}
@@ -0,0 +1,204 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ErrNotFound may be returned by a MemoizeCtx loader for a key that does not
+// exist, so that the miss is cached for MemoizeOptions.NotFoundTTL.
+var ErrNotFound = errors.New("gocache: not found")
+
+// CachedError is returned by MemoizeCtx, and stored in the cache, while an
+// error returned by the loader is cached. Get, GetMany, TTL and Items treat
+// a key holding one as missing.
+type CachedError struct {
+	Err error
+	// Failures is the number of consecutive failed loads of the key.
+	Failures int
+}
+
+func (e *CachedError) Error() string { return e.Err.Error() }
+
+func (e *CachedError) Unwrap() error { return e.Err }
+
+// isCachedError reports whether item holds an error cached by MemoizeCtx.
+func isCachedError(item Item) bool {
+	_, ok := item.Object.(*CachedError)
+	return ok
+}
+
+// MemoizeOptions configures MemoizeCtx.
+type MemoizeOptions struct {
+	// TTL is the expiration of loaded values, as in Set.
+	TTL time.Duration
+	// Timeout bounds each call to the loader. Zero means no timeout.
+	Timeout time.Duration
+	// StaleFor keeps a value for this long after its TTL: MemoizeCtx
+	// returns it at once and reloads it in the background. To Get and the
+	// other methods, the value has expired.
+	StaleFor time.Duration
+	// RefreshAhead, between 0 and 1, reloads a value in the background
+	// once less than this fraction of its TTL remains, so that frequently
+	// read keys never miss. Zero disables it.
+	RefreshAhead float64
+	// ErrorTTL caches errors returned by the loader, other than
+	// ErrNotFound, so that a failing backend is not called by every
+	// caller. Each consecutive failure doubles it, up to MaxErrorTTL, and
+	// it is jittered so that keys do not retry in lockstep. Zero disables
+	// it.
+	ErrorTTL    time.Duration
+	MaxErrorTTL time.Duration
+	// NotFoundTTL caches ErrNotFound returned by the loader. Zero disables
+	// it.
+	NotFoundTTL time.Duration
+}
+
+// MemoizeCtx returns the value of k, calling fn to load and store it on a
+// miss. Only one load of a key is in flight at a time, and the cache is not
+// locked while it runs. fn runs on the goroutine of the caller that missed
+// first, and is given a context that is not canceled with ctx, since other
+// callers may wait for the same load; a waiting caller whose ctx is done
+// returns ctx.Err() without waiting. If fn panics, so do the caller and the
+// callers waiting for it. Values that are stale or due for a refresh, as
+// set by opts, are returned at once while they are reloaded in the
+// background, where a panic of fn is cached as an error, as set by opts.
+// While an error is cached, it is returned as a *CachedError.
+func (c *cache) MemoizeCtx(ctx context.Context, k string, fn func(ctx context.Context) (any, error), opts MemoizeOptions) (any, error) {
+	now := time.Now().UnixNano()
+	s := c.shardFor(k)
+	s.mu.RLock()
+	item, found := s.items[k]
+	expired := item.Expiration > 0 && now > item.Expiration
+	found = found && (!expired || (now <= item.staleUntil && !isCachedError(item)))
+	if found {
+		s.touch(k)
+	}
+	s.mu.RUnlock()
+	if found {
+		if e, ok := item.Object.(*CachedError); ok {
+			return nil, e
+		}
+		if expired || (item.refreshAt > 0 && now >= item.refreshAt) {
+			c.group.DoChan(k, func() (any, error) {
+				return c.refresh(k, fn, opts)
+			})
+		}
+		return item.Object, nil
+	}
+
+	x, err, _ := c.group.DoCtx(ctx, k, func(context.Context) (any, error) {
+		// A load that completed since the miss above has stored k.
+		s.mu.RLock()
+		item, found := s.memoized(k)
+		s.mu.RUnlock()
+		if found {
+			if e, ok := item.Object.(*CachedError); ok {
+				return nil, e
+			}
+			return item.Object, nil
+		}
+		x, err := c.load(k, fn, opts)
+		if err != nil {
+			c.storeError(k, err, opts)
+		}
+		return x, err
+	})
+	return x, err
+}
+
+// refresh reloads k in the background. A panic of fn is cached as an error
+// rather than crashing the process.
+func (c *cache) refresh(k string, fn func(ctx context.Context) (any, error), opts MemoizeOptions) (x any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			x, err = nil, fmt.Errorf("gocache: Memoize loader panicked: %v", r)
+			c.storeError(k, err, opts)
+		}
+	}()
+	return c.load(k, fn, opts)
+}
+
+// load calls fn and stores the value it returns under k.
+func (c *cache) load(k string, fn func(ctx context.Context) (any, error), opts MemoizeOptions) (any, error) {
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	x, err := fn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.storeLoaded(k, x, opts)
+	return x, nil
+}
+
+// storeLoaded stores x, loaded for k, as set by opts.
+func (c *cache) storeLoaded(k string, x any, opts MemoizeOptions) {
+	item := Item{Object: x, Expiration: c.expiration(opts.TTL)}
+	if item.Expiration > 0 {
+		ttl := item.Expiration - time.Now().UnixNano()
+		item.refreshAt = item.Expiration - int64(float64(ttl)*opts.RefreshAhead)
+		if opts.StaleFor > 0 {
+			item.staleUntil = item.Expiration + int64(opts.StaleFor)
+		}
+	}
+	s := c.shardFor(k)
+	s.mu.Lock()
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: item.Expiration})
+	c.notifySet(s, EventSet, k, x, "Memoize")
+	evicted := s.store(k, item)
+	s.mu.Unlock()
+	c.evict(evicted)
+}
+
+// storeError caches err, returned by the loader of k, as set by opts. It is
+// not logged to the append-only file nor saved in snapshots.
+func (c *cache) storeError(k string, err error, opts MemoizeOptions) {
+	notFound := errors.Is(err, ErrNotFound)
+	ttl := opts.ErrorTTL
+	if notFound {
+		ttl = opts.NotFoundTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	s := c.shardFor(k)
+	s.mu.Lock()
+	e := &CachedError{Err: err, Failures: 1}
+	if !notFound {
+		// The previous error may have expired; it is kept for a while.
+		if prev, ok := s.items[k].Object.(*CachedError); ok {
+			e.Failures = prev.Failures + 1
+		}
+		ttl = backoff(ttl, opts.MaxErrorTTL, e.Failures)
+	}
+	c.notifySet(s, EventSet, k, e, "Memoize")
+	item := Item{Object: e, Expiration: time.Now().Add(ttl).UnixNano()}
+	if !notFound {
+		// Keep the expired error for twice as long, so that a failure
+		// soon after it expires still backs off further.
+		item.staleUntil = item.Expiration + 2*int64(ttl)
+	}
+	evicted := s.store(k, item)
+	s.mu.Unlock()
+	c.evict(evicted)
+}
+
+// backoff doubles ttl for each failure after the first, up to max if it is
+// positive, and returns a random duration between half and all of it.
+func backoff(ttl, max time.Duration, failures int) time.Duration {
+	for i := 1; i < failures && ttl < math.MaxInt64/2 && (max <= 0 || ttl < max); i++ {
+		ttl *= 2
+	}
+	if max > 0 && ttl > max {
+		ttl = max
+	}
+	return ttl/2 + time.Duration(rand.Int63n(int64(ttl/2)+1))
+}
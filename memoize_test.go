@@ -0,0 +1,268 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache_MemoizeCtx(t *testing.T) {
+	tc := NewCache(Config{Shards: 1})
+	ctx := context.Background()
+	var calls int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x, err := tc.MemoizeCtx(ctx, "a", load, MemoizeOptions{}); x != "v" || err != nil {
+				t.Error("MemoizeCtx:", x, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	// The shard is not locked while loading.
+	tc.Set("b", 1, DefaultExpiration)
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := tc.MemoizeCtx(cctx, "a", load, MemoizeOptions{}); err != context.DeadlineExceeded {
+		t.Error("a waiter should leave when its context is done, got", err)
+	}
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("concurrent misses should load once, loaded", n)
+	}
+	if x, _ := tc.Get("a"); x != "v" {
+		t.Error("the loaded value was not stored:", x)
+	}
+
+	_, err := tc.MemoizeCtx(ctx, "t", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, MemoizeOptions{Timeout: 10 * time.Millisecond})
+	if err != context.DeadlineExceeded {
+		t.Error("the loader should be given a context with the timeout, got", err)
+	}
+}
+
+func TestCache_MemoizeCtx_Refresh(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	ctx := context.Background()
+	var n int32
+	load := func(context.Context) (any, error) {
+		return int(atomic.AddInt32(&n, 1)), nil
+	}
+	get := func(opts MemoizeOptions) any {
+		x, err := tc.MemoizeCtx(ctx, "a", load, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return x
+	}
+
+	stale := MemoizeOptions{TTL: 30 * time.Millisecond, StaleFor: time.Hour}
+	get(stale)
+	time.Sleep(40 * time.Millisecond)
+	if _, found := tc.Get("a"); found {
+		t.Error("Get returned a stale value")
+	}
+	if _, found := tc.TTL("a"); found {
+		t.Error("TTL found a stale value")
+	}
+	tc.DeleteExpired() // keeps it for MemoizeCtx
+	if x := get(stale); x != 1 {
+		t.Error("a stale value should be returned while it is reloaded, got", x)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if x := get(stale); x != 2 {
+		t.Error("a stale value was not reloaded, got", x)
+	}
+
+	tc.Delete("a")
+	ahead := MemoizeOptions{TTL: 100 * time.Millisecond, RefreshAhead: 0.5}
+	get(ahead)
+	if x := get(ahead); x != 3 {
+		t.Error("a fresh value should not be reloaded, got", x)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if x := get(ahead); x != 3 {
+		t.Error("a value due for refresh should be returned, got", x)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if x := get(ahead); x != 4 {
+		t.Error("a value was not refreshed ahead of its expiration, got", x)
+	}
+}
+
+func TestCache_MemoizeCtx_Panic(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic of the loader should reach the caller")
+			}
+		}()
+		tc.Memoize("a", func() (any, error) { panic("boom") }, DefaultExpiration)
+	}()
+	if x, err := tc.Memoize("a", func() (any, error) { return 1, nil }, DefaultExpiration); x != 1 || err != nil {
+		t.Error("a load after a panic should run, got", x, err)
+	}
+
+	ctx := context.Background()
+	opts := MemoizeOptions{TTL: 10 * time.Millisecond, StaleFor: time.Hour, ErrorTTL: time.Hour}
+	tc.MemoizeCtx(ctx, "b", func(context.Context) (any, error) { return 1, nil }, opts)
+	time.Sleep(15 * time.Millisecond)
+	x, _ := tc.MemoizeCtx(ctx, "b", func(context.Context) (any, error) { panic("boom") }, opts)
+	if x != 1 {
+		t.Error("the stale value should be returned, got", x)
+	}
+	time.Sleep(10 * time.Millisecond)
+	var cached *CachedError
+	if _, err := tc.MemoizeCtx(ctx, "b", nil, opts); !errors.As(err, &cached) {
+		t.Error("a panic of a background refresh should be cached as an error, got", err)
+	}
+}
+
+func TestCache_MemoizeCtx_Errors(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	ctx := context.Background()
+	fail := errors.New("backend down")
+	var calls int32
+	load := func(context.Context) (any, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, fail
+	}
+	opts := MemoizeOptions{ErrorTTL: 40 * time.Millisecond, MaxErrorTTL: time.Hour}
+
+	if _, err := tc.MemoizeCtx(ctx, "a", load, opts); err != fail {
+		t.Error("the loader's error should be returned, got", err)
+	}
+	_, err := tc.MemoizeCtx(ctx, "a", load, opts)
+	var cached *CachedError
+	if !errors.As(err, &cached) || !errors.Is(err, fail) || cached.Failures != 1 {
+		t.Error("a cached error should be returned, got", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Error("the loader was called while its error was cached:", n)
+	}
+
+	time.Sleep(45 * time.Millisecond)
+	tc.DeleteExpired() // keeps the expired error to count the next failure
+	if _, err := tc.MemoizeCtx(ctx, "a", load, opts); err != fail {
+		t.Error("an expired error should not be returned, got", err)
+	}
+	_, err = tc.MemoizeCtx(ctx, "a", load, opts)
+	if !errors.As(err, &cached) || cached.Failures != 2 {
+		t.Error("consecutive failures should be counted, got", err)
+	}
+	s := tc.shardFor("a")
+	s.mu.RLock()
+	ttl := time.Duration(s.items["a"].Expiration - time.Now().UnixNano())
+	s.mu.RUnlock()
+	if ttl < 30*time.Millisecond || ttl > 80*time.Millisecond {
+		t.Error("the second failure should back off, TTL", ttl)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("Get returned a cached error")
+	}
+	if _, found := tc.TTL("a"); found {
+		t.Error("TTL found a cached error")
+	}
+	if _, found := tc.Items()["a"]; found {
+		t.Error("Items returned a cached error")
+	}
+
+	x, err := tc.MemoizeCtx(ctx, "b", func(context.Context) (any, error) {
+		return nil, ErrNotFound
+	}, MemoizeOptions{NotFoundTTL: time.Hour})
+	if x != nil || err != ErrNotFound {
+		t.Error("MemoizeCtx:", x, err)
+	}
+	if _, err := tc.MemoizeCtx(ctx, "b", load, opts); !errors.Is(err, ErrNotFound) {
+		t.Error("a missing key should be cached, got", err)
+	}
+
+	if _, err := tc.MemoizeCtx(ctx, "c", load, MemoizeOptions{}); err != fail {
+		t.Error(err)
+	}
+	if _, found := tc.Get("c"); found {
+		t.Error("errors should not be cached by default")
+	}
+
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tc2 := NewCache(DefaultConfig)
+	tc2.Load(&buf)
+	if tc2.ItemCount() != 0 {
+		t.Error("cached errors should not be saved")
+	}
+}
+
+func TestCache_CachedErrorHidden(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	fail := errors.New("backend down")
+	tc.MemoizeCtx(context.Background(), "a", func(context.Context) (any, error) {
+		return nil, fail
+	}, MemoizeOptions{ErrorTTL: time.Hour})
+
+	if x, _, found := tc.GetWithVersion("a"); found {
+		t.Error("GetWithVersion returned a cached error:", x)
+	}
+	if xs := tc.MGet("a"); xs[0] != nil {
+		t.Error("MGet returned a cached error:", xs[0])
+	}
+	if n, err := tc.StrLen("a"); n != 0 || err != nil {
+		t.Error("StrLen:", n, err)
+	}
+	if keys := tc.Keys("*"); len(keys) != 0 {
+		t.Error("Keys returned a cached error:", keys)
+	}
+	if err := tc.Increment("a", 1); err == nil {
+		t.Error("Increment should not find a cached error")
+	}
+	tc.Update(func(tx *Tx) error {
+		if x, found := tx.Get("a"); found {
+			t.Error("Tx.Get returned a cached error:", x)
+		}
+		return nil
+	})
+	if x, found := tc.GetDel("a"); found {
+		t.Error("GetDel returned a cached error:", x)
+	}
+	if n, err := tc.IncrBy("a", 2); n != 2 || err != nil {
+		t.Error("IncrBy should treat a cached error as missing:", n, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, c := range []struct {
+		ttl, max time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{time.Second, 0, 1, time.Second},
+		{time.Second, 0, 3, 4 * time.Second},
+		{time.Second, 5 * time.Second, 4, 5 * time.Second},
+		{time.Second, 0, 1000, time.Second << 33},
+	} {
+		got := backoff(c.ttl, c.max, c.failures)
+		if got < c.want/2 || got > c.want {
+			t.Errorf("backoff(%v, %v, %d) = %v, want between %v and %v", c.ttl, c.max, c.failures, got, c.want/2, c.want)
+		}
+	}
+}
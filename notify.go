@@ -0,0 +1,247 @@
+package gocache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EventMask selects the kinds of events a subscriber receives. The Type of
+// an Event has exactly one bit set.
+type EventMask uint32
+
+const (
+	// EventSet is a string or other plain value being written.
+	EventSet EventMask = 1 << iota
+	// EventDelete is a key being deleted, including a hash, list, set or
+	// sorted set deleted because its last element was removed.
+	EventDelete
+	// EventExpire is an expired key being removed by the janitor or
+	// DeleteExpired.
+	EventExpire
+	// EventEvict is a key being evicted to respect MaxEntries or MaxCost.
+	EventEvict
+	// EventHSet is a hash field being written.
+	EventHSet
+	// EventHDel is a hash field being deleted.
+	EventHDel
+	// EventLPush is an element being pushed onto either end of a list.
+	EventLPush
+	// EventLPop is an element being popped from either end of a list.
+	EventLPop
+	// EventIncr is a number being incremented or decremented.
+	EventIncr
+	// EventFlush is the whole cache being flushed. It has no key and is
+	// delivered regardless of the subscriber's pattern.
+	EventFlush
+
+	EventAll = EventSet | EventDelete | EventExpire | EventEvict | EventHSet |
+		EventHDel | EventLPush | EventLPop | EventIncr | EventFlush
+)
+
+// Event describes a change to the cache.
+type Event struct {
+	Type EventMask
+	Key  string
+	// Field is the hash field of EventHSet and EventHDel events.
+	Field string
+	// Old is the value replaced or removed, if any, and New the value
+	// written or pushed. For EventLPop, Old is the element popped. Hashes,
+	// lists, sets, sorted sets and streams are never exposed and appear as
+	// nil.
+	Old, New any
+	// Cause is the operation responsible, such as "Set", "GetDel" or
+	// "RPush". It is empty for expirations and evictions.
+	Cause string
+}
+
+// OverflowPolicy decides what happens to an event when a subscriber's
+// channel is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDrop discards the event.
+	OverflowDrop OverflowPolicy = iota
+	// OverflowBlock waits until the subscriber makes room, holding up the
+	// write that produced the event. Subscribers using OverflowDrop get
+	// the event first, so they are not held up. Events are delivered with
+	// the lock of the key's shard held, and with every lock held for Flush
+	// and transactions, so a full channel holds up all other reads and
+	// writes of those shards. The goroutine reading the channel must not
+	// call the cache at all, not even to read, since the call could wait
+	// for a write that waits for the reader: hand the events to another
+	// goroutine to act on them.
+	OverflowBlock
+)
+
+// defaultEventBuffer is the channel capacity of a subscription when
+// SubscribeOptions.Buffer is not set.
+const defaultEventBuffer = 128
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	// Buffer is the capacity of the event channel. It defaults to 128.
+	Buffer int
+	// Overflow is what happens when the channel is full.
+	Overflow OverflowPolicy
+}
+
+// notifier fans events out to subscribers. Writers deliver events
+// themselves, under the lock of the shard they modify, to each subscriber's
+// bounded channel.
+type notifier struct {
+	mask uint32 // union of the subscribers' masks, read atomically
+	mu   sync.Mutex
+	subs []*subscriber // copied on write
+}
+
+type subscriber struct {
+	pattern  string
+	mask     EventMask
+	overflow OverflowPolicy
+	ch       chan Event
+	done     chan struct{}
+	mu       sync.Mutex // held while sending on ch
+	closed   bool
+}
+
+// Subscribe returns a channel of the events matching events on the keys
+// matching pattern, a glob-style pattern as understood by Keys. The
+// channel has a buffer of 128 events and events that do not fit are
+// dropped; use SubscribeWithOptions to change that. Call cancel to end the
+// subscription and close the channel.
+func (c *cache) Subscribe(pattern string, events EventMask) (<-chan Event, func()) {
+	return c.SubscribeWithOptions(pattern, events, SubscribeOptions{})
+}
+
+// SubscribeWithOptions is like Subscribe, with the buffer size and overflow
+// policy given by opts.
+func (c *cache) SubscribeWithOptions(pattern string, events EventMask, opts SubscribeOptions) (<-chan Event, func()) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultEventBuffer
+	}
+	sub := &subscriber{
+		pattern:  pattern,
+		mask:     events,
+		overflow: opts.Overflow,
+		ch:       make(chan Event, opts.Buffer),
+		done:     make(chan struct{}),
+	}
+	n := &c.notifier
+	n.mu.Lock()
+	n.subs = append(n.subs[:len(n.subs):len(n.subs)], sub)
+	n.updateMask()
+	n.mu.Unlock()
+	var once sync.Once
+	return sub.ch, func() { once.Do(func() { n.unsubscribe(sub) }) }
+}
+
+func (n *notifier) unsubscribe(sub *subscriber) {
+	n.mu.Lock()
+	subs := make([]*subscriber, 0, len(n.subs))
+	for _, s := range n.subs {
+		if s != sub {
+			subs = append(subs, s)
+		}
+	}
+	n.subs = subs
+	n.updateMask()
+	n.mu.Unlock()
+
+	close(sub.done)
+	sub.mu.Lock()
+	sub.closed = true
+	close(sub.ch)
+	sub.mu.Unlock()
+}
+
+// updateMask recomputes the union of the subscribers' masks. n.mu must be
+// held.
+func (n *notifier) updateMask() {
+	var mask EventMask
+	for _, s := range n.subs {
+		mask |= s.mask
+	}
+	atomic.StoreUint32(&n.mask, uint32(mask))
+}
+
+func (s *subscriber) deliver(e Event) {
+	if s.mask&e.Type == 0 || (e.Type != EventFlush && !matchGlob(s.pattern, e.Key)) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.overflow == OverflowBlock {
+		select {
+		case s.ch <- e:
+		case <-s.done:
+		}
+		return
+	}
+	select {
+	case s.ch <- e:
+	default:
+	}
+}
+
+// watching reports whether any subscriber wants events of type t.
+func (c *cache) watching(t EventMask) bool {
+	return EventMask(atomic.LoadUint32(&c.notifier.mask))&t != 0
+}
+
+// notify delivers e to the subscribers. The caller must hold the lock of
+// the shard owning e.Key, so that events on a key are delivered in order.
+func (c *cache) notify(e Event) {
+	if !c.watching(e.Type) {
+		return
+	}
+	n := &c.notifier
+	n.mu.Lock()
+	subs := n.subs
+	n.mu.Unlock()
+	for _, s := range subs {
+		if s.overflow != OverflowBlock {
+			s.deliver(e)
+		}
+	}
+	for _, s := range subs {
+		if s.overflow == OverflowBlock {
+			s.deliver(e)
+		}
+	}
+}
+
+// notifySet publishes the write of x under k. It must be called before the
+// write, with s.mu held, to capture the value being replaced.
+func (c *cache) notifySet(s *shard, t EventMask, k string, x any, cause string) {
+	if !c.watching(t) {
+		return
+	}
+	old, _ := s.item(k)
+	c.notify(Event{Type: t, Key: k, Old: plainValue(old.Object), New: plainValue(x), Cause: cause})
+}
+
+// notifyDelete publishes the removal of k. It must be called before the
+// removal, with s.mu held.
+func (c *cache) notifyDelete(s *shard, t EventMask, k string, cause string) {
+	if !c.watching(t) {
+		return
+	}
+	old, found := s.items[k]
+	if !found {
+		return
+	}
+	c.notify(Event{Type: t, Key: k, Old: plainValue(old.Object), Cause: cause})
+}
+
+// plainValue hides the mutable containers behind hashes, lists, sets,
+// sorted sets and streams, and errors cached by MemoizeCtx, from subscribers.
+func plainValue(x any) any {
+	switch x.(type) {
+	case *hash, *deque, set, *zset, *stream, *CachedError:
+		return nil
+	}
+	return x
+}
@@ -0,0 +1,217 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event on ch, failing the test if none arrives.
+func nextEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("the event channel was closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func TestCache_Subscribe(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	ch, cancel := tc.Subscribe("*", EventAll)
+	defer cancel()
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("a", 2, DefaultExpiration)
+	tc.IncrBy("a", 3)
+	tc.HSet("h", "f", "x")
+	tc.HDel("h", "f")
+	tc.RPush("l", "e")
+	tc.LPop("l")
+	tc.Delete("a")
+	tc.XAdd("s", XAddArgs{Values: map[string]any{"n": 1}})
+	tc.Delete("s")
+	tc.Flush()
+
+	want := []Event{
+		{Type: EventSet, Key: "a", New: 1, Cause: "Set"},
+		{Type: EventSet, Key: "a", Old: 1, New: 2, Cause: "Set"},
+		{Type: EventIncr, Key: "a", Old: 2, New: 5, Cause: "IncrBy"},
+		{Type: EventHSet, Key: "h", Field: "f", New: "x", Cause: "HSet"},
+		{Type: EventHDel, Key: "h", Field: "f", Old: "x", Cause: "HDel"},
+		{Type: EventDelete, Key: "h", Cause: "HDel"},
+		{Type: EventLPush, Key: "l", New: "e", Cause: "RPush"},
+		{Type: EventLPop, Key: "l", Old: "e", Cause: "LPop"},
+		{Type: EventDelete, Key: "l", Cause: "LPop"},
+		{Type: EventDelete, Key: "a", Old: 5, Cause: "Delete"},
+		{Type: EventDelete, Key: "s", Cause: "Delete"},
+		{Type: EventFlush, Cause: "Flush"},
+	}
+	for i, w := range want {
+		if e := nextEvent(t, ch); e != w {
+			t.Errorf("event %d: got %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func TestCache_Subscribe_Filter(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	ch, cancel := tc.Subscribe("user:*", EventDelete|EventFlush)
+	defer cancel()
+
+	tc.Set("user:1", 1, DefaultExpiration)
+	tc.Set("other", 1, DefaultExpiration)
+	tc.Delete("other")
+	tc.Delete("user:1")
+	tc.Flush()
+
+	if e := nextEvent(t, ch); e.Type != EventDelete || e.Key != "user:1" {
+		t.Error("expected the deletion of user:1, got", e)
+	}
+	if e := nextEvent(t, ch); e.Type != EventFlush {
+		t.Error("flush events should ignore the pattern, got", e)
+	}
+	select {
+	case e := <-ch:
+		t.Error("unexpected event", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCache_Subscribe_Overflow(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	drop, cancelDrop := tc.SubscribeWithOptions("*", EventSet, SubscribeOptions{Buffer: 2})
+	defer cancelDrop()
+	block, cancelBlock := tc.SubscribeWithOptions("*", EventSet, SubscribeOptions{Buffer: 2, Overflow: OverflowBlock})
+	defer cancelBlock()
+
+	const n = 100
+	go func() {
+		for i := 0; i < n; i++ {
+			tc.Set("k"+strconv.Itoa(i), i, DefaultExpiration)
+		}
+	}()
+	for i := 0; i < n; i++ {
+		if e := nextEvent(t, block); e.New != i {
+			t.Fatalf("the blocking subscriber got %v, want %d", e.New, i)
+		}
+	}
+	if len(drop) != 2 {
+		t.Error("the dropping subscriber should have a full buffer, has", len(drop))
+	}
+	cancelDrop()
+	for range drop {
+	}
+}
+
+func TestCache_Subscribe_StalledBlock(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	block, cancelBlock := tc.SubscribeWithOptions("*", EventSet, SubscribeOptions{Buffer: 1, Overflow: OverflowBlock})
+	drop, cancelDrop := tc.SubscribeWithOptions("*", EventSet, SubscribeOptions{Buffer: 10})
+	defer cancelDrop()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			tc.Set("k"+strconv.Itoa(i), i, DefaultExpiration)
+		}
+		close(done)
+	}()
+	// The second Set waits for the stalled subscriber, but the dropping
+	// subscriber has its event already.
+	for i := 0; i < 2; i++ {
+		if e := nextEvent(t, drop); e.New != i {
+			t.Fatalf("the dropping subscriber got %v, want %d", e.New, i)
+		}
+	}
+	select {
+	case <-done:
+		t.Fatal("the writer did not wait for the blocking subscriber")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancelBlock()
+	for range block {
+	}
+	<-done
+	if e := nextEvent(t, drop); e.New != 2 {
+		t.Errorf("the dropping subscriber got %v, want 2", e.New)
+	}
+}
+
+func TestCache_Subscribe_BlockHoldsLocks(t *testing.T) {
+	tc := NewCache(Config{Shards: 2})
+	tc.Set("a", 1, DefaultExpiration)
+	block, cancel := tc.SubscribeWithOptions("*", EventAll, SubscribeOptions{Buffer: 1, Overflow: OverflowBlock})
+	defer cancel()
+
+	// Fill the channel, then Flush waits for the reader with every lock held.
+	tc.Set("b", 1, DefaultExpiration)
+	flushed := make(chan struct{})
+	go func() {
+		tc.Flush()
+		close(flushed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	read := make(chan struct{})
+	go func() {
+		tc.Get("a")
+		close(read)
+	}()
+	select {
+	case <-read:
+		t.Fatal("a read went through while Flush waited for a blocking subscriber")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// A reader calling Get here would deadlock; draining the channel
+	// releases Flush, then the read.
+	nextEvent(t, block)
+	if e := nextEvent(t, block); e.Type != EventFlush {
+		t.Error("want EventFlush, got", e)
+	}
+	<-flushed
+	<-read
+}
+
+func TestCache_Subscribe_Cancel(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	ch, cancel := tc.SubscribeWithOptions("*", EventAll, SubscribeOptions{Buffer: 1, Overflow: OverflowBlock})
+	done := make(chan struct{})
+	go func() {
+		tc.Set("a", 1, DefaultExpiration)
+		tc.Set("b", 1, DefaultExpiration)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	cancel()
+	for range ch {
+	}
+	<-done
+	if tc.watching(EventSet) {
+		t.Error("the cache still publishes events after the last subscriber left")
+	}
+	tc.Set("c", 1, DefaultExpiration)
+}
+
+func TestCache_Subscribe_ExpireEvict(t *testing.T) {
+	tc := NewCache(Config{MaxEntries: 1})
+	ch, cancel := tc.Subscribe("*", EventExpire|EventEvict)
+	defer cancel()
+
+	tc.Set("a", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	tc.DeleteExpired()
+	if e := nextEvent(t, ch); e.Type != EventExpire || e.Key != "a" || e.Old != 1 {
+		t.Error("expected the expiration of a, got", e)
+	}
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Set("c", 3, DefaultExpiration)
+	if e := nextEvent(t, ch); e.Type != EventEvict || e.Key != "b" || e.Old != 2 {
+		t.Error("expected the eviction of b, got", e)
+	}
+}
@@ -0,0 +1,303 @@
+package gocache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Snapshot format: an 8 byte magic, a big-endian uint16 version, the
+// uint64 length of a gob payload, the payload itself and finally the
+// IEEE CRC-32 of the payload.
+const (
+	snapshotMagic   = "GOCACHE\x00"
+	snapshotVersion = 1
+)
+
+var (
+	// ErrBadSnapshot is returned by Load for input that is not a snapshot.
+	ErrBadSnapshot = errors.New("gocache: not a snapshot")
+	// ErrSnapshotChecksum is returned by Load when a snapshot is corrupt.
+	ErrSnapshotChecksum = errors.New("gocache: snapshot checksum mismatch")
+)
+
+// Kinds of values in a snapshot entry.
+const (
+	kindValue uint8 = iota
+	kindHash
+	kindList
+	kindSet
+	kindZSet
+	kindStream
+)
+
+// snapshotEntry is the serialized form of an Item. Hashes and lists are
+// copied out of their live containers so they can be encoded outside the
+// cache lock.
+type snapshotEntry struct {
+	Key        string
+	Expiration int64
+	Kind       uint8
+	Value      any
+	Fields     map[string]any
+	FieldExps  map[string]int64 // hash field expirations
+	Elems      []any            // lists, from left to right
+	Members    []string
+	Scores     []float64 // sorted sets, in order
+	Stream     *streamSnapshot
+}
+
+// streamSnapshot is the serialized form of a stream.
+type streamSnapshot struct {
+	Entries []XMessage
+	LastID  StreamID
+	Groups  []groupSnapshot
+}
+
+type groupSnapshot struct {
+	Name    string
+	LastID  StreamID
+	Pending []pendingSnapshot
+}
+
+type pendingSnapshot struct {
+	ID        StreamID
+	Consumer  string
+	Delivered int64
+	Count     int
+}
+
+func newSnapshotEntry(k string, item Item) snapshotEntry {
+	e := snapshotEntry{Key: k, Expiration: item.Expiration}
+	switch v := item.Object.(type) {
+	case *hash:
+		e.Kind = kindHash
+		e.Fields = make(map[string]any, len(v.fields))
+		for f, fv := range v.fields {
+			e.Fields[f] = fv
+		}
+		if len(v.expires) > 0 {
+			e.FieldExps = make(map[string]int64, len(v.expires))
+			for f, fe := range v.expires {
+				e.FieldExps[f] = fe
+			}
+		}
+	case *deque:
+		e.Kind = kindList
+		e.Elems = v.slice(0, v.Len()-1)
+	case set:
+		e.Kind = kindSet
+		e.Members = v.members()
+		sort.Strings(e.Members)
+	case *zset:
+		e.Kind = kindZSet
+		zs := v.entries()
+		e.Members, e.Scores = zMembers(zs), zScores(zs)
+	case *stream:
+		e.Kind = kindStream
+		e.Stream = v.snapshot()
+	default:
+		e.Value = v
+	}
+	return e
+}
+
+func (e snapshotEntry) item() Item {
+	item := Item{Expiration: e.Expiration}
+	switch e.Kind {
+	case kindHash:
+		h := newHash()
+		for f, fv := range e.Fields {
+			h.fields[f] = fv
+		}
+		for f, fe := range e.FieldExps {
+			h.expire(f, fe)
+		}
+		item.Object = h
+	case kindList:
+		item.Object = newDeque(e.Elems...)
+	case kindSet:
+		st := make(set, len(e.Members))
+		for _, m := range e.Members {
+			st[m] = struct{}{}
+		}
+		item.Object = st
+	case kindZSet:
+		z := newZSet()
+		for i, m := range e.Members {
+			z.set(m, e.Scores[i])
+		}
+		item.Object = z
+	case kindStream:
+		item.Object = e.Stream.stream()
+	default:
+		item.Object = e.Value
+	}
+	return item
+}
+
+// entries copies every unexpired item in the cache, one shard at a time.
+func (c *cache) entries() []snapshotEntry {
+	var out []snapshotEntry
+	now := time.Now().UnixNano()
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k, v := range s.items {
+			if !persisted(v, now) {
+				continue
+			}
+			out = append(out, newSnapshotEntry(k, v))
+		}
+		s.mu.RUnlock()
+	}
+	return out
+}
+
+// persisted reports whether v belongs in snapshots: it has not expired and
+// is not an error cached by MemoizeCtx.
+func persisted(v Item, now int64) bool {
+	if v.Expiration > 0 && now > v.Expiration {
+		return false
+	}
+	return !isCachedError(v)
+}
+
+// Save writes every unexpired item in the cache to w. Values are encoded
+// with encoding/gob, so custom types stored in the cache must be registered
+// with gob.Register first.
+func (c *cache) Save(w io.Writer) error {
+	entries := c.entries()
+	var payload bytes.Buffer
+	enc := gob.NewEncoder(&payload)
+	if err := enc.Encode(len(entries)); err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return fmt.Errorf("gocache: encoding %q: %w", entries[i].Key, err)
+		}
+	}
+
+	var hdr [len(snapshotMagic) + 2 + 8]byte
+	copy(hdr[:], snapshotMagic)
+	binary.BigEndian.PutUint16(hdr[len(snapshotMagic):], snapshotVersion)
+	binary.BigEndian.PutUint64(hdr[len(snapshotMagic)+2:], uint64(payload.Len()))
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(payload.Bytes()))
+	for _, b := range [][]byte{hdr[:], payload.Bytes(), sum[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveFile saves the cache to the named file, replacing it atomically.
+func (c *cache) SaveFile(fname string) error {
+	f, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	bw := bufio.NewWriter(f)
+	if err = c.Save(bw); err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fname)
+}
+
+// readSnapshot reads and verifies a snapshot written by Save.
+func readSnapshot(r io.Reader) ([]snapshotEntry, error) {
+	var hdr [len(snapshotMagic) + 2 + 8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrBadSnapshot
+		}
+		return nil, err
+	}
+	if string(hdr[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrBadSnapshot
+	}
+	if v := binary.BigEndian.Uint16(hdr[len(snapshotMagic):]); v != snapshotVersion {
+		return nil, fmt.Errorf("gocache: unsupported snapshot version %d", v)
+	}
+	n := binary.BigEndian.Uint64(hdr[len(snapshotMagic)+2:])
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, r, int64(n)); err != nil {
+		return nil, ErrSnapshotChecksum
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return nil, ErrSnapshotChecksum
+	}
+	if binary.BigEndian.Uint32(sum[:]) != crc32.ChecksumIEEE(payload.Bytes()) {
+		return nil, ErrSnapshotChecksum
+	}
+
+	dec := gob.NewDecoder(&payload)
+	var count int
+	if err := dec.Decode(&count); err != nil {
+		return nil, err
+	}
+	entries := make([]snapshotEntry, count)
+	for i := range entries {
+		if err := dec.Decode(&entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Load adds the items saved by Save to the cache, excluding items that
+// have expired since and keys that already exist (and haven't expired) in
+// the current cache. Nothing is loaded if the snapshot is corrupt.
+func (c *cache) Load(r io.Reader) error {
+	entries, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	for _, e := range entries {
+		if e.Expiration > 0 && now > e.Expiration {
+			continue
+		}
+		s := c.shardFor(e.Key)
+		s.mu.Lock()
+		var evicted []keyAndValue
+		if _, found := s.get(e.Key); !found {
+			c.log(aofRecord{Op: opRestore, Key: e.Key, Entry: &e})
+			evicted = s.store(e.Key, e.item())
+		}
+		s.mu.Unlock()
+		c.evict(evicted)
+	}
+	return nil
+}
+
+// LoadFile loads the cache from the named file written by SaveFile.
+func (c *cache) LoadFile(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Load(bufio.NewReader(f))
+}
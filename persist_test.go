@@ -0,0 +1,139 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCache_SaveLoad(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.Set("a", "x", DefaultExpiration)
+	tc.Set("b", 2, time.Hour)
+	tc.Set("c", []byte("bytes"), DefaultExpiration)
+	tc.Set("short", 3, 20*time.Millisecond)
+	tc.HSet("h", "f1", "v1")
+	tc.HSet("h", "f2", 2)
+	tc.HExpire("h", time.Hour, "f1")
+	for i := 0; i < 3; i++ {
+		tc.LPush("l", i)
+	}
+	tc.RPush("l", -1)
+	tc.SAdd("s", "x", "y")
+	tc.ZAdd("z", 0, Z{"a", 2}, Z{"b", 1})
+	id, _ := tc.XAdd("x", XAddArgs{Values: map[string]any{"f": "v"}})
+	tc.XGroupCreate("x", "g", MinStreamID, false)
+	tc.XReadGroup(context.Background(), XReadGroupArgs{Group: "g", Consumer: "c", Keys: []string{"x"}, IDs: []StreamID{MaxStreamID}})
+
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(30 * time.Millisecond)
+
+	tc2 := NewCache(Config{Shards: 4})
+	if err := tc2.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if x, found := tc2.Get("a"); !found || x.(string) != "x" {
+		t.Error("a was not restored:", x)
+	}
+	if x, found := tc2.Get("c"); !found || string(x.([]byte)) != "bytes" {
+		t.Error("c was not restored:", x)
+	}
+	if _, found := tc2.Get("short"); found {
+		t.Error("an item that expired while saved was loaded")
+	}
+	if tc2.Items()["b"].Expiration != tc.Items()["b"].Expiration {
+		t.Error("the absolute expiration of b was not kept")
+	}
+	if x, found := tc2.HGet("h", "f2"); !found || x.(int) != 2 {
+		t.Error("hash was not restored:", x)
+	}
+	if d, _, _ := tc2.HTTL("h", "f1"); d == NoExpiration {
+		t.Error("the TTL of a hash field was not restored")
+	}
+	if ok, _ := tc2.SIsMember("s", "y"); !ok {
+		t.Error("set was not restored")
+	}
+	if zs, _ := tc2.ZRange("z", 0, -1); !reflect.DeepEqual(zs, []Z{{"b", 1}, {"a", 2}}) {
+		t.Error("sorted set was not restored:", zs)
+	}
+	if msgs, _ := tc2.XRange("x", MinStreamID, MaxStreamID, 0); !reflect.DeepEqual(msgs, []XMessage{{id, map[string]any{"f": "v"}}}) {
+		t.Error("stream was not restored:", msgs)
+	}
+	if p, _ := tc2.XPending("x", "g"); p.Count != 1 || p.Consumers["c"] != 1 {
+		t.Error("the pending entries of a consumer group were not restored:", p)
+	}
+	for _, want := range []int{2, 1, 0, -1} {
+		if x, found := tc2.LPop("l"); !found || x.(int) != want {
+			t.Errorf("LPop got %v, want %d", x, want)
+		}
+	}
+}
+
+func TestCache_Load_KeepsExisting(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 1, DefaultExpiration)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tc2 := NewCache(DefaultConfig)
+	tc2.Set("a", 2, DefaultExpiration)
+	if err := tc2.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := tc2.Get("a"); x.(int) != 2 {
+		t.Error("Load overwrote an existing key")
+	}
+	if _, found := tc2.Get("b"); !found {
+		t.Error("b was not loaded")
+	}
+}
+
+func TestCache_Load_Corrupt(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.Set("a", "value", DefaultExpiration)
+	var buf bytes.Buffer
+	if err := tc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-6] ^= 0xff
+	tc2 := NewCache(DefaultConfig)
+	if err := tc2.Load(bytes.NewReader(bad)); err != ErrSnapshotChecksum {
+		t.Error("expected ErrSnapshotChecksum, got", err)
+	}
+	if err := tc2.Load(bytes.NewReader(data[:len(data)-2])); err != ErrSnapshotChecksum {
+		t.Error("expected ErrSnapshotChecksum for a truncated snapshot, got", err)
+	}
+	if err := tc2.Load(bytes.NewReader([]byte("not a snapshot at all"))); err != ErrBadSnapshot {
+		t.Error("expected ErrBadSnapshot, got", err)
+	}
+	if tc2.ItemCount() != 0 {
+		t.Error("a corrupt snapshot was partially loaded")
+	}
+}
+
+func TestCache_SaveFile_LoadFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "cache.db")
+	tc := NewCache(DefaultConfig)
+	tc.Set("a", 1.5, DefaultExpiration)
+	if err := tc.SaveFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	tc2 := NewCache(DefaultConfig)
+	if err := tc2.LoadFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	if x, found := tc2.Get("a"); !found || x.(float64) != 1.5 {
+		t.Error("a was not restored:", x)
+	}
+}
@@ -0,0 +1,220 @@
+package gocache
+
+import "sync"
+
+// Message is a message received on a pub/sub subscription.
+type Message struct {
+	Channel string
+	// Pattern is the pattern that matched Channel if the message was
+	// received through PSubscribe, and empty otherwise.
+	Pattern string
+	Payload any
+}
+
+// defaultMessageBuffer is the channel capacity of a pub/sub subscription.
+const defaultMessageBuffer = 128
+
+// pubsub routes published messages to subscriptions. Channels are
+// independent of keys: publishing stores nothing.
+type pubsub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscription]struct{}
+	patterns map[string]map[*Subscription]struct{}
+}
+
+// Subscription receives the messages published on a set of channels and
+// channel patterns, which can change over its lifetime.
+type Subscription struct {
+	ps       *pubsub
+	ch       chan Message
+	channels map[string]struct{} // guarded by ps.mu
+	patterns map[string]struct{} // guarded by ps.mu
+	closed   bool                // guarded by ps.mu
+}
+
+// Publish sends msg to the subscribers of channel and of the patterns
+// matching it, and returns the number of subscriptions it was delivered to.
+// A subscription matching both the channel and a pattern, or several
+// patterns, receives msg once per match. Subscribers whose buffer is full
+// miss the message rather than holding up the publisher.
+func (c *cache) Publish(channel string, msg any) int {
+	ps := &c.pubsub
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	n := 0
+	for sub := range ps.channels[channel] {
+		if sub.send(Message{Channel: channel, Payload: msg}) {
+			n++
+		}
+	}
+	for pattern, subs := range ps.patterns {
+		if !matchGlob(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			if sub.send(Message{Channel: channel, Pattern: pattern, Payload: msg}) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// SubscribeChannels returns a subscription to the messages published on
+// channels. It is named so as not to clash with Subscribe, which reports
+// changes to keys.
+func (c *cache) SubscribeChannels(channels ...string) *Subscription {
+	sub := c.newSubscription()
+	sub.Subscribe(channels...)
+	return sub
+}
+
+// PSubscribe returns a subscription to the messages published on the
+// channels matching patterns, glob-style patterns as understood by Keys.
+func (c *cache) PSubscribe(patterns ...string) *Subscription {
+	sub := c.newSubscription()
+	sub.PSubscribe(patterns...)
+	return sub
+}
+
+func (c *cache) newSubscription() *Subscription {
+	return &Subscription{
+		ps:       &c.pubsub,
+		ch:       make(chan Message, defaultMessageBuffer),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+// send delivers m without blocking. ps.mu must be held.
+func (sub *Subscription) send(m Message) bool {
+	select {
+	case sub.ch <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+// Channel returns the channel on which messages are received. It is closed
+// by Close.
+func (sub *Subscription) Channel() <-chan Message {
+	return sub.ch
+}
+
+// Subscribe adds channels to the subscription.
+func (sub *Subscription) Subscribe(channels ...string) {
+	sub.ps.mu.Lock()
+	defer sub.ps.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	if sub.ps.channels == nil {
+		sub.ps.channels = make(map[string]map[*Subscription]struct{})
+	}
+	for _, ch := range channels {
+		addSubscription(sub.ps.channels, ch, sub)
+		sub.channels[ch] = struct{}{}
+	}
+}
+
+// PSubscribe adds patterns to the subscription.
+func (sub *Subscription) PSubscribe(patterns ...string) {
+	sub.ps.mu.Lock()
+	defer sub.ps.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	if sub.ps.patterns == nil {
+		sub.ps.patterns = make(map[string]map[*Subscription]struct{})
+	}
+	for _, p := range patterns {
+		addSubscription(sub.ps.patterns, p, sub)
+		sub.patterns[p] = struct{}{}
+	}
+}
+
+// Unsubscribe removes channels from the subscription, or every channel if
+// none are given. Patterns are left alone.
+func (sub *Subscription) Unsubscribe(channels ...string) {
+	sub.ps.mu.Lock()
+	defer sub.ps.mu.Unlock()
+	removeSubscriptions(sub.ps.channels, sub.channels, channels, sub)
+}
+
+// PUnsubscribe removes patterns from the subscription, or every pattern if
+// none are given.
+func (sub *Subscription) PUnsubscribe(patterns ...string) {
+	sub.ps.mu.Lock()
+	defer sub.ps.mu.Unlock()
+	removeSubscriptions(sub.ps.patterns, sub.patterns, patterns, sub)
+}
+
+// Count returns the number of channels and patterns subscribed to.
+func (sub *Subscription) Count() int {
+	sub.ps.mu.RLock()
+	defer sub.ps.mu.RUnlock()
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// Channels returns the channels subscribed to, in no particular order.
+func (sub *Subscription) Channels() []string {
+	sub.ps.mu.RLock()
+	defer sub.ps.mu.RUnlock()
+	return setKeys(sub.channels)
+}
+
+// Patterns returns the patterns subscribed to, in no particular order.
+func (sub *Subscription) Patterns() []string {
+	sub.ps.mu.RLock()
+	defer sub.ps.mu.RUnlock()
+	return setKeys(sub.patterns)
+}
+
+func setKeys(m map[string]struct{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Close removes every channel and pattern from the subscription and closes
+// the message channel. The subscription cannot be used afterwards.
+func (sub *Subscription) Close() {
+	sub.ps.mu.Lock()
+	defer sub.ps.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	removeSubscriptions(sub.ps.channels, sub.channels, nil, sub)
+	removeSubscriptions(sub.ps.patterns, sub.patterns, nil, sub)
+	sub.closed = true
+	close(sub.ch)
+}
+
+func addSubscription(m map[string]map[*Subscription]struct{}, name string, sub *Subscription) {
+	subs := m[name]
+	if subs == nil {
+		subs = make(map[*Subscription]struct{})
+		m[name] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+// removeSubscriptions removes names, or all of own if names is empty, from
+// own and unregisters sub from them in m.
+func removeSubscriptions(m map[string]map[*Subscription]struct{}, own map[string]struct{}, names []string, sub *Subscription) {
+	if len(names) == 0 {
+		names = setKeys(own)
+	}
+	for _, name := range names {
+		delete(own, name)
+		if subs := m[name]; subs != nil {
+			delete(subs, sub)
+			if len(subs) == 0 {
+				delete(m, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package gocache
+
+import (
+	"testing"
+	"time"
+)
+
+func nextMessage(t *testing.T, sub *Subscription) Message {
+	t.Helper()
+	select {
+	case m, ok := <-sub.Channel():
+		if !ok {
+			t.Fatal("the message channel was closed")
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+	}
+	return Message{}
+}
+
+func TestCache_Publish(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	sub := tc.SubscribeChannels("news", "sport")
+	defer sub.Close()
+	psub := tc.PSubscribe("n*")
+	defer psub.Close()
+
+	if n := tc.Publish("news", "hello"); n != 2 {
+		t.Error("Publish should reach 2 subscriptions, reached", n)
+	}
+	if m := nextMessage(t, sub); m != (Message{Channel: "news", Payload: "hello"}) {
+		t.Error("unexpected message", m)
+	}
+	if m := nextMessage(t, psub); m != (Message{Channel: "news", Pattern: "n*", Payload: "hello"}) {
+		t.Error("unexpected pattern message", m)
+	}
+	if n := tc.Publish("weather", 1); n != 0 {
+		t.Error("Publish to a channel without subscribers reached", n)
+	}
+	if _, found := tc.Get("news"); found {
+		t.Error("Publish stored a key")
+	}
+
+	sub.PSubscribe("s*")
+	if n := sub.Count(); n != 3 {
+		t.Error("Count:", n)
+	}
+	if n := tc.Publish("sport", 2); n != 2 {
+		t.Error("a channel and a pattern match should deliver twice, got", n)
+	}
+	nextMessage(t, sub)
+	nextMessage(t, sub)
+
+	sub.Unsubscribe()
+	if n := sub.Count(); n != 1 {
+		t.Error("Unsubscribe should keep the patterns, Count:", n)
+	}
+	if n := tc.Publish("news", "x"); n != 1 {
+		t.Error("Publish after Unsubscribe reached", n)
+	}
+	sub.PUnsubscribe("s*")
+	if n := tc.Publish("sport", "x"); n != 0 {
+		t.Error("Publish after PUnsubscribe reached", n)
+	}
+}
+
+func TestCache_Publish_SlowSubscriber(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	sub := tc.SubscribeChannels("c")
+	for i := 0; i < defaultMessageBuffer; i++ {
+		tc.Publish("c", i)
+	}
+	if n := tc.Publish("c", "dropped"); n != 0 {
+		t.Error("a full subscription should miss messages, got", n)
+	}
+	sub.Close()
+	sub.Close()
+	n := 0
+	for range sub.Channel() {
+		n++
+	}
+	if n != defaultMessageBuffer {
+		t.Error("expected the buffered messages before the channel closed, got", n)
+	}
+	if n := tc.Publish("c", "x"); n != 0 {
+		t.Error("Publish reached a closed subscription")
+	}
+}
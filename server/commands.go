@@ -0,0 +1,723 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+const (
+	errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	errNotInt    = "ERR value is not an integer or out of range"
+	errSyntax    = "ERR syntax error"
+	errNotFloat  = "ERR value is not a valid float"
+)
+
+// command describes a RESP command. As in Redis, a positive arity is the
+// exact number of arguments including the command name, and a negative one
+// is the minimum.
+type command struct {
+	fn    func(c *conn, args [][]byte)
+	arity int
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":             {cmdPing, -1},
+		"echo":             {cmdEcho, 2},
+		"quit":             {cmdQuit, 1},
+		"hello":            {cmdHello, -1},
+		"select":           {cmdSelect, 2},
+		"command":          {cmdCommand, -1},
+		"get":              {cmdGet, 2},
+		"set":              {cmdSet, -3},
+		"setnx":            {cmdSetNX, 3},
+		"getset":           {cmdGetSet, 3},
+		"getdel":           {cmdGetDel, 2},
+		"getex":            {cmdGetEx, -2},
+		"mset":             {cmdMSet, -3},
+		"msetnx":           {cmdMSetNX, -3},
+		"mget":             {cmdMGet, -2},
+		"append":           {cmdAppend, 3},
+		"strlen":           {cmdStrLen, 2},
+		"getrange":         {cmdGetRange, 4},
+		"setrange":         {cmdSetRange, 4},
+		"incrbyfloat":      {cmdIncrByFloat, 3},
+		"del":              {cmdDel, -2},
+		"exists":           {cmdExists, -2},
+		"incr":             {cmdIncr, 2},
+		"decr":             {cmdDecr, 2},
+		"incrby":           {cmdIncrBy, 3},
+		"decrby":           {cmdDecrBy, 3},
+		"hset":             {cmdHSet, -4},
+		"hget":             {cmdHGet, 3},
+		"hgetall":          {cmdHGetAll, 2},
+		"hdel":             {cmdHDel, -3},
+		"hmset":            {cmdHMSet, -4},
+		"hmget":            {cmdHMGet, -3},
+		"hsetnx":           {cmdHSetNX, 4},
+		"hincrby":          {cmdHIncrBy, 4},
+		"hincrbyfloat":     {cmdHIncrByFloat, 4},
+		"hexists":          {cmdHExists, 3},
+		"hlen":             {cmdHLen, 2},
+		"hkeys":            {cmdHKeys, 2},
+		"hvals":            {cmdHVals, 2},
+		"hscan":            {cmdHScan, -3},
+		"hexpire":          {cmdHExpire, -6},
+		"hpexpire":         {cmdHPExpire, -6},
+		"hpersist":         {cmdHPersist, -5},
+		"httl":             {cmdHTTL, -5},
+		"hpttl":            {cmdHPTTL, -5},
+		"lpush":            {cmdLPush, -3},
+		"rpush":            {cmdRPush, -3},
+		"lpop":             {cmdLPop, 2},
+		"rpop":             {cmdRPop, 2},
+		"llen":             {cmdLLen, 2},
+		"lrange":           {cmdLRange, 4},
+		"lindex":           {cmdLIndex, 3},
+		"lset":             {cmdLSet, 4},
+		"linsert":          {cmdLInsert, 5},
+		"lrem":             {cmdLRem, 4},
+		"ltrim":            {cmdLTrim, 4},
+		"lpos":             {cmdLPos, -3},
+		"lmove":            {cmdLMove, 5},
+		"rpoplpush":        {cmdRPopLPush, 3},
+		"blpop":            {cmdBLPop, -3},
+		"brpop":            {cmdBRPop, -3},
+		"blmove":           {cmdBLMove, 6},
+		"brpoplpush":       {cmdBRPopLPush, 4},
+		"sadd":             {cmdSAdd, -3},
+		"srem":             {cmdSRem, -3},
+		"sismember":        {cmdSIsMember, 3},
+		"smembers":         {cmdSMembers, 2},
+		"scard":            {cmdSCard, 2},
+		"spop":             {cmdSPop, -2},
+		"srandmember":      {cmdSRandMember, -2},
+		"smove":            {cmdSMove, 4},
+		"sinter":           {cmdSInter, -2},
+		"sunion":           {cmdSUnion, -2},
+		"sdiff":            {cmdSDiff, -2},
+		"sinterstore":      {cmdSInterStore, -3},
+		"sunionstore":      {cmdSUnionStore, -3},
+		"sdiffstore":       {cmdSDiffStore, -3},
+		"zadd":             {cmdZAdd, -4},
+		"zincrby":          {cmdZIncrBy, 4},
+		"zrem":             {cmdZRem, -3},
+		"zscore":           {cmdZScore, 3},
+		"zcard":            {cmdZCard, 2},
+		"zrank":            {cmdZRank, 3},
+		"zrevrank":         {cmdZRevRank, 3},
+		"zrange":           {cmdZRange, -4},
+		"zrevrange":        {cmdZRevRange, -4},
+		"zrangebyscore":    {cmdZRangeByScore, -4},
+		"zrevrangebyscore": {cmdZRevRangeByScore, -4},
+		"zrangebylex":      {cmdZRangeByLex, -4},
+		"zcount":           {cmdZCount, 4},
+		"zpopmin":          {cmdZPopMin, -2},
+		"zpopmax":          {cmdZPopMax, -2},
+		"zremrangebyscore": {cmdZRemRangeByScore, 4},
+		"expire":           {cmdExpire, 3},
+		"pexpire":          {cmdPExpire, 3},
+		"ttl":              {cmdTTL, 2},
+		"pttl":             {cmdPTTL, 2},
+		"flushall":         {cmdFlushAll, -1},
+		"flushdb":          {cmdFlushAll, -1},
+		"dbsize":           {cmdDBSize, 1},
+		"keys":             {cmdKeys, 2},
+		"xadd":             {cmdXAdd, -5},
+		"xlen":             {cmdXLen, 2},
+		"xrange":           {cmdXRange, -4},
+		"xrevrange":        {cmdXRevRange, -4},
+		"xread":            {cmdXRead, -4},
+		"xgroup":           {cmdXGroup, -2},
+		"xreadgroup":       {cmdXReadGroup, -7},
+		"xack":             {cmdXAck, -4},
+		"xpending":         {cmdXPending, -3},
+		"xclaim":           {cmdXClaim, -6},
+		"publish":          {cmdPublish, 3},
+		"subscribe":        {cmdSubscribe, -2},
+		"psubscribe":       {cmdPSubscribe, -2},
+		"unsubscribe":      {cmdUnsubscribe, -1},
+		"punsubscribe":     {cmdPUnsubscribe, -1},
+		"multi":            {cmdMulti, 1},
+		"exec":             {cmdExec, 1},
+		"discard":          {cmdDiscard, 1},
+		"watch":            {cmdWatch, -2},
+		"unwatch":          {cmdUnwatch, 1},
+	}
+}
+
+func (c *conn) cache() *gocache.Cache {
+	return c.srv.cache
+}
+
+// writeErr reports an error returned by the cache.
+func (c *conn) writeErr(err error) {
+	switch {
+	case errors.Is(err, gocache.ErrWrongType):
+		c.w.writeError(errWrongType)
+	case errors.Is(err, gocache.ErrNotInteger):
+		c.w.writeError(errNotInt)
+	case errors.Is(err, gocache.ErrNotFloat):
+		c.w.writeError(errNotFloat)
+	case errors.Is(err, gocache.ErrOutOfRange):
+		c.w.writeError("ERR offset is out of range")
+	case errors.Is(err, gocache.ErrNoGroup):
+		c.w.writeError("NOGROUP No such key or consumer group")
+	case errors.Is(err, gocache.ErrGroupExists):
+		c.w.writeError("BUSYGROUP Consumer Group name already exists")
+	default:
+		c.w.writeError("ERR " + err.Error())
+	}
+}
+
+func parseInt(b []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	return n, err == nil
+}
+
+func strs(args [][]byte) []string {
+	s := make([]string, len(args))
+	for i, a := range args {
+		s[i] = string(a)
+	}
+	return s
+}
+
+func cmdPing(c *conn, args [][]byte) {
+	if c.w.proto < 3 && c.subscribed() && len(args) <= 2 {
+		// Replies share the connection with messages.
+		c.w.writeArray(2)
+		c.w.writeBulkString("pong")
+		if len(args) == 2 {
+			c.w.writeBulk(args[1])
+		} else {
+			c.w.writeBulkString("")
+		}
+		return
+	}
+	switch len(args) {
+	case 1:
+		c.w.writeSimple("PONG")
+	case 2:
+		c.w.writeBulk(args[1])
+	default:
+		c.w.writeError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func cmdEcho(c *conn, args [][]byte) {
+	c.w.writeBulk(args[1])
+}
+
+func cmdQuit(c *conn, args [][]byte) {
+	c.w.writeOK()
+	c.quit = true
+}
+
+func cmdHello(c *conn, args [][]byte) {
+	if len(args) > 1 {
+		proto, ok := parseInt(args[1])
+		if !ok || proto < 2 || proto > 3 {
+			c.w.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+		c.w.proto = int(proto)
+	}
+	c.w.writeMap(3)
+	c.w.writeBulkString("server")
+	c.w.writeBulkString("gocache")
+	c.w.writeBulkString("proto")
+	c.w.writeInt(int64(c.w.proto))
+	c.w.writeBulkString("mode")
+	c.w.writeBulkString("standalone")
+}
+
+func cmdSelect(c *conn, args [][]byte) {
+	if string(args[1]) != "0" {
+		c.w.writeError("ERR DB index is out of range")
+		return
+	}
+	c.w.writeOK()
+}
+
+func cmdCommand(c *conn, args [][]byte) {
+	c.w.writeArray(0)
+}
+
+func cmdGet(c *conn, args [][]byte) {
+	v, found := c.cache().Get(string(args[1]))
+	if !found {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeValue(v)
+}
+
+// SET key value [EX seconds|PX milliseconds] [NX|XX]
+func cmdSet(c *conn, args [][]byte) {
+	k, v := string(args[1]), string(args[2])
+	d := gocache.DefaultExpiration
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if i+1 >= len(args) {
+				c.w.writeError(errSyntax)
+				return
+			}
+			i++
+			n, ok := parseInt(args[i])
+			if !ok {
+				c.w.writeError(errNotInt)
+				return
+			}
+			if n <= 0 {
+				c.w.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			if opt == "ex" {
+				d = time.Duration(n) * time.Second
+			} else {
+				d = time.Duration(n) * time.Millisecond
+			}
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+	switch {
+	case nx && xx:
+		c.w.writeError(errSyntax)
+	case nx:
+		if c.cache().SetNX(k, v, d) {
+			c.w.writeOK()
+		} else {
+			c.w.writeNull()
+		}
+	case xx:
+		if c.cache().SetXX(k, v, d) {
+			c.w.writeOK()
+		} else {
+			c.w.writeNull()
+		}
+	default:
+		c.cache().Set(k, v, d)
+		c.w.writeOK()
+	}
+}
+
+func cmdDel(c *conn, args [][]byte) {
+	var n int64
+	for _, k := range args[1:] {
+		if _, found := c.cache().GetDel(string(k)); found {
+			n++
+		}
+	}
+	c.w.writeInt(n)
+}
+
+func cmdSetNX(c *conn, args [][]byte) {
+	c.w.writeBool(c.cache().SetNX(string(args[1]), string(args[2]), gocache.DefaultExpiration))
+}
+
+func cmdGetSet(c *conn, args [][]byte) {
+	v, found := c.cache().GetSet(string(args[1]), string(args[2]), gocache.DefaultExpiration)
+	if !found {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeValue(v)
+}
+
+func cmdGetDel(c *conn, args [][]byte) {
+	v, found := c.cache().GetDel(string(args[1]))
+	if !found {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeValue(v)
+}
+
+// GETEX key [EX seconds|PX milliseconds|PERSIST]
+func cmdGetEx(c *conn, args [][]byte) {
+	k := string(args[1])
+	if len(args) == 2 {
+		cmdGet(c, args)
+		return
+	}
+	var d time.Duration
+	switch opt := strings.ToLower(string(args[2])); {
+	case opt == "persist" && len(args) == 3:
+		d = gocache.NoExpiration
+	case (opt == "ex" || opt == "px") && len(args) == 4:
+		n, ok := parseInt(args[3])
+		if !ok {
+			c.w.writeError(errNotInt)
+			return
+		}
+		if n <= 0 {
+			c.w.writeError("ERR invalid expire time in 'getex' command")
+			return
+		}
+		if opt == "ex" {
+			d = time.Duration(n) * time.Second
+		} else {
+			d = time.Duration(n) * time.Millisecond
+		}
+	default:
+		c.w.writeError(errSyntax)
+		return
+	}
+	v, found := c.cache().GetEx(k, d)
+	if !found {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeValue(v)
+}
+
+// pairs parses the key value arguments of MSET and MSETNX.
+func (c *conn) pairs(args [][]byte) (map[string]any, bool) {
+	if len(args)%2 != 1 {
+		c.w.writeError("ERR wrong number of arguments for '" + strings.ToLower(string(args[0])) + "' command")
+		return nil, false
+	}
+	items := make(map[string]any, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		items[string(args[i])] = string(args[i+1])
+	}
+	return items, true
+}
+
+func cmdMSet(c *conn, args [][]byte) {
+	if items, ok := c.pairs(args); ok {
+		c.cache().MSet(items, gocache.DefaultExpiration)
+		c.w.writeOK()
+	}
+}
+
+func cmdMSetNX(c *conn, args [][]byte) {
+	if items, ok := c.pairs(args); ok {
+		c.w.writeBool(c.cache().MSetNX(items, gocache.DefaultExpiration))
+	}
+}
+
+func cmdMGet(c *conn, args [][]byte) {
+	values := c.cache().MGet(strs(args[1:])...)
+	c.w.writeArray(len(values))
+	for _, v := range values {
+		if b, ok := formatValue(v); ok {
+			c.w.writeBulk(b)
+		} else {
+			c.w.writeNull()
+		}
+	}
+}
+
+func cmdAppend(c *conn, args [][]byte) {
+	n, err := c.cache().Append(string(args[1]), string(args[2]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeInt(int64(n))
+}
+
+func cmdStrLen(c *conn, args [][]byte) {
+	n, err := c.cache().StrLen(string(args[1]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeInt(int64(n))
+}
+
+func cmdGetRange(c *conn, args [][]byte) {
+	start, ok1 := parseInt(args[2])
+	end, ok2 := parseInt(args[3])
+	if !ok1 || !ok2 {
+		c.w.writeError(errNotInt)
+		return
+	}
+	s, err := c.cache().GetRange(string(args[1]), int(start), int(end))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeBulkString(s)
+}
+
+func cmdSetRange(c *conn, args [][]byte) {
+	offset, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	if offset < 0 || offset > math.MaxInt32 {
+		c.writeErr(gocache.ErrOutOfRange)
+		return
+	}
+	n, err := c.cache().SetRange(string(args[1]), int(offset), string(args[3]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeInt(int64(n))
+}
+
+func cmdIncrByFloat(c *conn, args [][]byte) {
+	f, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil {
+		c.w.writeError(errNotFloat)
+		return
+	}
+	r, err := c.cache().IncrByFloat(string(args[1]), f)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeBulkString(strconv.FormatFloat(r, 'f', -1, 64))
+}
+
+func cmdExists(c *conn, args [][]byte) {
+	var n int64
+	for _, k := range args[1:] {
+		if _, found := c.cache().Get(string(k)); found {
+			n++
+		}
+	}
+	c.w.writeInt(n)
+}
+
+func (c *conn) incrBy(k []byte, n int64) {
+	r, err := c.cache().IncrBy(string(k), n)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeInt(r)
+}
+
+func cmdIncr(c *conn, args [][]byte) {
+	c.incrBy(args[1], 1)
+}
+
+func cmdDecr(c *conn, args [][]byte) {
+	c.incrBy(args[1], -1)
+}
+
+func cmdIncrBy(c *conn, args [][]byte) {
+	n, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	c.incrBy(args[1], n)
+}
+
+func cmdDecrBy(c *conn, args [][]byte) {
+	n, ok := parseInt(args[2])
+	if !ok || n == math.MinInt64 {
+		c.w.writeError(errNotInt)
+		return
+	}
+	c.incrBy(args[1], -n)
+}
+
+func (c *conn) intReply(n int, err error) {
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeInt(int64(n))
+}
+
+func (c *conn) stringsReply(s []string, err error) {
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeStrings(s)
+}
+
+func cmdSAdd(c *conn, args [][]byte) {
+	c.intReply(c.cache().SAdd(string(args[1]), strs(args[2:])...))
+}
+
+func cmdSRem(c *conn, args [][]byte) {
+	c.intReply(c.cache().SRem(string(args[1]), strs(args[2:])...))
+}
+
+func cmdSIsMember(c *conn, args [][]byte) {
+	ok, err := c.cache().SIsMember(string(args[1]), string(args[2]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeBool(ok)
+}
+
+func cmdSMembers(c *conn, args [][]byte) {
+	c.stringsReply(c.cache().SMembers(string(args[1])))
+}
+
+func cmdSCard(c *conn, args [][]byte) {
+	c.intReply(c.cache().SCard(string(args[1])))
+}
+
+// SPOP key [count]
+func cmdSPop(c *conn, args [][]byte) {
+	switch len(args) {
+	case 2:
+		m, err := c.cache().SPop(string(args[1]), 1)
+		if err != nil {
+			c.writeErr(err)
+		} else if len(m) == 0 {
+			c.w.writeNull()
+		} else {
+			c.w.writeBulkString(m[0])
+		}
+	case 3:
+		n, ok := parseInt(args[2])
+		if !ok || n < 0 {
+			c.w.writeError("ERR value is out of range, must be positive")
+			return
+		}
+		c.stringsReply(c.cache().SPop(string(args[1]), int(n)))
+	default:
+		c.w.writeError(errSyntax)
+	}
+}
+
+// SRANDMEMBER key [count]
+func cmdSRandMember(c *conn, args [][]byte) {
+	switch len(args) {
+	case 2:
+		m, err := c.cache().SRandMember(string(args[1]), 1)
+		if err != nil {
+			c.writeErr(err)
+		} else if len(m) == 0 {
+			c.w.writeNull()
+		} else {
+			c.w.writeBulkString(m[0])
+		}
+	case 3:
+		n, ok := parseInt(args[2])
+		if !ok || n < math.MinInt32 || n > math.MaxInt32 {
+			c.w.writeError(errNotInt)
+			return
+		}
+		c.stringsReply(c.cache().SRandMember(string(args[1]), int(n)))
+	default:
+		c.w.writeError(errSyntax)
+	}
+}
+
+func cmdSMove(c *conn, args [][]byte) {
+	ok, err := c.cache().SMove(string(args[1]), string(args[2]), string(args[3]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeBool(ok)
+}
+
+func cmdSInter(c *conn, args [][]byte) {
+	c.stringsReply(c.cache().SInter(strs(args[1:])...))
+}
+
+func cmdSUnion(c *conn, args [][]byte) {
+	c.stringsReply(c.cache().SUnion(strs(args[1:])...))
+}
+
+func cmdSDiff(c *conn, args [][]byte) {
+	c.stringsReply(c.cache().SDiff(strs(args[1:])...))
+}
+
+func cmdSInterStore(c *conn, args [][]byte) {
+	c.intReply(c.cache().SInterStore(string(args[1]), strs(args[2:])...))
+}
+
+func cmdSUnionStore(c *conn, args [][]byte) {
+	c.intReply(c.cache().SUnionStore(string(args[1]), strs(args[2:])...))
+}
+
+func cmdSDiffStore(c *conn, args [][]byte) {
+	c.intReply(c.cache().SDiffStore(string(args[1]), strs(args[2:])...))
+}
+
+func (c *conn) expire(k string, d time.Duration) {
+	if _, found := c.cache().TTL(k); !found {
+		c.w.writeInt(0)
+		return
+	}
+	if d <= 0 {
+		c.cache().Delete(k)
+	} else {
+		c.cache().SetExpiration(k, d)
+	}
+	c.w.writeInt(1)
+}
+
+func cmdExpire(c *conn, args [][]byte) {
+	n, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	c.expire(string(args[1]), time.Duration(n)*time.Second)
+}
+
+func cmdPExpire(c *conn, args [][]byte) {
+	n, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	c.expire(string(args[1]), time.Duration(n)*time.Millisecond)
+}
+
+func (c *conn) ttl(k string, unit time.Duration) {
+	d, found := c.cache().TTL(k)
+	switch {
+	case !found:
+		c.w.writeInt(-2)
+	case d == gocache.NoExpiration:
+		c.w.writeInt(-1)
+	default:
+		// Round up, as Redis does, so a live key never reports 0.
+		c.w.writeInt(int64((d + unit - 1) / unit))
+	}
+}
+
+func cmdTTL(c *conn, args [][]byte) {
+	c.ttl(string(args[1]), time.Second)
+}
+
+func cmdPTTL(c *conn, args [][]byte) {
+	c.ttl(string(args[1]), time.Millisecond)
+}
+
+func cmdFlushAll(c *conn, args [][]byte) {
+	c.cache().Flush()
+	c.w.writeOK()
+}
+
+func cmdDBSize(c *conn, args [][]byte) {
+	c.w.writeInt(int64(c.cache().ItemCount()))
+}
+
+func cmdKeys(c *conn, args [][]byte) {
+	c.w.writeStrings(c.cache().Keys(string(args[1])))
+}
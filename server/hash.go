@@ -0,0 +1,320 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+// checkHash reports a WRONGTYPE error if k holds something other than a
+// hash. HSet replaces such values and HGet ignores them, which Redis clients
+// do not expect.
+func (c *conn) checkHash(k []byte) bool {
+	if _, err := c.cache().HLen(string(k)); err != nil {
+		c.writeErr(err)
+		return false
+	}
+	return true
+}
+
+// HSET key field value [field value ...]
+func cmdHSet(c *conn, args [][]byte) {
+	if len(args)%2 != 0 {
+		c.w.writeError("ERR wrong number of arguments for 'hset' command")
+		return
+	}
+	if !c.checkHash(args[1]) {
+		return
+	}
+	k := string(args[1])
+	var added int64
+	for i := 2; i < len(args); i += 2 {
+		f := string(args[i])
+		if _, found := c.cache().HGet(k, f); !found {
+			added++
+		}
+		c.cache().HSet(k, f, string(args[i+1]))
+	}
+	c.w.writeInt(added)
+}
+
+// HMSET key field value [field value ...]
+func cmdHMSet(c *conn, args [][]byte) {
+	if len(args)%2 != 0 {
+		c.w.writeError("ERR wrong number of arguments for 'hmset' command")
+		return
+	}
+	fields := make(map[string]any, len(args)/2-1)
+	for i := 2; i < len(args); i += 2 {
+		fields[string(args[i])] = string(args[i+1])
+	}
+	if err := c.cache().HMSet(string(args[1]), fields); err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeOK()
+}
+
+func cmdHGet(c *conn, args [][]byte) {
+	if !c.checkHash(args[1]) {
+		return
+	}
+	v, found := c.cache().HGet(string(args[1]), string(args[2]))
+	if !found {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeValue(v)
+}
+
+func cmdHMGet(c *conn, args [][]byte) {
+	vals, err := c.cache().HMGet(string(args[1]), strs(args[2:])...)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeArray(len(vals))
+	for _, v := range vals {
+		if v == nil {
+			c.w.writeNull()
+		} else {
+			c.w.writeValue(v)
+		}
+	}
+}
+
+func cmdHGetAll(c *conn, args [][]byte) {
+	if !c.checkHash(args[1]) {
+		return
+	}
+	m, _ := c.cache().HGetAll(string(args[1]))
+	c.w.writeMap(len(m))
+	for f, v := range m {
+		c.w.writeBulkString(f)
+		b, _ := formatValue(v)
+		c.w.writeBulk(b)
+	}
+}
+
+func cmdHDel(c *conn, args [][]byte) {
+	if !c.checkHash(args[1]) {
+		return
+	}
+	var n int64
+	for _, f := range args[2:] {
+		if c.cache().HDel(string(args[1]), string(f)) {
+			n++
+		}
+	}
+	c.w.writeInt(n)
+}
+
+func cmdHSetNX(c *conn, args [][]byte) {
+	ok, err := c.cache().HSetNX(string(args[1]), string(args[2]), string(args[3]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeBool(ok)
+}
+
+func cmdHIncrBy(c *conn, args [][]byte) {
+	n, ok := parseInt(args[3])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	r, err := c.cache().HIncrBy(string(args[1]), string(args[2]), n)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeInt(r)
+}
+
+func cmdHIncrByFloat(c *conn, args [][]byte) {
+	f, err := strconv.ParseFloat(string(args[3]), 64)
+	if err != nil {
+		c.w.writeError(errNotFloat)
+		return
+	}
+	r, err := c.cache().HIncrByFloat(string(args[1]), string(args[2]), f)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeBulkString(strconv.FormatFloat(r, 'f', -1, 64))
+}
+
+func cmdHExists(c *conn, args [][]byte) {
+	ok, err := c.cache().HExists(string(args[1]), string(args[2]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeBool(ok)
+}
+
+func cmdHLen(c *conn, args [][]byte) {
+	c.intReply(c.cache().HLen(string(args[1])))
+}
+
+func cmdHKeys(c *conn, args [][]byte) {
+	c.stringsReply(c.cache().HKeys(string(args[1])))
+}
+
+func cmdHVals(c *conn, args [][]byte) {
+	vals, err := c.cache().HVals(string(args[1]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeArray(len(vals))
+	for _, v := range vals {
+		b, _ := formatValue(v)
+		c.w.writeBulk(b)
+	}
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count]
+func cmdHScan(c *conn, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.writeError("ERR invalid cursor")
+		return
+	}
+	var match string
+	var count int
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.w.writeError(errSyntax)
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			match = string(args[i+1])
+		case "count":
+			n, ok := parseInt(args[i+1])
+			if !ok {
+				c.w.writeError(errNotInt)
+				return
+			}
+			if n < 1 {
+				c.w.writeError(errSyntax)
+				return
+			}
+			count = int(clampInt(n))
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+	m, next, err := c.cache().HScan(string(args[1]), cursor, match, count)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeArray(2)
+	c.w.writeBulkString(strconv.FormatUint(next, 10))
+	c.w.writeArray(2 * len(m))
+	for f, v := range m {
+		c.w.writeBulkString(f)
+		b, _ := formatValue(v)
+		c.w.writeBulk(b)
+	}
+}
+
+// parseFields parses the FIELDS numfields field [field ...] arguments of the
+// hash field expiration commands.
+func (c *conn) parseFields(args [][]byte) ([]string, bool) {
+	if strings.ToLower(string(args[0])) != "fields" {
+		c.w.writeError(errSyntax)
+		return nil, false
+	}
+	n, ok := parseInt(args[1])
+	if !ok || n <= 0 {
+		c.w.writeError("ERR Parameter `numFields` should be greater than 0")
+		return nil, false
+	}
+	if n != int64(len(args)-2) {
+		c.w.writeError("ERR The `numfields` parameter must match the number of arguments")
+		return nil, false
+	}
+	return strs(args[2:]), true
+}
+
+// HEXPIRE key seconds FIELDS numfields field [field ...]
+func cmdHExpire(c *conn, args [][]byte) {
+	c.hexpire(args, time.Second)
+}
+
+// HPEXPIRE key milliseconds FIELDS numfields field [field ...]
+func cmdHPExpire(c *conn, args [][]byte) {
+	c.hexpire(args, time.Millisecond)
+}
+
+func (c *conn) hexpire(args [][]byte, unit time.Duration) {
+	n, ok := parseInt(args[2])
+	if !ok || n < 0 {
+		c.w.writeError(errNotInt)
+		return
+	}
+	fields, ok := c.parseFields(args[3:])
+	if !ok {
+		return
+	}
+	codes, err := c.cache().HExpire(string(args[1]), time.Duration(n)*unit, fields...)
+	c.codesReply(codes, err)
+}
+
+// HPERSIST key FIELDS numfields field [field ...]
+func cmdHPersist(c *conn, args [][]byte) {
+	fields, ok := c.parseFields(args[2:])
+	if !ok {
+		return
+	}
+	codes, err := c.cache().HPersist(string(args[1]), fields...)
+	c.codesReply(codes, err)
+}
+
+func (c *conn) codesReply(codes []int, err error) {
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeArray(len(codes))
+	for _, n := range codes {
+		c.w.writeInt(int64(n))
+	}
+}
+
+// HTTL key FIELDS numfields field [field ...]
+func cmdHTTL(c *conn, args [][]byte) {
+	c.httl(args, time.Second)
+}
+
+// HPTTL key FIELDS numfields field [field ...]
+func cmdHPTTL(c *conn, args [][]byte) {
+	c.httl(args, time.Millisecond)
+}
+
+func (c *conn) httl(args [][]byte, unit time.Duration) {
+	fields, ok := c.parseFields(args[2:])
+	if !ok || !c.checkHash(args[1]) {
+		return
+	}
+	c.w.writeArray(len(fields))
+	for _, f := range fields {
+		d, found, _ := c.cache().HTTL(string(args[1]), f)
+		switch {
+		case !found:
+			c.w.writeInt(-2)
+		case d == gocache.NoExpiration:
+			c.w.writeInt(-1)
+		default:
+			c.w.writeInt(int64((d + unit - 1) / unit))
+		}
+	}
+}
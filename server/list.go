@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+// checkList reports a WRONGTYPE error if k holds something other than a
+// list. LPush and RPush replace such values, which Redis clients do not
+// expect.
+func (c *conn) checkList(k []byte) bool {
+	if _, err := c.cache().LLen(string(k)); err != nil {
+		c.writeErr(err)
+		return false
+	}
+	return true
+}
+
+func cmdLPush(c *conn, args [][]byte) {
+	if !c.checkList(args[1]) {
+		return
+	}
+	var n int
+	for _, v := range args[2:] {
+		n = c.cache().LPush(string(args[1]), string(v))
+	}
+	c.w.writeInt(int64(n))
+}
+
+func cmdRPush(c *conn, args [][]byte) {
+	if !c.checkList(args[1]) {
+		return
+	}
+	var n int
+	for _, v := range args[2:] {
+		n = c.cache().RPush(string(args[1]), string(v))
+	}
+	c.w.writeInt(int64(n))
+}
+
+func cmdLPop(c *conn, args [][]byte) {
+	if !c.checkList(args[1]) {
+		return
+	}
+	v, found := c.cache().LPop(string(args[1]))
+	if !found {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeValue(v)
+}
+
+func cmdRPop(c *conn, args [][]byte) {
+	if !c.checkList(args[1]) {
+		return
+	}
+	v, found := c.cache().RPop(string(args[1]))
+	if !found {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeValue(v)
+}
+
+func cmdLLen(c *conn, args [][]byte) {
+	c.intReply(c.cache().LLen(string(args[1])))
+}
+
+func cmdLRange(c *conn, args [][]byte) {
+	start, ok1 := parseInt(args[2])
+	stop, ok2 := parseInt(args[3])
+	if !ok1 || !ok2 {
+		c.w.writeError(errNotInt)
+		return
+	}
+	elems, err := c.cache().LRange(string(args[1]), int(clampInt(start)), int(clampInt(stop)))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeArray(len(elems))
+	for _, v := range elems {
+		b, _ := formatValue(v)
+		c.w.writeBulk(b)
+	}
+}
+
+func cmdLIndex(c *conn, args [][]byte) {
+	i, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	v, found, err := c.cache().LIndex(string(args[1]), int(clampInt(i)))
+	switch {
+	case err != nil:
+		c.writeErr(err)
+	case !found:
+		c.w.writeNull()
+	default:
+		c.w.writeValue(v)
+	}
+}
+
+func cmdLSet(c *conn, args [][]byte) {
+	i, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	err := c.cache().LSet(string(args[1]), int(clampInt(i)), string(args[3]))
+	switch {
+	case errors.Is(err, gocache.ErrNoSuchKey):
+		c.w.writeError("ERR no such key")
+	case errors.Is(err, gocache.ErrIndexOutOfRange):
+		c.w.writeError("ERR index out of range")
+	case err != nil:
+		c.writeErr(err)
+	default:
+		c.w.writeOK()
+	}
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func cmdLInsert(c *conn, args [][]byte) {
+	var before bool
+	switch strings.ToLower(string(args[2])) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		c.w.writeError(errSyntax)
+		return
+	}
+	c.intReply(c.cache().LInsert(string(args[1]), before, string(args[3]), string(args[4])))
+}
+
+func cmdLRem(c *conn, args [][]byte) {
+	count, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	c.intReply(c.cache().LRem(string(args[1]), int(clampInt(count)), string(args[3])))
+}
+
+func cmdLTrim(c *conn, args [][]byte) {
+	start, ok1 := parseInt(args[2])
+	stop, ok2 := parseInt(args[3])
+	if !ok1 || !ok2 {
+		c.w.writeError(errNotInt)
+		return
+	}
+	if err := c.cache().LTrim(string(args[1]), int(clampInt(start)), int(clampInt(stop))); err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeOK()
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func cmdLPos(c *conn, args [][]byte) {
+	var opts gocache.LPosOptions
+	withCount := false
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.w.writeError(errSyntax)
+			return
+		}
+		n, ok := parseInt(args[i+1])
+		if !ok {
+			c.w.writeError(errNotInt)
+			return
+		}
+		n = clampInt(n)
+		switch strings.ToLower(string(args[i])) {
+		case "rank":
+			if n == 0 {
+				c.w.writeError("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+				return
+			}
+			opts.Rank = int(n)
+		case "count":
+			if n < 0 {
+				c.w.writeError("ERR COUNT can't be negative")
+				return
+			}
+			withCount = true
+			// COUNT 0 means every match.
+			opts.Count = int(n)
+			if n == 0 {
+				opts.Count = -1
+			}
+		case "maxlen":
+			if n < 0 {
+				c.w.writeError("ERR MAXLEN can't be negative")
+				return
+			}
+			opts.MaxLen = int(n)
+		default:
+			c.w.writeError(errSyntax)
+			return
+		}
+	}
+	pos, err := c.cache().LPos(string(args[1]), string(args[2]), opts)
+	switch {
+	case err != nil:
+		c.writeErr(err)
+	case withCount:
+		c.w.writeArray(len(pos))
+		for _, p := range pos {
+			c.w.writeInt(int64(p))
+		}
+	case len(pos) == 0:
+		c.w.writeNull()
+	default:
+		c.w.writeInt(int64(pos[0]))
+	}
+}
+
+func parseListEnd(b []byte) (gocache.ListEnd, bool) {
+	switch strings.ToLower(string(b)) {
+	case "left":
+		return gocache.Left, true
+	case "right":
+		return gocache.Right, true
+	}
+	return 0, false
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func cmdLMove(c *conn, args [][]byte) {
+	from, ok1 := parseListEnd(args[3])
+	to, ok2 := parseListEnd(args[4])
+	if !ok1 || !ok2 {
+		c.w.writeError(errSyntax)
+		return
+	}
+	c.moveReply(c.cache().LMove(string(args[1]), string(args[2]), from, to))
+}
+
+func cmdRPopLPush(c *conn, args [][]byte) {
+	c.moveReply(c.cache().RPopLPush(string(args[1]), string(args[2])))
+}
+
+func (c *conn) moveReply(v any, found bool, err error) {
+	switch {
+	case err != nil:
+		c.writeErr(err)
+	case !found:
+		c.w.writeNull()
+	default:
+		c.w.writeValue(v)
+	}
+}
+
+// parseTimeout parses the timeout argument of the blocking list commands,
+// given in seconds.
+func (c *conn) parseTimeout(b []byte) (time.Duration, bool) {
+	f, ok := parseFloat(b)
+	if !ok || f > math.MaxInt64/float64(time.Second) {
+		c.w.writeError("ERR timeout is not a float or out of range")
+		return 0, false
+	}
+	if f < 0 {
+		c.w.writeError("ERR timeout is negative")
+		return 0, false
+	}
+	return time.Duration(f * float64(time.Second)), true
+}
+
+// block runs fn, which blocks, with a context canceled when the server is
+// closed or the client disconnects. Pending replies are flushed first so
+// that the client sees them while the command waits, and transactions of
+// other clients may run meanwhile.
+func (c *conn) block(fn func(ctx context.Context)) {
+	c.w.bw.Flush()
+	ctx, done := c.blockingContext()
+	c.srv.execMu.RUnlock()
+	defer func() {
+		c.srv.execMu.RLock()
+		done()
+	}()
+	fn(ctx)
+}
+
+// BLPOP key [key ...] timeout
+func cmdBLPop(c *conn, args [][]byte) {
+	c.bpop(args, c.cache().BLPop)
+}
+
+// BRPOP key [key ...] timeout
+func cmdBRPop(c *conn, args [][]byte) {
+	c.bpop(args, c.cache().BRPop)
+}
+
+func (c *conn) bpop(args [][]byte, pop func(context.Context, time.Duration, ...string) (string, any, error)) {
+	timeout, ok := c.parseTimeout(args[len(args)-1])
+	if !ok {
+		return
+	}
+	keys := strs(args[1 : len(args)-1])
+	c.block(func(ctx context.Context) {
+		k, v, err := pop(ctx, timeout, keys...)
+		switch {
+		case errors.Is(err, gocache.ErrWrongType):
+			c.writeErr(err)
+		case err != nil:
+			c.w.writeNullArray()
+		default:
+			c.w.writeArray(2)
+			c.w.writeBulkString(k)
+			c.w.writeValue(v)
+		}
+	})
+}
+
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func cmdBLMove(c *conn, args [][]byte) {
+	from, ok1 := parseListEnd(args[3])
+	to, ok2 := parseListEnd(args[4])
+	if !ok1 || !ok2 {
+		c.w.writeError(errSyntax)
+		return
+	}
+	c.blmove(args[1], args[2], from, to, args[5])
+}
+
+// BRPOPLPUSH source destination timeout
+func cmdBRPopLPush(c *conn, args [][]byte) {
+	c.blmove(args[1], args[2], gocache.Right, gocache.Left, args[3])
+}
+
+func (c *conn) blmove(src, dst []byte, from, to gocache.ListEnd, timeout []byte) {
+	d, ok := c.parseTimeout(timeout)
+	if !ok {
+		return
+	}
+	c.block(func(ctx context.Context) {
+		v, err := c.cache().BLMove(ctx, d, string(src), string(dst), from, to)
+		switch {
+		case errors.Is(err, gocache.ErrWrongType):
+			c.writeErr(err)
+		case err != nil:
+			c.w.writeNull()
+		default:
+			c.w.writeValue(v)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package server
+
+import "github.com/millken/gocache"
+
+// subscribedCommands are the commands a RESP2 client may send while it is
+// subscribed to channels, since its connection then carries messages.
+var subscribedCommands = map[string]bool{
+	"subscribe":    true,
+	"psubscribe":   true,
+	"unsubscribe":  true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
+// subscribed reports whether the client is subscribed to any channel or
+// pattern.
+func (c *conn) subscribed() bool {
+	return c.sub != nil && c.sub.Count() > 0
+}
+
+// subscription returns the client's subscription, creating it and starting
+// the goroutine forwarding its messages on first use.
+func (c *conn) subscription() *gocache.Subscription {
+	if c.sub == nil {
+		c.sub = c.cache().SubscribeChannels()
+		c.subDone = make(chan struct{})
+		go c.forward(c.sub)
+	}
+	return c.sub
+}
+
+// forward writes the messages received on sub until it is closed.
+func (c *conn) forward(sub *gocache.Subscription) {
+	defer close(c.subDone)
+	ch := sub.Channel()
+	for m := range ch {
+		c.mu.Lock()
+		if m.Pattern != "" {
+			c.w.writePush(4)
+			c.w.writeBulkString("pmessage")
+			c.w.writeBulkString(m.Pattern)
+		} else {
+			c.w.writePush(3)
+			c.w.writeBulkString("message")
+		}
+		c.w.writeBulkString(m.Channel)
+		if b, ok := formatValue(m.Payload); ok {
+			c.w.writeBulk(b)
+		} else {
+			c.w.writeNull()
+		}
+		if len(ch) == 0 {
+			c.w.bw.Flush()
+		}
+		c.mu.Unlock()
+	}
+}
+
+// subscriptionReply confirms a change to the client's subscription.
+func (c *conn) subscriptionReply(kind string, name *string, count int) {
+	c.w.writePush(3)
+	c.w.writeBulkString(kind)
+	if name != nil {
+		c.w.writeBulkString(*name)
+	} else {
+		c.w.writeNull()
+	}
+	c.w.writeInt(int64(count))
+}
+
+func cmdPublish(c *conn, args [][]byte) {
+	c.w.writeInt(int64(c.cache().Publish(string(args[1]), string(args[2]))))
+}
+
+// SUBSCRIBE channel [channel ...]
+func cmdSubscribe(c *conn, args [][]byte) {
+	sub := c.subscription()
+	for _, name := range strs(args[1:]) {
+		name := name
+		sub.Subscribe(name)
+		c.subscriptionReply("subscribe", &name, sub.Count())
+	}
+}
+
+// PSUBSCRIBE pattern [pattern ...]
+func cmdPSubscribe(c *conn, args [][]byte) {
+	sub := c.subscription()
+	for _, name := range strs(args[1:]) {
+		name := name
+		sub.PSubscribe(name)
+		c.subscriptionReply("psubscribe", &name, sub.Count())
+	}
+}
+
+// UNSUBSCRIBE [channel ...]
+func cmdUnsubscribe(c *conn, args [][]byte) {
+	sub := c.subscription()
+	names := strs(args[1:])
+	if len(names) == 0 {
+		names = sub.Channels()
+	}
+	c.unsubscribe("unsubscribe", names, sub.Unsubscribe)
+}
+
+// PUNSUBSCRIBE [pattern ...]
+func cmdPUnsubscribe(c *conn, args [][]byte) {
+	sub := c.subscription()
+	names := strs(args[1:])
+	if len(names) == 0 {
+		names = sub.Patterns()
+	}
+	c.unsubscribe("punsubscribe", names, sub.PUnsubscribe)
+}
+
+// unsubscribe removes names with remove, confirming each one. With no names
+// it still confirms, as Redis does.
+func (c *conn) unsubscribe(kind string, names []string, remove func(...string)) {
+	if len(names) == 0 {
+		c.subscriptionReply(kind, nil, c.sub.Count())
+		return
+	}
+	for _, name := range names {
+		name := name
+		remove(name)
+		c.subscriptionReply(kind, &name, c.sub.Count())
+	}
+}
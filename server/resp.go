@@ -0,0 +1,310 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLen   = 512 << 20
+	maxArgs      = 1 << 20
+	maxInlineLen = 64 << 10
+	// bulkChunk and argsChunk bound what a request header alone makes the
+	// server allocate; buffers grow as the data arrives.
+	bulkChunk = 64 << 10
+	argsChunk = 1024
+)
+
+// errProtocol is returned for malformed requests; the connection is closed
+// after it has been reported.
+var errProtocol = errors.New("Protocol error")
+
+type reader struct {
+	br *bufio.Reader
+}
+
+func (r *reader) readLine() ([]byte, error) {
+	line, err := r.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("%w: too big inline request", errProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: expected CRLF", errProtocol)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readCommand reads either a RESP array of bulk strings or an inline
+// command, as typed into telnet.
+func (r *reader) readCommand() ([][]byte, error) {
+	b, err := r.br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != '*' {
+		line, err := r.readInline()
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = []byte(f)
+		}
+		return args, nil
+	}
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+	if n <= 0 {
+		// Like Redis, treat *-1 and *0 as an empty command.
+		return nil, nil
+	}
+	args := make([][]byte, 0, capped(n, argsChunk))
+	for i := 0; i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%.1s'", errProtocol, line)
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+		buf, err := r.readBulk(size + 2)
+		if err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: expected CRLF", errProtocol)
+		}
+		args = append(args, buf[:size])
+	}
+	return args, nil
+}
+
+// readInline reads an inline command up to its newline, of at most
+// maxInlineLen bytes.
+func (r *reader) readInline() (string, error) {
+	var line []byte
+	for {
+		b, err := r.br.ReadSlice('\n')
+		if len(line)+len(b) > maxInlineLen {
+			return "", fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+		line = append(line, b...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// readBulk reads n bytes, growing the buffer as they arrive rather than
+// trusting n up front.
+func (r *reader) readBulk(n int) ([]byte, error) {
+	buf := make([]byte, 0, capped(n, bulkChunk))
+	for {
+		m, err := io.ReadFull(r.br, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+m]
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) == n {
+			return buf, nil
+		}
+		grown := make([]byte, len(buf), len(buf)+capped(n-len(buf), len(buf)))
+		copy(grown, buf)
+		buf = grown
+	}
+}
+
+// capped returns n, or max if n is larger.
+func capped(n, max int) int {
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// writer encodes replies in RESP2 or, after HELLO 3, RESP3.
+type writer struct {
+	bw    *bufio.Writer
+	proto int
+}
+
+func (w *writer) header(prefix byte, n int64) {
+	w.bw.WriteByte(prefix)
+	w.bw.WriteString(strconv.FormatInt(n, 10))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) writeSimple(s string) {
+	w.bw.WriteByte('+')
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) writeOK() {
+	w.writeSimple("OK")
+}
+
+// writeError writes an error reply. msg should start with an error code
+// such as ERR or WRONGTYPE.
+func (w *writer) writeError(msg string) {
+	w.bw.WriteByte('-')
+	w.bw.WriteString(msg)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) writeInt(n int64) {
+	w.header(':', n)
+}
+
+func (w *writer) writeBool(b bool) {
+	if b {
+		w.writeInt(1)
+	} else {
+		w.writeInt(0)
+	}
+}
+
+func (w *writer) writeBulk(b []byte) {
+	w.header('$', int64(len(b)))
+	w.bw.Write(b)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) writeBulkString(s string) {
+	w.header('$', int64(len(s)))
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) writeNull() {
+	if w.proto >= 3 {
+		w.bw.WriteString("_\r\n")
+	} else {
+		w.bw.WriteString("$-1\r\n")
+	}
+}
+
+func (w *writer) writeNullArray() {
+	if w.proto >= 3 {
+		w.bw.WriteString("_\r\n")
+	} else {
+		w.bw.WriteString("*-1\r\n")
+	}
+}
+
+func (w *writer) writeArray(n int) {
+	w.header('*', int64(n))
+}
+
+// writeMap starts a map of n pairs; RESP2 clients get a flat array.
+func (w *writer) writeMap(n int) {
+	if w.proto >= 3 {
+		w.header('%', int64(n))
+	} else {
+		w.header('*', int64(2*n))
+	}
+}
+
+// writePush starts an out-of-band message such as a pub/sub delivery.
+func (w *writer) writePush(n int) {
+	if w.proto >= 3 {
+		w.header('>', int64(n))
+	} else {
+		w.header('*', int64(n))
+	}
+}
+
+func (w *writer) writeDouble(f float64) {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if math.IsInf(f, 1) {
+		s = "inf"
+	} else if math.IsInf(f, -1) {
+		s = "-inf"
+	}
+	if w.proto >= 3 {
+		w.bw.WriteByte(',')
+		w.bw.WriteString(s)
+		w.bw.WriteString("\r\n")
+	} else {
+		w.writeBulkString(s)
+	}
+}
+
+func (w *writer) writeStrings(ss []string) {
+	w.writeArray(len(ss))
+	for _, s := range ss {
+		w.writeBulkString(s)
+	}
+}
+
+// formatValue renders a cached scalar as a bulk string. It reports false for
+// containers such as hashes and lists, and other values it cannot render.
+func formatValue(v any) ([]byte, bool) {
+	switch x := v.(type) {
+	case string:
+		return []byte(x), true
+	case []byte:
+		return x, true
+	case int:
+		return strconv.AppendInt(nil, int64(x), 10), true
+	case int8:
+		return strconv.AppendInt(nil, int64(x), 10), true
+	case int16:
+		return strconv.AppendInt(nil, int64(x), 10), true
+	case int32:
+		return strconv.AppendInt(nil, int64(x), 10), true
+	case int64:
+		return strconv.AppendInt(nil, x, 10), true
+	case uint:
+		return strconv.AppendUint(nil, uint64(x), 10), true
+	case uint8:
+		return strconv.AppendUint(nil, uint64(x), 10), true
+	case uint16:
+		return strconv.AppendUint(nil, uint64(x), 10), true
+	case uint32:
+		return strconv.AppendUint(nil, uint64(x), 10), true
+	case uint64:
+		return strconv.AppendUint(nil, x, 10), true
+	case float32:
+		return strconv.AppendFloat(nil, float64(x), 'f', -1, 32), true
+	case float64:
+		return strconv.AppendFloat(nil, x, 'f', -1, 64), true
+	case bool:
+		if x {
+			return []byte("1"), true
+		}
+		return []byte("0"), true
+	case fmt.Stringer:
+		return []byte(x.String()), true
+	}
+	return nil, false
+}
+
+// writeValue writes a cached scalar, or a WRONGTYPE error for containers.
+func (w *writer) writeValue(v any) {
+	b, ok := formatValue(v)
+	if !ok {
+		w.writeError(errWrongType)
+		return
+	}
+	w.writeBulk(b)
+}
@@ -0,0 +1,281 @@
+/*
+Package server serves a gocache.Cache over the Redis serialization protocol
+(RESP2 and RESP3), so that redis-cli and Redis client libraries can use it.
+*/
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close.
+var ErrServerClosed = errors.New("server: closed")
+
+// Server serves a cache to RESP clients. Each connection is handled by its
+// own goroutine.
+type Server struct {
+	cache *gocache.Cache
+
+	// ErrorLog logs errors accepting connections. If nil, the log
+	// package's standard logger is used.
+	ErrorLog *log.Logger
+
+	// execMu is held for reading while a command runs and for writing
+	// while EXEC runs a transaction, so that no command interleaves with it.
+	execMu sync.RWMutex
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns a server for c.
+func New(c *gocache.Cache) *Server {
+	return &Server{
+		cache:     c,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP or Unix socket address and serves
+// clients until the server is closed.
+func (s *Server) ListenAndServe(network, address string) error {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until the server is closed. It always
+// returns a non-nil error, ErrServerClosed after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				s.logf("server: accept error: %v", err)
+				continue
+			}
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		c := &conn{
+			srv:    s,
+			nc:     nc,
+			r:      reader{br: bufio.NewReader(nc)},
+			w:      writer{bw: bufio.NewWriter(nc), proto: 2},
+			ctx:    ctx,
+			cancel: cancel,
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// Close stops all listeners, closes every client connection and waits for
+// their goroutines to exit.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for c := range s.conns {
+		c.cancel()
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+type conn struct {
+	srv *Server
+	nc  net.Conn
+	r   reader
+	w   writer
+
+	mu   sync.Mutex // serializes writes to w
+	quit bool
+
+	// ctx is canceled when the server is closed, waking blocked commands.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sub is the client's pub/sub subscription, if it ever subscribed.
+	// Its messages are written by a goroutine that closes subDone when
+	// sub is closed.
+	sub     *gocache.Subscription
+	subDone chan struct{}
+
+	// multi is set between MULTI and EXEC or DISCARD, while commands are
+	// queued; multiErr is set if one of them was rejected.
+	multi    bool
+	multiErr bool
+	queued   [][][]byte
+	// watch holds the keys watched with WATCH.
+	watch *gocache.Tx
+}
+
+func (c *conn) serve() {
+	defer func() {
+		// A bug in one command must not take down every client.
+		if r := recover(); r != nil {
+			c.srv.logf("server: panic serving %v: %v\n%s", c.nc.RemoteAddr(), r, debug.Stack())
+		}
+		c.cancel()
+		if c.sub != nil {
+			c.sub.Close()
+			<-c.subDone
+		}
+		c.nc.Close()
+		c.srv.mu.Lock()
+		delete(c.srv.conns, c)
+		c.srv.mu.Unlock()
+		c.srv.wg.Done()
+	}()
+	for !c.quit {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.mu.Lock()
+				c.w.writeError("ERR " + err.Error())
+				c.w.bw.Flush()
+				c.mu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !c.handle(args) {
+			return
+		}
+	}
+}
+
+// handle runs a command and reports whether its reply could be written.
+func (c *conn) handle(args [][]byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dispatch(args)
+	// Flush once the pipeline has been drained.
+	if c.r.br.Buffered() == 0 || c.quit {
+		return c.w.bw.Flush() == nil
+	}
+	return true
+}
+
+func (c *conn) dispatch(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.abortMulti()
+		c.w.writeError("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.abortMulti()
+		c.w.writeError("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+	if c.w.proto < 3 && !subscribedCommands[name] && c.subscribed() {
+		c.w.writeError("ERR Can't execute '" + name + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+		return
+	}
+	if c.multi && !multiCommands[name] {
+		c.queue(name, args)
+		return
+	}
+	if name != "exec" {
+		c.srv.execMu.RLock()
+		defer c.srv.execMu.RUnlock()
+	}
+	cmd.fn(c, args)
+}
+
+// blockingContext returns a context for a command that blocks, such as
+// BLPOP. It is canceled when the server is closed or the client disconnects,
+// so that the command does not consume an element nobody will receive. The
+// returned function must be called once the command has stopped blocking,
+// before the next command is read.
+func (c *conn) blockingContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	if c.r.br.Buffered() > 0 {
+		// The client has pipelined further commands, which will be read
+		// once this one returns.
+		return ctx, cancel
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Peek returns when the client sends more data, hangs up or the
+		// read deadline below expires. Only a hang-up cancels ctx.
+		if _, err := c.r.br.Peek(1); err != nil {
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Timeout() {
+				cancel()
+			}
+		}
+	}()
+	return ctx, func() {
+		c.nc.SetReadDeadline(time.Now())
+		<-done
+		c.nc.SetReadDeadline(time.Time{})
+		cancel()
+	}
+}
@@ -0,0 +1,633 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+// respError is an error reply.
+type respError string
+
+// client is a minimal hand-written RESP client.
+type client struct {
+	t  *testing.T
+	nc net.Conn
+	br *bufio.Reader
+}
+
+func (c *client) send(args ...string) {
+	buf := fmt.Sprintf("*%d\r\n", len(args))
+	for _, a := range args {
+		buf += fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.nc.Write([]byte(buf)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() any {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return respError(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case ',':
+		f, _ := strconv.ParseFloat(line[1:], 64)
+		return f
+	case '_':
+		return nil
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.br, b); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(b[:n])
+	case '*', '%', '>':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		a := make([]any, n)
+		for i := range a {
+			a[i] = c.read()
+		}
+		return a
+	}
+	c.t.Fatalf("unexpected reply %q", line)
+	return nil
+}
+
+func (c *client) do(args ...string) any {
+	c.send(args...)
+	return c.read()
+}
+
+func newTestServer(t *testing.T, tc *gocache.Cache) (*Server, *client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(tc)
+	go srv.Serve(l)
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		nc.Close()
+		srv.Close()
+	})
+	return srv, &client{t: t, nc: nc, br: bufio.NewReader(nc)}
+}
+
+func expect(t *testing.T, got, want any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestServer_Strings(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	_, c := newTestServer(t, tc)
+
+	expect(t, c.do("PING"), "PONG")
+	expect(t, c.do("GET", "a"), nil)
+	expect(t, c.do("SET", "a", "1"), "OK")
+	expect(t, c.do("GET", "a"), "1")
+	expect(t, c.do("SET", "a", "2", "NX"), nil)
+	expect(t, c.do("SET", "b", "2", "XX"), nil)
+	expect(t, c.do("SET", "a", "2", "XX"), "OK")
+	expect(t, c.do("INCRBY", "a", "10"), int64(12))
+	expect(t, c.do("DECRBY", "a", "2"), int64(10))
+	expect(t, c.do("INCR", "counter"), int64(1))
+	expect(t, c.do("SET", "s", "abc"), "OK")
+	expect(t, c.do("INCR", "s"), respError(errNotInt))
+	expect(t, c.do("DEL", "a", "s", "missing"), int64(2))
+	expect(t, c.do("EXISTS", "a", "counter"), int64(1))
+	expect(t, c.do("SET", "a", "1", "BOGUS"), respError(errSyntax))
+	expect(t, c.do("NOPE"), respError("ERR unknown command 'NOPE'"))
+	expect(t, c.do("GET"), respError("ERR wrong number of arguments for 'get' command"))
+
+	// Values set in-process are visible to clients.
+	tc.Set("native", 42, gocache.NoExpiration)
+	expect(t, c.do("GET", "native"), "42")
+
+	expect(t, c.do("SETNX", "n", "1"), int64(1))
+	expect(t, c.do("SETNX", "n", "2"), int64(0))
+	expect(t, c.do("GETSET", "n", "3"), "1")
+	expect(t, c.do("GETDEL", "n"), "3")
+	expect(t, c.do("GETDEL", "n"), nil)
+	expect(t, c.do("MSET", "k1", "v1", "k2", "v2"), "OK")
+	expect(t, c.do("MSET", "k1"), respError("ERR wrong number of arguments for 'mset' command"))
+	expect(t, c.do("MSETNX", "k2", "x", "k3", "y"), int64(0))
+	expect(t, c.do("MGET", "k1", "k3", "k2"), []any{"v1", nil, "v2"})
+	expect(t, c.do("APPEND", "k1", "23"), int64(4))
+	expect(t, c.do("STRLEN", "k1"), int64(4))
+	expect(t, c.do("GETRANGE", "k1", "1", "-1"), "123")
+	expect(t, c.do("SETRANGE", "k1", "1", "XY"), int64(4))
+	expect(t, c.do("GET", "k1"), "vXY3")
+	expect(t, c.do("INCRBYFLOAT", "f", "2.5"), "2.5")
+	expect(t, c.do("INCRBYFLOAT", "k1", "1"), respError(errNotFloat))
+	expect(t, c.do("GETEX", "k1", "EX", "100"), "vXY3")
+	expect(t, c.do("TTL", "k1"), int64(100))
+	expect(t, c.do("GETEX", "k1", "PERSIST"), "vXY3")
+	expect(t, c.do("TTL", "k1"), int64(-1))
+}
+
+func TestServer_Expiration(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	_, c := newTestServer(t, tc)
+
+	expect(t, c.do("SET", "a", "1", "EX", "100"), "OK")
+	expect(t, c.do("TTL", "a"), int64(100))
+	expect(t, c.do("SET", "b", "1"), "OK")
+	expect(t, c.do("TTL", "b"), int64(-1))
+	expect(t, c.do("TTL", "missing"), int64(-2))
+	expect(t, c.do("EXPIRE", "b", "10"), int64(1))
+	expect(t, c.do("TTL", "b"), int64(10))
+	expect(t, c.do("EXPIRE", "missing", "10"), int64(0))
+	expect(t, c.do("SET", "p", "1", "PX", "20"), "OK")
+	time.Sleep(30 * time.Millisecond)
+	expect(t, c.do("GET", "p"), nil)
+	expect(t, c.do("EXPIRE", "b", "0"), int64(1))
+	expect(t, c.do("GET", "b"), nil)
+}
+
+func TestServer_DefaultExpiration(t *testing.T) {
+	tc := gocache.NewCache(gocache.Config{DefaultExpiration: 100 * time.Second})
+	_, c := newTestServer(t, tc)
+
+	expect(t, c.do("SET", "a", "1"), "OK")
+	expect(t, c.do("SETNX", "b", "1"), int64(1))
+	expect(t, c.do("GETSET", "c", "1"), nil)
+	expect(t, c.do("MSET", "d", "1"), "OK")
+	expect(t, c.do("MSETNX", "e", "1"), int64(1))
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		expect(t, c.do("TTL", k), int64(100))
+	}
+	expect(t, c.do("SET", "a", "1", "EX", "10"), "OK")
+	expect(t, c.do("TTL", "a"), int64(10))
+}
+
+func TestServer_HashesAndLists(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	_, c := newTestServer(t, tc)
+
+	expect(t, c.do("HSET", "h", "f1", "v1", "f2", "v2"), int64(2))
+	expect(t, c.do("HSET", "h", "f1", "v3"), int64(0))
+	expect(t, c.do("HGET", "h", "f1"), "v3")
+	expect(t, c.do("HGET", "h", "nope"), nil)
+	all := c.do("HGETALL", "h").([]any)
+	pairs := map[any]any{}
+	for i := 0; i < len(all); i += 2 {
+		pairs[all[i]] = all[i+1]
+	}
+	expect(t, pairs, map[any]any{"f1": "v3", "f2": "v2"})
+	expect(t, c.do("HDEL", "h", "f1", "nope"), int64(1))
+	expect(t, c.do("GET", "h"), respError(errWrongType))
+
+	expect(t, c.do("RPUSH", "l", "a", "b"), int64(2))
+	expect(t, c.do("LPUSH", "l", "z"), int64(3))
+	expect(t, c.do("LPOP", "l"), "z")
+	expect(t, c.do("RPOP", "l"), "b")
+	expect(t, c.do("LPOP", "l"), "a")
+	expect(t, c.do("LPOP", "l"), nil)
+	expect(t, c.do("LPUSH", "h", "x"), respError(errWrongType))
+}
+
+func TestServer_Lists(t *testing.T) {
+	_, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+
+	expect(t, c.do("RPUSH", "l", "a", "b", "c", "b"), int64(4))
+	expect(t, c.do("LLEN", "l"), int64(4))
+	expect(t, c.do("LRANGE", "l", "0", "-1"), []any{"a", "b", "c", "b"})
+	expect(t, c.do("LINDEX", "l", "-1"), "b")
+	expect(t, c.do("LINDEX", "l", "9"), nil)
+	expect(t, c.do("LSET", "l", "0", "A"), "OK")
+	expect(t, c.do("LSET", "l", "9", "A"), respError("ERR index out of range"))
+	expect(t, c.do("LSET", "nope", "0", "A"), respError("ERR no such key"))
+	expect(t, c.do("LINSERT", "l", "AFTER", "c", "d"), int64(5))
+	expect(t, c.do("LPOS", "l", "b"), int64(1))
+	expect(t, c.do("LPOS", "l", "b", "RANK", "-1", "COUNT", "0"), []any{int64(4), int64(1)})
+	expect(t, c.do("LREM", "l", "0", "b"), int64(2))
+	expect(t, c.do("LTRIM", "l", "1", "-1"), "OK")
+	expect(t, c.do("LRANGE", "l", "0", "-1"), []any{"c", "d"})
+	expect(t, c.do("LMOVE", "l", "m", "LEFT", "RIGHT"), "c")
+	expect(t, c.do("RPOPLPUSH", "l", "m"), "d")
+	expect(t, c.do("RPOPLPUSH", "l", "m"), nil)
+	expect(t, c.do("LRANGE", "m", "0", "-1"), []any{"d", "c"})
+}
+
+func TestServer_Sets(t *testing.T) {
+	_, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+
+	expect(t, c.do("SADD", "a", "1", "2", "3"), int64(3))
+	expect(t, c.do("SADD", "b", "2", "3", "4"), int64(3))
+	expect(t, c.do("SISMEMBER", "a", "1"), int64(1))
+	expect(t, c.do("SCARD", "a"), int64(3))
+	expect(t, c.do("SREM", "a", "1", "9"), int64(1))
+	expect(t, c.do("SMOVE", "b", "a", "4"), int64(1))
+	expect(t, sortedReply(c.do("SMEMBERS", "a")), []any{"2", "3", "4"})
+	expect(t, sortedReply(c.do("SINTER", "a", "b")), []any{"2", "3"})
+	expect(t, c.do("SDIFFSTORE", "d", "a", "b"), int64(1))
+	expect(t, c.do("SMEMBERS", "d"), []any{"4"})
+	expect(t, c.do("SPOP", "d"), "4")
+	expect(t, c.do("SPOP", "d"), nil)
+	expect(t, c.do("SET", "s", "x"), "OK")
+	expect(t, c.do("SADD", "s", "x"), respError(errWrongType))
+}
+
+func TestServer_SortedSets(t *testing.T) {
+	_, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+
+	expect(t, c.do("ZADD", "z", "1", "a", "2", "b", "3", "c"), int64(3))
+	expect(t, c.do("ZADD", "z", "XX", "CH", "5", "a", "1", "x"), int64(1))
+	expect(t, c.do("ZADD", "z", "INCR", "1", "b"), "3")
+	expect(t, c.do("ZADD", "z", "NX", "INCR", "1", "b"), nil)
+	expect(t, c.do("ZADD", "z", "NX", "GT", "1", "b"), respError("ERR GT, LT, and/or NX options at the same time are not compatible"))
+	expect(t, c.do("ZINCRBY", "z", "0.5", "c"), "3.5")
+	expect(t, c.do("ZSCORE", "z", "a"), "5")
+	expect(t, c.do("ZCARD", "z"), int64(3))
+	expect(t, c.do("ZRANK", "z", "a"), int64(2))
+	expect(t, c.do("ZREVRANK", "z", "a"), int64(0))
+	expect(t, c.do("ZRANK", "z", "missing"), nil)
+	expect(t, c.do("ZRANGE", "z", "0", "-1"), []any{"b", "c", "a"})
+	expect(t, c.do("ZREVRANGE", "z", "0", "0", "WITHSCORES"), []any{"a", "5"})
+	expect(t, c.do("ZRANGEBYSCORE", "z", "(3", "+inf"), []any{"c", "a"})
+	expect(t, c.do("ZREVRANGEBYSCORE", "z", "+inf", "-inf", "LIMIT", "1", "1"), []any{"c"})
+	expect(t, c.do("ZRANGEBYSCORE", "z", "x", "1"), respError(errMinMax))
+	expect(t, c.do("ZCOUNT", "z", "-inf", "(5"), int64(2))
+	expect(t, c.do("ZADD", "lex", "0", "a", "0", "b", "0", "c"), int64(3))
+	expect(t, c.do("ZRANGEBYLEX", "lex", "(a", "+"), []any{"b", "c"})
+	expect(t, c.do("ZRANGEBYLEX", "lex", "-", "[b", "LIMIT", "0", "1"), []any{"a"})
+	expect(t, c.do("ZRANGEBYLEX", "lex", "+", "-"), []any{})
+	expect(t, c.do("ZPOPMIN", "z"), []any{"b", "3"})
+	expect(t, c.do("ZPOPMAX", "z", "5"), []any{"a", "5", "c", "3.5"})
+	expect(t, c.do("ZREMRANGEBYSCORE", "lex", "0", "0"), int64(3))
+	expect(t, c.do("EXISTS", "z", "lex"), int64(0))
+}
+
+func sortedReply(r any) any {
+	a, ok := r.([]any)
+	if ok {
+		sort.Slice(a, func(i, j int) bool { return a[i].(string) < a[j].(string) })
+	}
+	return a
+}
+
+func TestServer_Keyspace(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	_, c := newTestServer(t, tc)
+
+	for _, k := range []string{"user:1", "user:2", "order:1"} {
+		c.do("SET", k, "x")
+	}
+	expect(t, c.do("DBSIZE"), int64(3))
+	keys := c.do("KEYS", "user:*").([]any)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].(string) < keys[j].(string) })
+	expect(t, keys, []any{"user:1", "user:2"})
+	expect(t, c.do("FLUSHALL"), "OK")
+	expect(t, c.do("DBSIZE"), int64(0))
+}
+
+func TestServer_RESP3(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	_, c := newTestServer(t, tc)
+
+	hello := c.do("HELLO", "3").([]any)
+	expect(t, hello[2:4], []any{"proto", int64(3)})
+	expect(t, c.do("GET", "missing"), nil)
+	c.send("HSET", "h", "f", "v")
+	c.read()
+	// Maps are sent with the '%' type, which read flattens.
+	expect(t, c.do("HGETALL", "h"), []any{"f", "v"})
+	expect(t, c.do("HELLO", "4"), respError("NOPROTO unsupported protocol version"))
+}
+
+func TestServer_PipelineAndInline(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	_, c := newTestServer(t, tc)
+
+	c.send("SET", "a", "1")
+	c.send("INCR", "a")
+	c.send("GET", "a")
+	expect(t, c.read(), "OK")
+	expect(t, c.read(), int64(2))
+	expect(t, c.read(), "2")
+
+	c.nc.Write([]byte("PING hi\r\n"))
+	expect(t, c.read(), "hi")
+	expect(t, c.do("QUIT"), "OK")
+}
+
+func TestServer_MalformedRequests(t *testing.T) {
+	srv, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+	srv.ErrorLog = log.New(io.Discard, "", 0)
+
+	c.nc.Write([]byte("*-1\r\n*0\r\n"))
+	expect(t, c.do("PING"), "PONG")
+
+	commands["panic"] = command{func(c *conn, args [][]byte) { panic("boom") }, 1}
+	defer delete(commands, "panic")
+	c.send("PANIC")
+	if _, err := c.br.ReadString('\n'); err == nil {
+		t.Error("a panicking command should close its connection")
+	}
+	expect(t, dialClient(t, srv).do("PING"), "PONG")
+
+	big := strings.Repeat("x", 200<<10)
+	c = dialClient(t, srv)
+	expect(t, c.do("SET", "big", big), "OK")
+	expect(t, c.do("GET", "big"), big)
+	c.nc.Write([]byte(big))
+	expect(t, c.read(), respError("ERR Protocol error: too big inline request"))
+}
+
+func TestReader_Bounds(t *testing.T) {
+	// Headers announcing huge requests allocate as the data arrives.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for _, req := range []string{"*1\r\n$536870000\r\nabc", "*1000000\r\n$1\r\na\r\n"} {
+		r := &reader{br: bufio.NewReader(strings.NewReader(req))}
+		if _, err := r.readCommand(); err != io.ErrUnexpectedEOF && err != io.EOF {
+			t.Errorf("%q: got %v, want EOF", req, err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Error("truncated requests allocated", n, "bytes")
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	addr := t.TempDir() + "/gocache.sock"
+	srv := New(gocache.NewCache(gocache.DefaultConfig))
+	done := make(chan error)
+	go func() { done <- srv.ListenAndServe("unix", addr) }()
+	var nc net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if nc, err = net.Dial("unix", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{t: t, nc: nc, br: bufio.NewReader(nc)}
+	expect(t, c.do("PING"), "PONG")
+	srv.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Error("expected ErrServerClosed, got", err)
+	}
+}
+
+// dialClient opens another connection to srv.
+func dialClient(t *testing.T, srv *Server) *client {
+	srv.mu.Lock()
+	var addr net.Addr
+	for l := range srv.listeners {
+		addr = l.Addr()
+	}
+	srv.mu.Unlock()
+	nc, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	return &client{t: t, nc: nc, br: bufio.NewReader(nc)}
+}
+
+func TestServer_BlockingLists(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	srv, c := newTestServer(t, tc)
+
+	expect(t, c.do("RPUSH", "q", "a"), int64(1))
+	expect(t, c.do("BLPOP", "none", "q", "0"), []any{"q", "a"})
+	expect(t, c.do("BRPOP", "q", "0.01"), nil)
+	expect(t, c.do("BLPOP", "q", "-1"), respError("ERR timeout is negative"))
+	expect(t, c.do("BLPOP", "q", "x"), respError("ERR timeout is not a float or out of range"))
+	expect(t, c.do("BLMOVE", "q", "r", "LEFT", "LEFT", "0.01"), nil)
+
+	// A pipelined command's reply is flushed before BLPOP blocks.
+	c.send("PING")
+	c.send("BLPOP", "q", "0")
+	expect(t, c.read(), "PONG")
+	expect(t, dialClient(t, srv).do("RPUSH", "q", "b"), int64(1))
+	expect(t, c.read(), []any{"q", "b"})
+
+	c.send("BRPOPLPUSH", "q", "r", "0")
+	time.Sleep(20 * time.Millisecond)
+	expect(t, dialClient(t, srv).do("RPUSH", "q", "c"), int64(1))
+	expect(t, c.read(), "c")
+	expect(t, c.do("LRANGE", "r", "0", "-1"), []any{"c"})
+
+	// A client that disconnects while blocked does not consume elements.
+	gone := dialClient(t, srv)
+	gone.send("BLPOP", "q", "0")
+	time.Sleep(20 * time.Millisecond)
+	gone.nc.Close()
+	time.Sleep(20 * time.Millisecond)
+	expect(t, c.do("RPUSH", "q", "d"), int64(1))
+	expect(t, c.do("LLEN", "q"), int64(1))
+}
+
+func TestServer_CloseWakesBlockedClients(t *testing.T) {
+	srv, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+	c.send("BLPOP", "q", "0")
+	time.Sleep(20 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		srv.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return while a client was blocked")
+	}
+}
+
+func TestServer_Hashes(t *testing.T) {
+	_, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+
+	expect(t, c.do("HSET", "h", "a", "1", "b", "2"), int64(2))
+	expect(t, c.do("HMSET", "h", "c", "3"), "OK")
+	expect(t, c.do("HMGET", "h", "a", "x", "c"), []any{"1", nil, "3"})
+	expect(t, c.do("HSETNX", "h", "a", "9"), int64(0))
+	expect(t, c.do("HINCRBY", "h", "a", "10"), int64(11))
+	expect(t, c.do("HINCRBYFLOAT", "h", "b", "0.5"), "2.5")
+	expect(t, c.do("HEXISTS", "h", "c"), int64(1))
+	expect(t, c.do("HLEN", "h"), int64(3))
+	expect(t, sortedReply(c.do("HKEYS", "h")), []any{"a", "b", "c"})
+	expect(t, sortedReply(c.do("HVALS", "h")), []any{"11", "2.5", "3"})
+	scan := c.do("HSCAN", "h", "0", "MATCH", "a", "COUNT", "100").([]any)
+	expect(t, scan, []any{"0", []any{"a", "11"}})
+	expect(t, c.do("HEXPIRE", "h", "100", "FIELDS", "2", "a", "x"), []any{int64(1), int64(-2)})
+	expect(t, c.do("HTTL", "h", "FIELDS", "2", "a", "b"), []any{int64(100), int64(-1)})
+	expect(t, c.do("HPERSIST", "h", "FIELDS", "1", "a"), []any{int64(1)})
+	expect(t, c.do("HPEXPIRE", "h", "0", "FIELDS", "1", "c"), []any{int64(2)})
+	expect(t, c.do("HEXPIRE", "h", "1", "FIELDS", "2", "a"), respError("ERR The `numfields` parameter must match the number of arguments"))
+	expect(t, c.do("HDEL", "h", "a", "b"), int64(2))
+	expect(t, c.do("HGETALL", "h"), []any{})
+	expect(t, c.do("SET", "s", "x"), "OK")
+	expect(t, c.do("HGET", "s", "a"), respError(errWrongType))
+	expect(t, c.do("HSET", "s", "a", "1"), respError(errWrongType))
+}
+
+func TestServer_PubSub(t *testing.T) {
+	tc := gocache.NewCache(gocache.DefaultConfig)
+	srv, c := newTestServer(t, tc)
+	pub := dialClient(t, srv)
+
+	expect(t, c.do("SUBSCRIBE", "news", "sport"), []any{"subscribe", "news", int64(1)})
+	expect(t, c.read(), []any{"subscribe", "sport", int64(2)})
+	expect(t, c.do("PSUBSCRIBE", "n*"), []any{"psubscribe", "n*", int64(3)})
+	expect(t, c.do("GET", "a"), respError("ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context"))
+	expect(t, c.do("PING"), []any{"pong", ""})
+
+	expect(t, pub.do("PUBLISH", "news", "hello"), int64(2))
+	expect(t, c.read(), []any{"message", "news", "hello"})
+	expect(t, c.read(), []any{"pmessage", "n*", "news", "hello"})
+	tc.Publish("sport", 42)
+	expect(t, c.read(), []any{"message", "sport", "42"})
+
+	expect(t, c.do("PUNSUBSCRIBE"), []any{"punsubscribe", "n*", int64(2)})
+	expect(t, c.do("UNSUBSCRIBE", "news"), []any{"unsubscribe", "news", int64(1)})
+	expect(t, c.do("UNSUBSCRIBE"), []any{"unsubscribe", "sport", int64(0)})
+	expect(t, c.do("UNSUBSCRIBE"), []any{"unsubscribe", nil, int64(0)})
+	expect(t, c.do("PING"), "PONG")
+	expect(t, pub.do("PUBLISH", "news", "x"), int64(0))
+
+	// RESP3 clients may run any command while subscribed.
+	c.do("HELLO", "3")
+	expect(t, c.do("SUBSCRIBE", "news"), []any{"subscribe", "news", int64(1)})
+	expect(t, c.do("SET", "a", "1"), "OK")
+}
+
+func TestServer_Streams(t *testing.T) {
+	srv, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+
+	expect(t, c.do("XADD", "s", "1-1", "b", "2", "a", "1"), "1-1")
+	expect(t, c.do("XADD", "s", "1-1", "a", "1"), respError("ERR The ID specified in XADD is equal or smaller than the target stream top item"))
+	expect(t, c.do("XADD", "s", "0-0", "a", "1"), respError("ERR The ID specified in XADD must be greater than 0-0"))
+	expect(t, c.do("XADD", "s", "2", "a", "2"), "2-0")
+	expect(t, c.do("XADD", "s", "MAXLEN", "~", "2", "3-0", "a", "3"), "3-0")
+	expect(t, c.do("XADD", "none", "NOMKSTREAM", "*", "a", "1"), nil)
+	expect(t, c.do("XLEN", "s"), int64(2))
+	expect(t, c.do("XRANGE", "s", "-", "+"), []any{
+		[]any{"2-0", []any{"a", "2"}},
+		[]any{"3-0", []any{"a", "3"}},
+	})
+	expect(t, c.do("XRANGE", "s", "(2-0", "3"), []any{[]any{"3-0", []any{"a", "3"}}})
+	expect(t, c.do("XREVRANGE", "s", "+", "-", "COUNT", "1"), []any{[]any{"3-0", []any{"a", "3"}}})
+	expect(t, c.do("XRANGE", "s", "x", "+"), respError(errStreamID))
+
+	expect(t, c.do("XREAD", "COUNT", "1", "STREAMS", "s", "none", "0", "0"), []any{
+		[]any{"s", []any{[]any{"2-0", []any{"a", "2"}}}},
+	})
+	expect(t, c.do("XREAD", "STREAMS", "s", "$"), nil)
+	expect(t, c.do("XREAD", "STREAMS", "s", "t", "0"), respError("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified."))
+	c.send("XREAD", "BLOCK", "0", "STREAMS", "s", "$")
+	time.Sleep(20 * time.Millisecond)
+	expect(t, dialClient(t, srv).do("XADD", "s", "4-0", "a", "4"), "4-0")
+	expect(t, c.read(), []any{[]any{"s", []any{[]any{"4-0", []any{"a", "4"}}}}})
+	expect(t, c.do("XREAD", "BLOCK", "10", "STREAMS", "s", "$"), nil)
+
+	expect(t, c.do("XGROUP", "CREATE", "none", "g", "$"), respError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."))
+	expect(t, c.do("XGROUP", "CREATE", "s", "g", "0"), "OK")
+	expect(t, c.do("XGROUP", "CREATE", "s", "g", "0"), respError("BUSYGROUP Consumer Group name already exists"))
+	expect(t, c.do("XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">"), []any{
+		[]any{"s", []any{
+			[]any{"2-0", []any{"a", "2"}},
+			[]any{"3-0", []any{"a", "3"}},
+		}},
+	})
+	expect(t, c.do("XREADGROUP", "GROUP", "nope", "alice", "STREAMS", "s", ">"), respError("NOGROUP No such key or consumer group"))
+	expect(t, c.do("XACK", "s", "g", "2-0", "9-0"), int64(1))
+	expect(t, c.do("XPENDING", "s", "g"), []any{int64(1), "3-0", "3-0", []any{[]any{"alice", "1"}}})
+	ext := c.do("XPENDING", "s", "g", "-", "+", "10").([]any)
+	if len(ext) != 1 || ext[0].([]any)[0] != "3-0" || ext[0].([]any)[3] != int64(1) {
+		t.Errorf("XPENDING extended form: %v", ext)
+	}
+	expect(t, c.do("XCLAIM", "s", "g", "bob", "0", "3-0"), []any{[]any{"3-0", []any{"a", "3"}}})
+	expect(t, c.do("XPENDING", "s", "g", "-", "+", "10", "alice"), []any{})
+	expect(t, c.do("XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", "0"), []any{
+		[]any{"s", []any{[]any{"3-0", []any{"a", "3"}}}},
+	})
+}
+
+func TestServer_Transactions(t *testing.T) {
+	srv, c := newTestServer(t, gocache.NewCache(gocache.DefaultConfig))
+	other := dialClient(t, srv)
+
+	expect(t, c.do("MULTI"), "OK")
+	expect(t, c.do("MULTI"), respError("ERR MULTI calls can not be nested"))
+	expect(t, c.do("SET", "a", "1"), "QUEUED")
+	expect(t, c.do("INCR", "a"), "QUEUED")
+	expect(t, c.do("HSET", "a", "f", "v"), "QUEUED")
+	expect(t, other.do("GET", "a"), nil)
+	expect(t, c.do("EXEC"), []any{"OK", int64(2), respError(errWrongType)})
+	expect(t, c.do("EXEC"), respError("ERR EXEC without MULTI"))
+
+	expect(t, c.do("MULTI"), "OK")
+	expect(t, c.do("INCR", "a"), "QUEUED")
+	expect(t, c.do("DISCARD"), "OK")
+	expect(t, c.do("GET", "a"), "2")
+
+	expect(t, c.do("MULTI"), "OK")
+	expect(t, c.do("INCR"), respError("ERR wrong number of arguments for 'incr' command"))
+	expect(t, c.do("BLPOP", "l", "0"), respError("ERR Command not allowed inside a transaction"))
+	expect(t, c.do("INCR", "a"), "QUEUED")
+	expect(t, c.do("EXEC"), respError("EXECABORT Transaction discarded because of previous errors."))
+	expect(t, c.do("GET", "a"), "2")
+
+	expect(t, c.do("WATCH", "a"), "OK")
+	expect(t, c.do("MULTI"), "OK")
+	expect(t, c.do("WATCH", "a"), respError("ERR WATCH inside MULTI is not allowed"))
+	expect(t, c.do("INCR", "a"), "QUEUED")
+	expect(t, other.do("SET", "a", "10"), "OK")
+	expect(t, c.do("EXEC"), nil)
+	expect(t, c.do("GET", "a"), "10")
+
+	expect(t, c.do("WATCH", "a"), "OK")
+	expect(t, c.do("MULTI"), "OK")
+	expect(t, c.do("INCR", "a"), "QUEUED")
+	expect(t, c.do("EXEC"), []any{int64(11)})
+
+	expect(t, c.do("WATCH", "a"), "OK")
+	expect(t, c.do("UNWATCH"), "OK")
+	expect(t, other.do("SET", "a", "20"), "OK")
+	expect(t, c.do("MULTI"), "OK")
+	expect(t, c.do("INCR", "a"), "QUEUED")
+	expect(t, c.do("EXEC"), []any{int64(21)})
+}
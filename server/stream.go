@@ -0,0 +1,527 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/millken/gocache"
+)
+
+const errStreamID = "ERR Invalid stream ID specified as stream command argument"
+
+// parseStreamID parses a complete or incomplete (ms only) entry ID.
+func parseStreamID(b []byte) (gocache.StreamID, bool) {
+	id, err := gocache.ParseStreamID(string(b))
+	return id, err == nil
+}
+
+// parseRangeID parses an endpoint of XRANGE: - or + for the lowest or
+// highest ID, an ID, or an ID prefixed with ( to exclude it. An incomplete ID
+// stands for its first sequence number at the start of a range and its last
+// at the end. It reports false in empty if an exclusive endpoint leaves no
+// IDs.
+func parseRangeID(b []byte, end bool) (id gocache.StreamID, empty, ok bool) {
+	switch string(b) {
+	case "-":
+		return gocache.MinStreamID, false, true
+	case "+":
+		return gocache.MaxStreamID, false, true
+	}
+	exclusive := len(b) > 0 && b[0] == '('
+	if exclusive {
+		b = b[1:]
+	}
+	id, ok = parseStreamID(b)
+	if !ok {
+		return id, false, false
+	}
+	if end && !strings.Contains(string(b), "-") {
+		id.Seq = math.MaxUint64
+	}
+	if !exclusive {
+		return id, false, true
+	}
+	switch {
+	case !end && id == gocache.MaxStreamID, end && id == gocache.MinStreamID:
+		return id, true, true
+	case !end && id.Seq == math.MaxUint64:
+		return gocache.StreamID{Ms: id.Ms + 1}, false, true
+	case !end:
+		return gocache.StreamID{Ms: id.Ms, Seq: id.Seq + 1}, false, true
+	case id.Seq == 0:
+		return gocache.StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, false, true
+	}
+	return gocache.StreamID{Ms: id.Ms, Seq: id.Seq - 1}, false, true
+}
+
+// writeMessages writes stream entries as [id, [field, value, ...]] pairs.
+// Fields are sorted, since the cache does not keep their order.
+func (c *conn) writeMessages(msgs []gocache.XMessage) {
+	c.w.writeArray(len(msgs))
+	for _, m := range msgs {
+		c.w.writeArray(2)
+		c.w.writeBulkString(m.ID.String())
+		if m.Values == nil {
+			c.w.writeNullArray()
+			continue
+		}
+		fields := make([]string, 0, len(m.Values))
+		for f := range m.Values {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		c.w.writeArray(2 * len(fields))
+		for _, f := range fields {
+			c.w.writeBulkString(f)
+			if b, ok := formatValue(m.Values[f]); ok {
+				c.w.writeBulk(b)
+			} else {
+				c.w.writeNull()
+			}
+		}
+	}
+}
+
+// writeStreams writes the reply of XREAD and XREADGROUP.
+func (c *conn) writeStreams(out []gocache.XStream) {
+	if len(out) == 0 {
+		c.w.writeNullArray()
+		return
+	}
+	if c.w.proto >= 3 {
+		c.w.writeMap(len(out))
+	} else {
+		c.w.writeArray(len(out))
+	}
+	for _, xs := range out {
+		if c.w.proto < 3 {
+			c.w.writeArray(2)
+		}
+		c.w.writeBulkString(xs.Key)
+		c.writeMessages(xs.Messages)
+	}
+}
+
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func cmdXAdd(c *conn, args [][]byte) {
+	var a gocache.XAddArgs
+	i := 2
+	for ; i < len(args); i++ {
+		switch opt := strings.ToLower(string(args[i])); opt {
+		case "nomkstream":
+			a.NoMkStream = true
+			continue
+		case "maxlen", "minid":
+			var ok bool
+			i++
+			if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+				i++
+			}
+			if i >= len(args) {
+				c.w.writeError(errSyntax)
+				return
+			}
+			if opt == "maxlen" {
+				var n int64
+				n, ok = parseInt(args[i])
+				if !ok || n < 0 {
+					c.w.writeError("ERR The MAXLEN argument must be >= 0.")
+					return
+				}
+				// MAXLEN 0 empties the stream, which MaxLen cannot express.
+				a.MaxLen = int(clampInt(n))
+				if n == 0 {
+					a.MinID = gocache.MaxStreamID
+				}
+			} else if a.MinID, ok = parseStreamID(args[i]); !ok {
+				c.w.writeError(errStreamID)
+				return
+			}
+			if i+2 < len(args) && strings.ToLower(string(args[i+1])) == "limit" {
+				i += 2
+			}
+			continue
+		}
+		break
+	}
+	if i >= len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		c.w.writeError("ERR wrong number of arguments for 'xadd' command")
+		return
+	}
+	if string(args[i]) != "*" {
+		id, ok := parseStreamID(args[i])
+		if !ok {
+			c.w.writeError(errStreamID)
+			return
+		}
+		if id == gocache.MinStreamID {
+			c.w.writeError("ERR The ID specified in XADD must be greater than 0-0")
+			return
+		}
+		a.ID = id
+	}
+	a.Values = make(map[string]any, (len(args)-i-1)/2)
+	for j := i + 1; j < len(args); j += 2 {
+		a.Values[string(args[j])] = string(args[j+1])
+	}
+	id, err := c.cache().XAdd(string(args[1]), a)
+	switch {
+	case errors.Is(err, gocache.ErrNoSuchKey):
+		c.w.writeNull()
+	case errors.Is(err, gocache.ErrStreamID):
+		c.w.writeError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	case err != nil:
+		c.writeErr(err)
+	default:
+		c.w.writeBulkString(id.String())
+	}
+}
+
+func cmdXLen(c *conn, args [][]byte) {
+	c.intReply(c.cache().XLen(string(args[1])))
+}
+
+// XRANGE key start end [COUNT count]
+func cmdXRange(c *conn, args [][]byte) {
+	c.xrange(args, args[2], args[3], c.cache().XRange)
+}
+
+// XREVRANGE key end start [COUNT count]
+func cmdXRevRange(c *conn, args [][]byte) {
+	c.xrange(args, args[3], args[2], func(k string, start, end gocache.StreamID, count int) ([]gocache.XMessage, error) {
+		return c.cache().XRevRange(k, end, start, count)
+	})
+}
+
+func (c *conn) xrange(args [][]byte, start, end []byte, fn func(string, gocache.StreamID, gocache.StreamID, int) ([]gocache.XMessage, error)) {
+	var count int
+	switch {
+	case len(args) == 6 && strings.ToLower(string(args[4])) == "count":
+		n, ok := parseInt(args[5])
+		if !ok {
+			c.w.writeError(errNotInt)
+			return
+		}
+		if n <= 0 {
+			c.w.writeArray(0)
+			return
+		}
+		count = int(clampInt(n))
+	case len(args) != 4:
+		c.w.writeError(errSyntax)
+		return
+	}
+	lo, empty1, ok1 := parseRangeID(start, false)
+	hi, empty2, ok2 := parseRangeID(end, true)
+	if !ok1 || !ok2 {
+		c.w.writeError(errStreamID)
+		return
+	}
+	if empty1 || empty2 {
+		c.w.writeArray(0)
+		return
+	}
+	msgs, err := fn(string(args[1]), lo, hi, count)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeMessages(msgs)
+}
+
+// streamsOptions holds the options shared by XREAD and XREADGROUP.
+type streamsOptions struct {
+	count   int
+	block   bool
+	timeout time.Duration
+	noAck   bool
+	keys    []string
+	ids     [][]byte
+}
+
+// parseStreamsOptions parses [COUNT count] [BLOCK milliseconds] [NOACK]
+// STREAMS key [key ...] id [id ...], accepting NOACK only for XREADGROUP.
+func (c *conn) parseStreamsOptions(name string, args [][]byte, group bool) (streamsOptions, bool) {
+	var o streamsOptions
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		switch {
+		case (opt == "count" || opt == "block") && i+1 < len(args):
+			i++
+			n, ok := parseInt(args[i])
+			if !ok {
+				c.w.writeError(errNotInt)
+				return o, false
+			}
+			if opt == "count" {
+				o.count = int(clampInt(n))
+			} else if n < 0 {
+				c.w.writeError("ERR timeout is negative")
+				return o, false
+			} else {
+				o.block = true
+				o.timeout = time.Duration(n) * time.Millisecond
+			}
+		case opt == "noack" && group:
+			o.noAck = true
+		case opt == "streams":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				c.w.writeError("ERR Unbalanced '" + name + "' list of streams: for each stream key an ID or '$' must be specified.")
+				return o, false
+			}
+			o.keys = strs(rest[:len(rest)/2])
+			o.ids = rest[len(rest)/2:]
+			return o, true
+		default:
+			c.w.writeError(errSyntax)
+			return o, false
+		}
+	}
+	c.w.writeError(errSyntax)
+	return o, false
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func cmdXRead(c *conn, args [][]byte) {
+	o, ok := c.parseStreamsOptions("xread", args[1:], false)
+	if !ok {
+		return
+	}
+	a := gocache.XReadArgs{Keys: o.keys, Count: o.count, Block: o.block, Timeout: o.timeout}
+	for _, b := range o.ids {
+		id := gocache.MaxStreamID
+		if string(b) != "$" {
+			if id, ok = parseStreamID(b); !ok {
+				c.w.writeError(errStreamID)
+				return
+			}
+		}
+		a.IDs = append(a.IDs, id)
+	}
+	c.xread(o.block, func(ctx context.Context) ([]gocache.XStream, error) {
+		return c.cache().XRead(ctx, a)
+	})
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func cmdXReadGroup(c *conn, args [][]byte) {
+	if strings.ToLower(string(args[1])) != "group" {
+		c.w.writeError(errSyntax)
+		return
+	}
+	o, ok := c.parseStreamsOptions("xreadgroup", args[4:], true)
+	if !ok {
+		return
+	}
+	a := gocache.XReadGroupArgs{
+		Group:    string(args[2]),
+		Consumer: string(args[3]),
+		Keys:     o.keys,
+		Count:    o.count,
+		NoAck:    o.noAck,
+		Block:    o.block,
+		Timeout:  o.timeout,
+	}
+	for _, b := range o.ids {
+		id := gocache.MaxStreamID
+		if string(b) != ">" {
+			if id, ok = parseStreamID(b); !ok {
+				c.w.writeError(errStreamID)
+				return
+			}
+		}
+		a.IDs = append(a.IDs, id)
+	}
+	c.xread(o.block, func(ctx context.Context) ([]gocache.XStream, error) {
+		return c.cache().XReadGroup(ctx, a)
+	})
+}
+
+// xread runs read, blocking the client if block is set, and writes its
+// result. A timeout or cancellation is reported as a null array.
+func (c *conn) xread(block bool, read func(ctx context.Context) ([]gocache.XStream, error)) {
+	reply := func(ctx context.Context) {
+		out, err := read(ctx)
+		switch {
+		case errors.Is(err, gocache.ErrTimeout), errors.Is(err, context.Canceled):
+			c.w.writeNullArray()
+		case err != nil:
+			c.writeErr(err)
+		default:
+			c.writeStreams(out)
+		}
+	}
+	if block {
+		c.block(reply)
+	} else {
+		reply(c.ctx)
+	}
+}
+
+// XGROUP CREATE key group id|$ [MKSTREAM]
+func cmdXGroup(c *conn, args [][]byte) {
+	if strings.ToLower(string(args[1])) != "create" {
+		c.w.writeError("ERR unknown subcommand '" + string(args[1]) + "'")
+		return
+	}
+	if len(args) < 5 || len(args) > 6 {
+		c.w.writeError("ERR wrong number of arguments for 'xgroup|create' command")
+		return
+	}
+	mkStream := false
+	if len(args) == 6 {
+		if strings.ToLower(string(args[5])) != "mkstream" {
+			c.w.writeError(errSyntax)
+			return
+		}
+		mkStream = true
+	}
+	id := gocache.MaxStreamID
+	if string(args[4]) != "$" {
+		var ok bool
+		if id, ok = parseStreamID(args[4]); !ok {
+			c.w.writeError(errStreamID)
+			return
+		}
+	}
+	err := c.cache().XGroupCreate(string(args[2]), string(args[3]), id, mkStream)
+	switch {
+	case errors.Is(err, gocache.ErrNoSuchKey):
+		c.w.writeError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	case err != nil:
+		c.writeErr(err)
+	default:
+		c.w.writeOK()
+	}
+}
+
+// parseStreamIDs parses the IDs given to XACK and XCLAIM.
+func (c *conn) parseStreamIDs(args [][]byte) ([]gocache.StreamID, bool) {
+	ids := make([]gocache.StreamID, len(args))
+	for i, b := range args {
+		id, ok := parseStreamID(b)
+		if !ok {
+			c.w.writeError(errStreamID)
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
+
+// XACK key group id [id ...]
+func cmdXAck(c *conn, args [][]byte) {
+	ids, ok := c.parseStreamIDs(args[3:])
+	if !ok {
+		return
+	}
+	c.intReply(c.cache().XAck(string(args[1]), string(args[2]), ids...))
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func cmdXPending(c *conn, args [][]byte) {
+	k, group := string(args[1]), string(args[2])
+	if len(args) == 3 {
+		sum, err := c.cache().XPending(k, group)
+		if err != nil {
+			c.writeErr(err)
+			return
+		}
+		c.w.writeArray(4)
+		c.w.writeInt(int64(sum.Count))
+		if sum.Count == 0 {
+			c.w.writeNull()
+			c.w.writeNull()
+			c.w.writeNullArray()
+			return
+		}
+		c.w.writeBulkString(sum.Lower.String())
+		c.w.writeBulkString(sum.Higher.String())
+		names := make([]string, 0, len(sum.Consumers))
+		for name := range sum.Consumers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.w.writeArray(len(names))
+		for _, name := range names {
+			c.w.writeArray(2)
+			c.w.writeBulkString(name)
+			c.w.writeBulkString(strconv.Itoa(sum.Consumers[name]))
+		}
+		return
+	}
+
+	var a gocache.XPendingExtArgs
+	rest := args[3:]
+	if strings.ToLower(string(rest[0])) == "idle" && len(rest) > 1 {
+		n, ok := parseInt(rest[1])
+		if !ok {
+			c.w.writeError(errNotInt)
+			return
+		}
+		a.Idle = time.Duration(n) * time.Millisecond
+		rest = rest[2:]
+	}
+	if len(rest) < 3 || len(rest) > 4 {
+		c.w.writeError(errSyntax)
+		return
+	}
+	var empty1, empty2, ok1, ok2 bool
+	a.Start, empty1, ok1 = parseRangeID(rest[0], false)
+	a.End, empty2, ok2 = parseRangeID(rest[1], true)
+	if !ok1 || !ok2 {
+		c.w.writeError(errStreamID)
+		return
+	}
+	n, ok := parseInt(rest[2])
+	if !ok {
+		c.w.writeError(errNotInt)
+		return
+	}
+	if n <= 0 || empty1 || empty2 {
+		c.w.writeArray(0)
+		return
+	}
+	a.Count = int(clampInt(n))
+	if len(rest) == 4 {
+		a.Consumer = string(rest[3])
+	}
+	pending, err := c.cache().XPendingExt(k, group, a)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeArray(len(pending))
+	for _, p := range pending {
+		c.w.writeArray(4)
+		c.w.writeBulkString(p.ID.String())
+		c.w.writeBulkString(p.Consumer)
+		c.w.writeInt(p.Idle.Milliseconds())
+		c.w.writeInt(int64(p.RetryCount))
+	}
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...]
+func cmdXClaim(c *conn, args [][]byte) {
+	n, ok := parseInt(args[4])
+	if !ok {
+		c.w.writeError("ERR Invalid min-idle-time argument for XCLAIM")
+		return
+	}
+	ids, ok := c.parseStreamIDs(args[5:])
+	if !ok {
+		return
+	}
+	msgs, err := c.cache().XClaim(string(args[1]), string(args[2]), string(args[3]), time.Duration(n)*time.Millisecond, ids...)
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeMessages(msgs)
+}
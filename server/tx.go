@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/millken/gocache"
+)
+
+// multiCommands are the commands run immediately, rather than queued, while
+// a client is in a MULTI block.
+var multiCommands = map[string]bool{
+	"multi":   true,
+	"exec":    true,
+	"discard": true,
+	"watch":   true,
+	"quit":    true,
+}
+
+// notInMulti are the commands that cannot be queued in a MULTI block, since
+// they block or change how the connection is used.
+var notInMulti = map[string]bool{
+	"blpop":        true,
+	"brpop":        true,
+	"blmove":       true,
+	"brpoplpush":   true,
+	"xread":        true,
+	"xreadgroup":   true,
+	"subscribe":    true,
+	"psubscribe":   true,
+	"unsubscribe":  true,
+	"punsubscribe": true,
+	"hello":        true,
+}
+
+// queue queues a command sent in a MULTI block.
+func (c *conn) queue(name string, args [][]byte) {
+	if notInMulti[name] {
+		c.w.writeError("ERR Command not allowed inside a transaction")
+		c.multiErr = true
+		return
+	}
+	c.queued = append(c.queued, args)
+	c.w.writeSimple("QUEUED")
+}
+
+// abortMulti records that a command sent in a MULTI block was rejected, so
+// that EXEC discards the transaction.
+func (c *conn) abortMulti() {
+	if c.multi {
+		c.multiErr = true
+	}
+}
+
+// endMulti leaves the MULTI block and drops the watched keys.
+func (c *conn) endMulti() {
+	c.multi = false
+	c.multiErr = false
+	c.queued = nil
+	c.watch = nil
+}
+
+func cmdMulti(c *conn, args [][]byte) {
+	if c.multi {
+		c.w.writeError("ERR MULTI calls can not be nested")
+		return
+	}
+	c.multi = true
+	c.w.writeOK()
+}
+
+func cmdDiscard(c *conn, args [][]byte) {
+	if !c.multi {
+		c.w.writeError("ERR DISCARD without MULTI")
+		return
+	}
+	c.endMulti()
+	c.w.writeOK()
+}
+
+// EXEC runs the queued commands while no other client runs any, and replies
+// with their replies. If a watched key changed it runs none of them and
+// replies with a null array.
+func cmdExec(c *conn, args [][]byte) {
+	if !c.multi {
+		c.w.writeError("ERR EXEC without MULTI")
+		return
+	}
+	queued, watch, failed := c.queued, c.watch, c.multiErr
+	c.endMulti()
+	if failed {
+		c.w.writeError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+	c.srv.execMu.Lock()
+	defer c.srv.execMu.Unlock()
+	if watch != nil {
+		if err := watch.Exec(func(*gocache.Tx) error { return nil }); errors.Is(err, gocache.ErrTxAborted) {
+			c.w.writeNullArray()
+			return
+		}
+	}
+	c.w.writeArray(len(queued))
+	for _, args := range queued {
+		commands[strings.ToLower(string(args[0]))].fn(c, args)
+	}
+}
+
+// WATCH key [key ...]
+func cmdWatch(c *conn, args [][]byte) {
+	if c.multi {
+		c.w.writeError("ERR WATCH inside MULTI is not allowed")
+		return
+	}
+	if c.watch == nil {
+		c.watch = c.cache().Watch(strs(args[1:])...)
+	} else {
+		c.watch.Watch(strs(args[1:])...)
+	}
+	c.w.writeOK()
+}
+
+func cmdUnwatch(c *conn, args [][]byte) {
+	c.watch = nil
+	c.w.writeOK()
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/millken/gocache"
+)
+
+const errMinMax = "ERR min or max is not a float"
+
+func parseFloat(b []byte) (float64, bool) {
+	f, err := strconv.ParseFloat(string(b), 64)
+	return f, err == nil && !math.IsNaN(f)
+}
+
+// parseScoreRange parses the min and max arguments of ZRANGEBYSCORE, where
+// a leading '(' makes a bound exclusive.
+func parseScoreRange(min, max []byte) (gocache.ScoreRange, bool) {
+	var r gocache.ScoreRange
+	var ok1, ok2 bool
+	r.Min, r.MinExclusive, ok1 = parseScoreBound(min)
+	r.Max, r.MaxExclusive, ok2 = parseScoreBound(max)
+	return r, ok1 && ok2
+}
+
+func parseScoreBound(b []byte) (float64, bool, bool) {
+	exclusive := len(b) > 0 && b[0] == '('
+	if exclusive {
+		b = b[1:]
+	}
+	f, ok := parseFloat(b)
+	return f, exclusive, ok
+}
+
+// parseLexRange parses the min and max arguments of ZRANGEBYLEX. It
+// reports empty for ranges that cannot contain any member, such as "+" as
+// the minimum.
+func parseLexRange(min, max []byte) (r gocache.LexRange, empty, ok bool) {
+	switch {
+	case string(min) == "-":
+		r.MinInf = true
+	case string(min) == "+":
+		empty = true
+	case len(min) > 0 && (min[0] == '[' || min[0] == '('):
+		r.Min, r.MinExclusive = string(min[1:]), min[0] == '('
+	default:
+		return r, false, false
+	}
+	switch {
+	case string(max) == "+":
+		r.MaxInf = true
+	case string(max) == "-":
+		empty = true
+	case len(max) > 0 && (max[0] == '[' || max[0] == '('):
+		r.Max, r.MaxExclusive = string(max[1:]), max[0] == '('
+	default:
+		return r, false, false
+	}
+	return r, empty, true
+}
+
+// parseRangeOptions parses the trailing [WITHSCORES] [LIMIT offset count]
+// options of the ZRANGE family.
+func parseRangeOptions(args [][]byte, allowScores bool) (withScores bool, offset, count int, ok bool) {
+	count = -1
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withscores":
+			if !allowScores {
+				return false, 0, 0, false
+			}
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return false, 0, 0, false
+			}
+			o, ok1 := parseInt(args[i+1])
+			n, ok2 := parseInt(args[i+2])
+			if !ok1 || !ok2 || o < 0 || o > math.MaxInt32 || n > math.MaxInt32 {
+				return false, 0, 0, false
+			}
+			offset, count = int(o), int(n)
+			i += 2
+		default:
+			return false, 0, 0, false
+		}
+	}
+	return withScores, offset, count, true
+}
+
+func (c *conn) writeZ(zs []gocache.Z, withScores bool) {
+	if !withScores {
+		c.w.writeArray(len(zs))
+		for _, z := range zs {
+			c.w.writeBulkString(z.Member)
+		}
+		return
+	}
+	c.w.writeArray(2 * len(zs))
+	for _, z := range zs {
+		c.w.writeBulkString(z.Member)
+		c.w.writeDouble(z.Score)
+	}
+}
+
+func (c *conn) zReply(zs []gocache.Z, withScores bool, err error) {
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.writeZ(zs, withScores)
+}
+
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func cmdZAdd(c *conn, args [][]byte) {
+	var flags gocache.ZAddFlag
+	var incr bool
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			flags |= gocache.ZAddNX
+		case "xx":
+			flags |= gocache.ZAddXX
+		case "gt":
+			flags |= gocache.ZAddGT
+		case "lt":
+			flags |= gocache.ZAddLT
+		case "ch":
+			flags |= gocache.ZAddCh
+		case "incr":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		c.w.writeError(errSyntax)
+		return
+	}
+	if incr && len(pairs) != 2 {
+		c.w.writeError("ERR INCR option supports a single increment-element pair")
+		return
+	}
+	zs := make([]gocache.Z, len(pairs)/2)
+	for j := range zs {
+		score, ok := parseFloat(pairs[2*j])
+		if !ok {
+			c.w.writeError(errNotFloat)
+			return
+		}
+		zs[j] = gocache.Z{Member: string(pairs[2*j+1]), Score: score}
+	}
+	k := string(args[1])
+	if incr {
+		score, ok, err := c.cache().ZAddIncr(k, flags, zs[0])
+		switch {
+		case err != nil:
+			c.zaddErr(err)
+		case !ok:
+			c.w.writeNull()
+		default:
+			c.w.writeDouble(score)
+		}
+		return
+	}
+	n, err := c.cache().ZAdd(k, flags, zs...)
+	if err != nil {
+		c.zaddErr(err)
+		return
+	}
+	c.w.writeInt(int64(n))
+}
+
+func (c *conn) zaddErr(err error) {
+	if err == gocache.ErrZAddFlags {
+		c.w.writeError("ERR GT, LT, and/or NX options at the same time are not compatible")
+		return
+	}
+	c.writeErr(err)
+}
+
+func cmdZIncrBy(c *conn, args [][]byte) {
+	incr, ok := parseFloat(args[2])
+	if !ok {
+		c.w.writeError(errNotFloat)
+		return
+	}
+	score, err := c.cache().ZIncrBy(string(args[1]), incr, string(args[3]))
+	if err != nil {
+		c.writeErr(err)
+		return
+	}
+	c.w.writeDouble(score)
+}
+
+func cmdZRem(c *conn, args [][]byte) {
+	c.intReply(c.cache().ZRem(string(args[1]), strs(args[2:])...))
+}
+
+func cmdZScore(c *conn, args [][]byte) {
+	score, found, err := c.cache().ZScore(string(args[1]), string(args[2]))
+	switch {
+	case err != nil:
+		c.writeErr(err)
+	case !found:
+		c.w.writeNull()
+	default:
+		c.w.writeDouble(score)
+	}
+}
+
+func cmdZCard(c *conn, args [][]byte) {
+	c.intReply(c.cache().ZCard(string(args[1])))
+}
+
+func (c *conn) rankReply(r int, found bool, err error) {
+	switch {
+	case err != nil:
+		c.writeErr(err)
+	case !found:
+		c.w.writeNull()
+	default:
+		c.w.writeInt(int64(r))
+	}
+}
+
+func cmdZRank(c *conn, args [][]byte) {
+	c.rankReply(c.cache().ZRank(string(args[1]), string(args[2])))
+}
+
+func cmdZRevRank(c *conn, args [][]byte) {
+	c.rankReply(c.cache().ZRevRank(string(args[1]), string(args[2])))
+}
+
+// ZRANGE key start stop [WITHSCORES]
+func cmdZRange(c *conn, args [][]byte) {
+	c.zrange(args, c.cache().ZRange)
+}
+
+// ZREVRANGE key start stop [WITHSCORES]
+func cmdZRevRange(c *conn, args [][]byte) {
+	c.zrange(args, c.cache().ZRevRange)
+}
+
+func (c *conn) zrange(args [][]byte, fn func(string, int, int) ([]gocache.Z, error)) {
+	start, ok1 := parseInt(args[2])
+	stop, ok2 := parseInt(args[3])
+	if !ok1 || !ok2 {
+		c.w.writeError(errNotInt)
+		return
+	}
+	withScores, _, count, ok := parseRangeOptions(args[4:], true)
+	if !ok || count != -1 {
+		c.w.writeError(errSyntax)
+		return
+	}
+	start, stop = clampInt(start), clampInt(stop)
+	zs, err := fn(string(args[1]), int(start), int(stop))
+	c.zReply(zs, withScores, err)
+}
+
+// clampInt keeps Redis-style indexes within the range of an int32 so they
+// convert safely to int.
+func clampInt(n int64) int64 {
+	if n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	if n < math.MinInt32 {
+		return math.MinInt32
+	}
+	return n
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func cmdZRangeByScore(c *conn, args [][]byte) {
+	c.zrangeByScore(args[1], args[2], args[3], args[4:], c.cache().ZRangeByScore)
+}
+
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func cmdZRevRangeByScore(c *conn, args [][]byte) {
+	c.zrangeByScore(args[1], args[3], args[2], args[4:], c.cache().ZRevRangeByScore)
+}
+
+func (c *conn) zrangeByScore(k, min, max []byte, opts [][]byte, fn func(string, gocache.ScoreRange, int, int) ([]gocache.Z, error)) {
+	r, ok := parseScoreRange(min, max)
+	if !ok {
+		c.w.writeError(errMinMax)
+		return
+	}
+	withScores, offset, count, ok := parseRangeOptions(opts, true)
+	if !ok {
+		c.w.writeError(errSyntax)
+		return
+	}
+	zs, err := fn(string(k), r, offset, count)
+	c.zReply(zs, withScores, err)
+}
+
+// ZRANGEBYLEX key min max [LIMIT offset count]
+func cmdZRangeByLex(c *conn, args [][]byte) {
+	r, empty, ok := parseLexRange(args[2], args[3])
+	if !ok {
+		c.w.writeError("ERR min or max not valid string range item")
+		return
+	}
+	_, offset, count, ok := parseRangeOptions(args[4:], false)
+	if !ok {
+		c.w.writeError(errSyntax)
+		return
+	}
+	if empty {
+		c.w.writeArray(0)
+		return
+	}
+	c.stringsReply(c.cache().ZRangeByLex(string(args[1]), r, offset, count))
+}
+
+func cmdZCount(c *conn, args [][]byte) {
+	r, ok := parseScoreRange(args[2], args[3])
+	if !ok {
+		c.w.writeError(errMinMax)
+		return
+	}
+	c.intReply(c.cache().ZCount(string(args[1]), r))
+}
+
+// ZPOPMIN key [count]
+func cmdZPopMin(c *conn, args [][]byte) {
+	c.zpop(args, c.cache().ZPopMin)
+}
+
+// ZPOPMAX key [count]
+func cmdZPopMax(c *conn, args [][]byte) {
+	c.zpop(args, c.cache().ZPopMax)
+}
+
+func (c *conn) zpop(args [][]byte, fn func(string, int) ([]gocache.Z, error)) {
+	count := int64(1)
+	switch len(args) {
+	case 2:
+	case 3:
+		var ok bool
+		count, ok = parseInt(args[2])
+		if !ok || count < 0 {
+			c.w.writeError("ERR value is out of range, must be positive")
+			return
+		}
+	default:
+		c.w.writeError(errSyntax)
+		return
+	}
+	zs, err := fn(string(args[1]), int(clampInt(count)))
+	c.zReply(zs, true, err)
+}
+
+func cmdZRemRangeByScore(c *conn, args [][]byte) {
+	r, ok := parseScoreRange(args[2], args[3])
+	if !ok {
+		c.w.writeError(errMinMax)
+		return
+	}
+	c.intReply(c.cache().ZRemRangeByScore(string(args[1]), r))
+}
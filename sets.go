@@ -0,0 +1,359 @@
+package gocache
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// set is the value stored under a key by SAdd.
+type set map[string]struct{}
+
+func (st set) members() []string {
+	m := make([]string, 0, len(st))
+	for v := range st {
+		m = append(m, v)
+	}
+	return m
+}
+
+// set returns the unexpired set stored under k. It returns ErrWrongType if
+// k holds something else. s.mu must be held.
+func (s *shard) set(k string) (set, bool, error) {
+	item, found := s.item(k)
+	if !found {
+		return nil, false, nil
+	}
+	st, ok := item.Object.(set)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+	return st, true, nil
+}
+
+// SAdd adds members to the set stored under k, creating it if needed, and
+// returns the number of members that were not already present.
+func (c *cache) SAdd(k string, members ...string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	n, evicted, err := c.sadd(s, k, members)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return n, err
+}
+
+// sadd adds members to the set under k. s.mu must be held.
+func (c *cache) sadd(s *shard, k string, members []string) (int, []keyAndValue, error) {
+	item, _ := s.item(k)
+	st, found, err := s.set(k)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !found {
+		st = set{}
+		item = Item{Object: st}
+	}
+	n := 0
+	var delta int64
+	for _, m := range members {
+		if _, ok := st[m]; !ok {
+			st[m] = struct{}{}
+			n++
+			delta += memberCost(m)
+		}
+	}
+	if n == 0 {
+		return 0, nil, nil
+	}
+	c.log(aofRecord{Op: opSAdd, Key: k, Members: members})
+	return n, s.storeDelta(k, item, delta), nil
+}
+
+// SRem removes members from the set stored under k and returns the number
+// that were present. The key is deleted once the set is empty.
+func (c *cache) SRem(k string, members ...string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	n, err := c.srem(s, k, members, "SRem")
+	s.mu.Unlock()
+	return n, err
+}
+
+// srem removes members from the set under k. s.mu must be held.
+func (c *cache) srem(s *shard, k string, members []string, cause string) (int, error) {
+	item, _ := s.item(k)
+	st, found, err := s.set(k)
+	if err != nil || !found {
+		return 0, err
+	}
+	n := 0
+	var delta int64
+	for _, m := range members {
+		if _, ok := st[m]; ok {
+			delete(st, m)
+			n++
+			delta -= memberCost(m)
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	c.log(aofRecord{Op: opSRem, Key: k, Members: members})
+	if len(st) == 0 {
+		c.notifyDelete(s, EventDelete, k, cause)
+		s.delete(k)
+	} else {
+		s.storeDelta(k, item, delta)
+	}
+	return n, nil
+}
+
+// SIsMember reports whether m is a member of the set stored under k.
+func (c *cache) SIsMember(k, m string) (bool, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, found, err := s.set(k)
+	if !found {
+		return false, err
+	}
+	s.touch(k)
+	_, ok := st[m]
+	return ok, nil
+}
+
+// SMembers returns the members of the set stored under k, in no particular
+// order.
+func (c *cache) SMembers(k string) ([]string, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, found, err := s.set(k)
+	if !found {
+		return nil, err
+	}
+	s.touch(k)
+	return st.members(), nil
+}
+
+// SCard returns the number of members of the set stored under k.
+func (c *cache) SCard(k string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, _, err := s.set(k)
+	return len(st), err
+}
+
+// SPop removes and returns up to count random members of the set stored
+// under k.
+func (c *cache) SPop(k string, count int) ([]string, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, found, err := s.set(k)
+	if !found || count <= 0 {
+		return nil, err
+	}
+	popped := randomMembers(st, count)
+	c.srem(s, k, popped, "SPop")
+	return popped, nil
+}
+
+// SRandMember returns random members of the set stored under k without
+// removing them. As in Redis, a positive count returns up to count distinct
+// members and a negative count returns exactly -count members, possibly
+// repeating some.
+func (c *cache) SRandMember(k string, count int) ([]string, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, found, err := s.set(k)
+	if !found || count == 0 {
+		return nil, err
+	}
+	if count > 0 {
+		return randomMembers(st, count), nil
+	}
+	all := st.members()
+	out := make([]string, -count)
+	for i := range out {
+		out[i] = all[rand.Intn(len(all))]
+	}
+	return out, nil
+}
+
+// randomMembers returns up to n distinct members of st chosen uniformly at
+// random.
+func randomMembers(st set, n int) []string {
+	all := st.members()
+	if n >= len(all) {
+		return all
+	}
+	for i := 0; i < n; i++ {
+		j := i + rand.Intn(len(all)-i)
+		all[i], all[j] = all[j], all[i]
+	}
+	return all[:n]
+}
+
+// SMove moves m from the set stored under src to the one stored under dst
+// and reports whether m was moved.
+func (c *cache) SMove(src, dst, m string) (bool, error) {
+	ss := c.shardsFor([]string{src, dst})
+	lockShards(ss)
+	ssrc, sdst := c.shardFor(src), c.shardFor(dst)
+	st, found, err := ssrc.set(src)
+	if err == nil {
+		_, _, err = sdst.set(dst)
+	}
+	if err != nil || !found {
+		unlockShards(ss)
+		return false, err
+	}
+	if _, ok := st[m]; !ok || src == dst {
+		unlockShards(ss)
+		return ok, nil
+	}
+	c.srem(ssrc, src, []string{m}, "SMove")
+	_, evicted, _ := c.sadd(sdst, dst, []string{m})
+	unlockShards(ss)
+	c.evict(evicted)
+	return true, nil
+}
+
+// SInter returns the members present in every set stored under keys. A
+// missing key counts as an empty set.
+func (c *cache) SInter(keys ...string) ([]string, error) {
+	return c.setOp(sinter, keys)
+}
+
+// SUnion returns the members present in any of the sets stored under keys.
+func (c *cache) SUnion(keys ...string) ([]string, error) {
+	return c.setOp(sunion, keys)
+}
+
+// SDiff returns the members of the set stored under the first key that are
+// not in any of the sets stored under the other keys.
+func (c *cache) SDiff(keys ...string) ([]string, error) {
+	return c.setOp(sdiff, keys)
+}
+
+// SInterStore is like SInter, but stores the result under dst, replacing
+// any value, and returns its size. dst is deleted if the result is empty.
+func (c *cache) SInterStore(dst string, keys ...string) (int, error) {
+	return c.setOpStore(sinter, dst, keys, "SInterStore")
+}
+
+// SUnionStore is like SUnion, but stores the result under dst.
+func (c *cache) SUnionStore(dst string, keys ...string) (int, error) {
+	return c.setOpStore(sunion, dst, keys, "SUnionStore")
+}
+
+// SDiffStore is like SDiff, but stores the result under dst.
+func (c *cache) SDiffStore(dst string, keys ...string) (int, error) {
+	return c.setOpStore(sdiff, dst, keys, "SDiffStore")
+}
+
+// setOp reads the sets stored under keys atomically and combines them with
+// fn.
+func (c *cache) setOp(fn func([]set) set, keys []string) ([]string, error) {
+	ss := c.shardsFor(keys)
+	rlockShards(ss)
+	sets, err := c.sets(keys)
+	var r set
+	if err == nil {
+		r = fn(sets)
+	}
+	runlockShards(ss)
+	if err != nil {
+		return nil, err
+	}
+	return r.members(), nil
+}
+
+func (c *cache) setOpStore(fn func([]set) set, dst string, keys []string, cause string) (int, error) {
+	ss := c.shardsFor(append([]string{dst}, keys...))
+	lockShards(ss)
+	sets, err := c.sets(keys)
+	if err != nil {
+		unlockShards(ss)
+		return 0, err
+	}
+	r := fn(sets)
+	s := c.shardFor(dst)
+	var evicted []keyAndValue
+	if len(r) == 0 {
+		c.notifyDelete(s, EventDelete, dst, cause)
+		if v, ok := s.delete(dst); ok {
+			evicted = append(evicted, keyAndValue{dst, v})
+		}
+	} else {
+		item := Item{Object: r}
+		e := newSnapshotEntry(dst, item)
+		c.log(aofRecord{Op: opRestore, Key: dst, Entry: &e})
+		evicted = s.store(dst, item)
+	}
+	unlockShards(ss)
+	c.evict(evicted)
+	return len(r), nil
+}
+
+// sets returns the sets stored under keys, with nil for missing keys. The
+// shards owning keys must be locked.
+func (c *cache) sets(keys []string) ([]set, error) {
+	sets := make([]set, len(keys))
+	for i, k := range keys {
+		st, _, err := c.shardFor(k).set(k)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = st
+	}
+	return sets, nil
+}
+
+func sinter(sets []set) set {
+	if len(sets) == 0 {
+		return set{}
+	}
+	// Iterate over the smallest set.
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	r := set{}
+outer:
+	for m := range sets[0] {
+		for _, st := range sets[1:] {
+			if _, ok := st[m]; !ok {
+				continue outer
+			}
+		}
+		r[m] = struct{}{}
+	}
+	return r
+}
+
+func sunion(sets []set) set {
+	r := set{}
+	for _, st := range sets {
+		for m := range st {
+			r[m] = struct{}{}
+		}
+	}
+	return r
+}
+
+func sdiff(sets []set) set {
+	r := set{}
+	if len(sets) == 0 {
+		return r
+	}
+outer:
+	for m := range sets[0] {
+		for _, st := range sets[1:] {
+			if _, ok := st[m]; ok {
+				continue outer
+			}
+		}
+		r[m] = struct{}{}
+	}
+	return r
+}
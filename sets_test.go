@@ -0,0 +1,173 @@
+package gocache
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func sorted(m []string) []string {
+	sort.Strings(m)
+	return m
+}
+
+func TestCache_SAdd_SRem(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if n, err := tc.SAdd("s", "a", "b", "a"); err != nil || n != 2 {
+		t.Error("SAdd:", n, err)
+	}
+	if n, _ := tc.SAdd("s", "b", "c"); n != 1 {
+		t.Error("SAdd should count only new members, got", n)
+	}
+	if n, err := tc.SAdd("empty"); n != 0 || err != nil || tc.ItemCount() != 1 {
+		t.Error("SAdd without members should not create a set:", n, err)
+	}
+	if n, _ := tc.SCard("s"); n != 3 {
+		t.Error("SCard:", n)
+	}
+	if ok, _ := tc.SIsMember("s", "c"); !ok {
+		t.Error("c should be a member")
+	}
+	if ok, _ := tc.SIsMember("s", "z"); ok {
+		t.Error("z should not be a member")
+	}
+	if m, _ := tc.SMembers("s"); !reflect.DeepEqual(sorted(m), []string{"a", "b", "c"}) {
+		t.Error("SMembers:", m)
+	}
+	if n, _ := tc.SRem("s", "a", "z"); n != 1 {
+		t.Error("SRem should count only removed members, got", n)
+	}
+	tc.SRem("s", "b", "c")
+	if _, found := tc.Get("s"); found {
+		t.Error("an empty set should be deleted")
+	}
+
+	tc.Set("str", "x", DefaultExpiration)
+	if _, err := tc.SAdd("str", "a"); err != ErrWrongType {
+		t.Error("SAdd to a string should fail, got", err)
+	}
+	if _, err := tc.SMembers("str"); err != ErrWrongType {
+		t.Error("SMembers of a string should fail, got", err)
+	}
+}
+
+func TestCache_SAdd_Expiration(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.SAdd("s", "a")
+	tc.SetExpiration("s", 10*time.Millisecond)
+	<-time.After(20 * time.Millisecond)
+	if n, _ := tc.SCard("s"); n != 0 {
+		t.Error("an expired set should be empty, got", n)
+	}
+	if n, _ := tc.SAdd("s", "b"); n != 1 {
+		t.Error("SAdd to an expired set should start a new one")
+	}
+	if d, _ := tc.TTL("s"); d != NoExpiration {
+		t.Error("a new set should not inherit the old expiration:", d)
+	}
+	tc.SetExpiration("s", time.Hour)
+	tc.SAdd("s", "c")
+	if d, _ := tc.TTL("s"); d <= 0 {
+		t.Error("SAdd should keep the expiration of an existing set:", d)
+	}
+}
+
+func TestCache_SPop_SRandMember(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.SAdd("s", "a", "b", "c", "d")
+	popped, _ := tc.SPop("s", 3)
+	if len(popped) != 3 {
+		t.Fatal("SPop returned", popped)
+	}
+	for _, m := range popped {
+		if ok, _ := tc.SIsMember("s", m); ok {
+			t.Error("popped member is still in the set:", m)
+		}
+	}
+	if n, _ := tc.SCard("s"); n != 1 {
+		t.Error("SCard after SPop:", n)
+	}
+	tc.SPop("s", 5)
+	if _, found := tc.Get("s"); found {
+		t.Error("popping every member should delete the set")
+	}
+
+	tc.SAdd("r", "a", "b", "c")
+	if m, _ := tc.SRandMember("r", 10); len(m) != 3 {
+		t.Error("SRandMember with a large count should return every member:", m)
+	}
+	if m, _ := tc.SRandMember("r", 2); len(m) != 2 || m[0] == m[1] {
+		t.Error("SRandMember should return distinct members:", m)
+	}
+	if m, _ := tc.SRandMember("r", -5); len(m) != 5 {
+		t.Error("SRandMember with a negative count should return exactly -count members:", m)
+	}
+	if n, _ := tc.SCard("r"); n != 3 {
+		t.Error("SRandMember should not remove members")
+	}
+}
+
+func TestCache_SMove(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	tc.SAdd("src", "a", "b")
+	if ok, _ := tc.SMove("src", "dst", "a"); !ok {
+		t.Error("SMove did not move a")
+	}
+	if ok, _ := tc.SMove("src", "dst", "z"); ok {
+		t.Error("SMove moved a missing member")
+	}
+	if ok, _ := tc.SIsMember("dst", "a"); !ok {
+		t.Error("a is not in dst")
+	}
+	tc.SMove("src", "dst", "b")
+	if _, found := tc.Get("src"); found {
+		t.Error("src should be deleted once empty")
+	}
+	tc.Set("str", "x", DefaultExpiration)
+	if _, err := tc.SMove("dst", "str", "a"); err != ErrWrongType {
+		t.Error("SMove to a string should fail, got", err)
+	}
+	if ok, _ := tc.SIsMember("dst", "a"); !ok {
+		t.Error("a failed SMove should leave the source untouched")
+	}
+}
+
+func TestCache_SInter_SUnion_SDiff(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	tc.SAdd("a", "1", "2", "3", "4")
+	tc.SAdd("b", "2", "3", "5")
+	tc.SAdd("c", "3", "4", "6")
+	if m, _ := tc.SInter("a", "b", "c"); !reflect.DeepEqual(sorted(m), []string{"3"}) {
+		t.Error("SInter:", m)
+	}
+	if m, _ := tc.SInter("a", "missing"); len(m) != 0 {
+		t.Error("SInter with a missing key should be empty:", m)
+	}
+	if m, _ := tc.SUnion("b", "c", "missing"); !reflect.DeepEqual(sorted(m), []string{"2", "3", "4", "5", "6"}) {
+		t.Error("SUnion:", m)
+	}
+	if m, _ := tc.SDiff("a", "b", "c"); !reflect.DeepEqual(sorted(m), []string{"1"}) {
+		t.Error("SDiff:", m)
+	}
+
+	if n, _ := tc.SInterStore("dst", "a", "b"); n != 2 {
+		t.Error("SInterStore:", n)
+	}
+	if m, _ := tc.SMembers("dst"); !reflect.DeepEqual(sorted(m), []string{"2", "3"}) {
+		t.Error("SInterStore stored", m)
+	}
+	if n, _ := tc.SUnionStore("dst", "dst", "c"); n != 4 {
+		t.Error("SUnionStore with dst as a source:", n)
+	}
+	if n, _ := tc.SDiffStore("dst", "a", "a"); n != 0 {
+		t.Error("SDiffStore:", n)
+	}
+	if _, found := tc.Get("dst"); found {
+		t.Error("an empty result should delete dst")
+	}
+	tc.Set("str", "x", DefaultExpiration)
+	if _, err := tc.SUnion("a", "str"); err != ErrWrongType {
+		t.Error("SUnion with a string should fail, got", err)
+	}
+}
@@ -0,0 +1,262 @@
+package gocache
+
+import (
+	"sync"
+	"time"
+)
+
+// shard is an independently locked partition of a cache's key space. Each
+// shard enforces its share of MaxEntries and MaxCost with its own eviction
+// policy.
+type shard struct {
+	c          *cache
+	mu         sync.RWMutex
+	items      map[string]Item
+	maxEntries int
+	maxCost    int64
+	cost       int64
+	policy     EvictionPolicy
+	// waiters holds the goroutines blocked in BLPop, BRPop and BLMove on
+	// each key, oldest first.
+	waiters map[string][]*waiter
+	// readers holds the channels of the goroutines blocked in XRead and
+	// XReadGroup on each key.
+	readers map[string][]chan struct{}
+	// lastVersion is the last version given to a key written in the shard.
+	lastVersion uint64
+	// removed is the version given to the last key removed from the
+	// shard, the tombstone Watch records for missing keys.
+	removed uint64
+}
+
+// shardFor returns the shard owning k.
+func (c *cache) shardFor(k string) *shard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[hashKey(k)&c.mask]
+}
+
+// store writes item under k and, if the shard is bounded, evicts the items
+// chosen by the eviction policy until it fits again. The caller must hold
+// s.mu and pass the returned items to evict once it has been released.
+func (s *shard) store(k string, item Item) []keyAndValue {
+	if s.maxCost > 0 {
+		item.cost = s.c.sizer(item.Object)
+	}
+	return s.storeItem(k, item)
+}
+
+// storeItem is store without re-estimating the cost of item.
+func (s *shard) storeItem(k string, item Item) []keyAndValue {
+	if old, found := s.items[k]; found {
+		s.cost -= old.cost
+	}
+	item.version = s.nextVersion()
+	s.items[k] = item
+	s.cost += item.cost
+	if s.policy == nil {
+		return nil
+	}
+	s.policy.Insert(k)
+	if s.c.replaying {
+		return nil
+	}
+	return s.shrink()
+}
+
+// storeDelta is store for a hash, list, set, sorted set or stream changed
+// in place, whose cost DefaultSizer estimates to have changed by delta, so
+// that large values are not measured again on every change. A new value,
+// with no cost yet, or any value if a custom Sizer is set, is measured by
+// store.
+func (s *shard) storeDelta(k string, item Item, delta int64) []keyAndValue {
+	if item.cost == 0 || s.c.customSizer {
+		return s.store(k, item)
+	}
+	item.cost += delta
+	return s.storeItem(k, item)
+}
+
+// nextVersion returns a new version for a key being written, so that
+// watchers can tell it changed. s.mu must be held.
+func (s *shard) nextVersion() uint64 {
+	s.lastVersion++
+	return s.lastVersion
+}
+
+// shrink evicts items until the shard is within its bounds.
+func (s *shard) shrink() []keyAndValue {
+	if s.policy == nil {
+		return nil
+	}
+	var evicted []keyAndValue
+	for s.overCapacity() {
+		victim, ok := s.policy.Victim()
+		if !ok {
+			break
+		}
+		s.c.notifyDelete(s, EventEvict, victim, "")
+		if v, ok := s.delete(victim); ok {
+			evicted = append(evicted, keyAndValue{victim, v})
+		}
+	}
+	return evicted
+}
+
+func (s *shard) overCapacity() bool {
+	return (s.maxEntries > 0 && len(s.items) > s.maxEntries) ||
+		(s.maxCost > 0 && s.cost > s.maxCost)
+}
+
+// touch records a read of k for the eviction policy.
+func (s *shard) touch(k string) {
+	if s.policy != nil {
+		s.policy.Access(k)
+	}
+}
+
+func (s *shard) get(k string) (any, bool) {
+	item, found := s.items[k]
+	if !found {
+		return nil, false
+	}
+
+	if item.Expiration > 0 {
+		if time.Now().UnixNano() > item.Expiration {
+			return nil, false
+		}
+	}
+	if isCachedError(item) {
+		return nil, false
+	}
+	s.touch(k)
+	return item.Object, true
+}
+
+func (s *shard) delete(k string) (any, bool) {
+	v, found := s.items[k]
+	if !found {
+		return nil, false
+	}
+	delete(s.items, k)
+	s.removed = s.nextVersion()
+	s.cost -= v.cost
+	s.c.log(aofRecord{Op: opDel, Key: k})
+	if s.policy != nil {
+		s.policy.Remove(k)
+	}
+	if s.c.onEvicted != nil {
+		return v.Object, true
+	}
+	return nil, false
+}
+
+func (s *shard) deleteExpired(now int64) []keyAndValue {
+	var evictedItems []keyAndValue
+	s.mu.Lock()
+	for k, v := range s.items {
+		// "Inlining" of expired, keeping the items MemoizeCtx may serve stale
+		expired := v.Expiration > 0 && now > v.Expiration && now > v.staleUntil
+		if h, ok := v.Object.(*hash); ok && !expired && h.purge(now) {
+			if len(h.fields) > 0 {
+				s.resize(k, v)
+				continue
+			}
+			expired = true
+		}
+		if expired {
+			s.c.notifyDelete(s, EventExpire, k, "")
+			ov, evicted := s.delete(k)
+			if evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			}
+		}
+	}
+	s.mu.Unlock()
+	return evictedItems
+}
+
+// resize re-estimates the cost of the item under k after its value shrank
+// in place, and gives it a new version. s.mu must be held.
+func (s *shard) resize(k string, item Item) {
+	item.version = s.nextVersion()
+	if s.maxCost > 0 {
+		cost := s.c.sizer(item.Object)
+		s.cost += cost - item.cost
+		item.cost = cost
+	}
+	s.items[k] = item
+}
+
+// clear deletes every item in the shard. s.mu must be held.
+func (s *shard) clear() {
+	s.items = map[string]Item{}
+	s.removed = s.nextVersion()
+	s.cost = 0
+	if s.policy != nil {
+		s.policy.Reset()
+	}
+}
+
+// item returns the unexpired item stored under k. An error cached by
+// MemoizeCtx is not a value and is reported as missing. s.mu must be held.
+func (s *shard) item(k string) (Item, bool) {
+	item, found := s.memoized(k)
+	if !found || isCachedError(item) {
+		return Item{}, false
+	}
+	return item, true
+}
+
+// memoized is like item but also returns cached errors. s.mu must be held.
+func (s *shard) memoized(k string) (Item, bool) {
+	item, found := s.items[k]
+	if !found || (item.Expiration > 0 && s.c.now() > item.Expiration) {
+		return Item{}, false
+	}
+	return item, true
+}
+
+// shardsFor returns the distinct shards owning keys in index order. Multi-key
+// operations lock them in this order so they cannot deadlock each other.
+func (c *cache) shardsFor(keys []string) []*shard {
+	if len(c.shards) == 1 {
+		return c.shards
+	}
+	owned := make([]bool, len(c.shards))
+	for _, k := range keys {
+		owned[hashKey(k)&c.mask] = true
+	}
+	var ss []*shard
+	for i, s := range c.shards {
+		if owned[i] {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+func lockShards(ss []*shard) {
+	for _, s := range ss {
+		s.mu.Lock()
+	}
+}
+
+func unlockShards(ss []*shard) {
+	for _, s := range ss {
+		s.mu.Unlock()
+	}
+}
+
+func rlockShards(ss []*shard) {
+	for _, s := range ss {
+		s.mu.RLock()
+	}
+}
+
+func runlockShards(ss []*shard) {
+	for _, s := range ss {
+		s.mu.RUnlock()
+	}
+}
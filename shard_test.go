@@ -0,0 +1,86 @@
+package gocache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_Shards(t *testing.T) {
+	tc := NewCache(Config{Shards: 6})
+	if len(tc.shards) != 8 {
+		t.Fatal("shard count should be rounded up to 8, got", len(tc.shards))
+	}
+	for i := 0; i < 1000; i++ {
+		tc.Set(fmt.Sprint(i), i, DefaultExpiration)
+	}
+	for _, s := range tc.shards {
+		if len(s.items) == 0 {
+			t.Error("keys were not spread over every shard")
+		}
+	}
+	if tc.ItemCount() != 1000 {
+		t.Error("count error :", tc.ItemCount())
+	}
+	items := tc.Items()
+	if len(items) != 1000 || items["999"].Object.(int) != 999 {
+		t.Error("Items did not collect every shard")
+	}
+	for i := 0; i < 1000; i++ {
+		if x, found := tc.Get(fmt.Sprint(i)); !found || x.(int) != i {
+			t.Fatal("lost key", i)
+		}
+	}
+	tc.Flush()
+	if tc.ItemCount() != 0 {
+		t.Error("Flush error")
+	}
+}
+
+func TestCache_Shards_Expiration(t *testing.T) {
+	tc := NewCache(Config{Shards: 4, DefaultExpiration: 10 * time.Millisecond})
+	evicted := 0
+	tc.OnEvicted(func(string, any) { evicted++ })
+	for i := 0; i < 100; i++ {
+		tc.Set(fmt.Sprint(i), i, DefaultExpiration)
+	}
+	tc.Set("forever", 1, NoExpiration)
+	<-time.After(20 * time.Millisecond)
+	tc.DeleteExpired()
+	if tc.ItemCount() != 1 || evicted != 100 {
+		t.Error("DeleteExpired missed a shard:", tc.ItemCount(), evicted)
+	}
+}
+
+func TestCache_Shards_MaxEntries(t *testing.T) {
+	tc := NewCache(Config{Shards: 4, MaxEntries: 100})
+	for i := 0; i < 1000; i++ {
+		tc.Set(fmt.Sprint(i), i, DefaultExpiration)
+	}
+	if n := tc.ItemCount(); n > 100 {
+		t.Error("count over limit :", n)
+	}
+}
+
+func TestCache_Shards_Concurrent(t *testing.T) {
+	tc := NewCache(Config{Shards: 16})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := fmt.Sprint(g, "-", i)
+				tc.Set(k, i, DefaultExpiration)
+				tc.Get(k)
+				tc.HSet("h", k, i)
+				tc.LPush("l", i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if tc.ItemCount() != 8*1000+2 {
+		t.Error("count error :", tc.ItemCount())
+	}
+}
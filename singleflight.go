@@ -2,23 +2,72 @@ package gocache
 
 //from https://github.com/golang/sync/blob/master/singleflight/singleflight.go
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
+// errGoexit indicates the runtime.Goexit was called in
+// the user given function.
+var errGoexit = errors.New("runtime.Goexit was called")
+
+// A panicError is an arbitrary value recovered from a panic
+// with the stack trace during the execution of given function.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+// Error implements error interface.
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+func (p *panicError) Unwrap() error {
+	err, ok := p.value.(error)
+	if !ok {
+		return nil
+	}
+	return err
+}
+
+func newPanicError(v any) error {
+	stack := debug.Stack()
+
+	// The first line of the stack trace is of the form "goroutine N [status]:"
+	// but by the time the panic reaches Do the goroutine may no longer exist
+	// and its status will have changed. Trim out the misleading line.
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &panicError{value: v, stack: stack}
+}
+
 // call is an in-flight or completed singleflight.Do call
 type call[T any] struct {
-	wg sync.WaitGroup
-	// These fields are written once before the WaitGroup is done
-	// and are only read after the WaitGroup is done.
+	// done is closed once the call completes.
+	done    chan struct{}
+	started time.Time
+	// These fields are written once before done is closed
+	// and are only read after done is closed.
 	val T
 	err error
 	// These fields are read and written with the singleflight
-	// mutex held before the WaitGroup is done, and are read but
-	// not written after the WaitGroup is done.
+	// mutex held before done is closed, and are read but
+	// not written after done is closed.
 	dups  int
 	chans []chan<- Result[T]
 }
 
+func newCall[T any]() *call[T] {
+	return &call[T]{done: make(chan struct{}), started: time.Now()}
+}
+
 // Group represents a class of work and forms a namespace in
 // which units of work can be executed with duplicate suppression.
 type Group[K comparable, V any] struct {
@@ -34,11 +83,21 @@ type Result[T any] struct {
 	Shared bool
 }
 
+// CallStats describes a call in flight.
+type CallStats struct {
+	// Waiters is the number of callers waiting for the call besides the
+	// one that started it.
+	Waiters int
+	// Started is when the call started.
+	Started time.Time
+}
+
 // Do executes and returns the results of the given function, making
 // sure that only one execution is in-flight for a given key at a
 // time. If a duplicate comes in, the duplicate caller waits for the
 // original to complete and receives the same results.
 // The return value shared indicates whether v was given to multiple callers.
+// If fn panics or calls runtime.Goexit, so do the callers waiting for it.
 func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
 	g.mu.Lock()
 	if g.m == nil {
@@ -47,19 +106,59 @@ func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bo
 	if c, ok := g.m[key]; ok {
 		c.dups++
 		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err, true
+		<-c.done
+		return c.result()
 	}
-	c := new(call[V])
-	c.wg.Add(1)
+	c := newCall[V]()
 	g.m[key] = c
 	g.mu.Unlock()
 	g.doCall(c, key, fn)
 	return c.val, c.err, c.dups > 0
 }
 
+// DoCtx is like Do, but fn is given ctx, and a duplicate caller whose
+// context is done stops waiting and returns its error. The caller that runs
+// fn waits for it, and its ctx is the one given to fn.
+func (g *Group[K, V]) DoCtx(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.result()
+		case <-ctx.Done():
+			g.mu.Lock()
+			c.dups--
+			g.mu.Unlock()
+			return v, ctx.Err(), false
+		}
+	}
+	c := newCall[V]()
+	g.m[key] = c
+	g.mu.Unlock()
+	g.doCall(c, key, func() (V, error) { return fn(ctx) })
+	return c.val, c.err, c.dups > 0
+}
+
+// result returns the results of the completed call to a duplicate caller,
+// re-raising the panic or Goexit of fn.
+func (c *call[T]) result() (T, error, bool) {
+	if e, ok := c.err.(*panicError); ok {
+		panic(e)
+	} else if c.err == errGoexit {
+		runtime.Goexit()
+	}
+	return c.val, c.err, true
+}
+
 // DoChan is like Do but returns a channel that will receive the
 // results when they are ready.
+//
+// The returned channel will not be closed.
 func (g *Group[K, V]) DoChan(key K, fn func() (V, error)) <-chan Result[V] {
 	ch := make(chan Result[V], 1)
 	g.mu.Lock()
@@ -72,8 +171,8 @@ func (g *Group[K, V]) DoChan(key K, fn func() (V, error)) <-chan Result[V] {
 		g.mu.Unlock()
 		return ch
 	}
-	c := &call[V]{chans: []chan<- Result[V]{ch}}
-	c.wg.Add(1)
+	c := newCall[V]()
+	c.chans = []chan<- Result[V]{ch}
 	g.m[key] = c
 	g.mu.Unlock()
 	go g.doCall(c, key, fn)
@@ -82,13 +181,106 @@ func (g *Group[K, V]) DoChan(key K, fn func() (V, error)) <-chan Result[V] {
 
 // doCall handles the single call for a key.
 func (g *Group[K, V]) doCall(c *call[V], key K, fn func() (V, error)) {
-	c.val, c.err = fn()
-	c.wg.Done()
+	normalReturn := false
+	recovered := false
+
+	// use double-defer to distinguish panic from runtime.Goexit,
+	// more details see https://golang.org/cl/134395
+	defer func() {
+		// the given function invoked runtime.Goexit
+		if !normalReturn && !recovered {
+			c.err = errGoexit
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		close(c.done)
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+
+		if e, ok := c.err.(*panicError); ok {
+			// In order to prevent the waiting channels from being blocked forever,
+			// needs to ensure that this panic cannot be recovered.
+			if len(c.chans) > 0 {
+				go panic(e)
+				select {} // Keep this goroutine around so that it will appear in the crash dump.
+			} else {
+				panic(e)
+			}
+		} else if c.err == errGoexit {
+			// Already in the process of goexit, no need to call again
+		} else {
+			// Normal return
+			for _, ch := range c.chans {
+				ch <- Result[V]{c.val, c.err, c.dups > 0}
+			}
+		}
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				// Ideally, we would wait to take a stack trace until we've determined
+				// whether this is a panic or a runtime.Goexit.
+				//
+				// Unfortunately, the only way we can distinguish the two is to see
+				// whether the recover stopped the goroutine from terminating, and by
+				// the time we know that, the part of the stack trace relevant to the
+				// panic has been discarded.
+				if r := recover(); r != nil {
+					c.err = newPanicError(r)
+				}
+			}
+		}()
+
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// claim returns the in-flight call for key, starting one if there is none,
+// and whether it did. The caller that started a call must complete it with
+// release; the others wait for c.done to be closed.
+func (g *Group[K, V]) claim(key K) (c *call[V], started bool) {
 	g.mu.Lock()
-	delete(g.m, key)
+	defer g.mu.Unlock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		return c, false
+	}
+	c = newCall[V]()
+	g.m[key] = c
+	return c, true
+}
+
+// release completes the call for key started by claim with v and err.
+func (g *Group[K, V]) release(key K, c *call[V], v V, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.val, c.err = v, err
+	close(c.done)
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
 	for _, ch := range c.chans {
 		ch <- Result[V]{c.val, c.err, c.dups > 0}
 	}
+}
+
+// Forget tells the singleflight to forget about a key. Future calls
+// to Do for this key will call the function rather than waiting for
+// an earlier call to complete.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	delete(g.m, key)
 	g.mu.Unlock()
 }
 
@@ -110,3 +302,14 @@ func (g *Group[K, V]) ForgetUnshared(key K) bool {
 	}
 	return false
 }
+
+// Stats returns the calls in flight, by key.
+func (g *Group[K, V]) Stats() map[K]CallStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := make(map[K]CallStats, len(g.m))
+	for k, c := range g.m {
+		stats[k] = CallStats{Waiters: c.dups, Started: c.started}
+	}
+	return stats
+}
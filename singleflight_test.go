@@ -0,0 +1,196 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_Do(t *testing.T) {
+	var g Group[string, string]
+	v, err, _ := g.Do("key", func() (string, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Errorf("Do = %v; %v", v, err)
+	}
+
+	someErr := errors.New("some error")
+	_, err, _ = g.Do("key", func() (string, error) {
+		return "", someErr
+	})
+	if err != someErr {
+		t.Errorf("Do error = %v; want someErr", err)
+	}
+}
+
+func TestGroup_DoDupSuppress(t *testing.T) {
+	var g Group[string, int]
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 1, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err, _ := g.Do("key", fn); v != 1 || err != nil {
+				t.Errorf("Do = %v; %v", v, err)
+			}
+		}()
+	}
+	for g.Stats()["key"].Waiters < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("number of calls = %d; want 1", got)
+	}
+}
+
+func TestGroup_Forget(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	ch := g.DoChan("key", func() (int, error) {
+		<-release
+		return 1, nil
+	})
+	for len(g.Stats()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	g.Forget("key")
+	if v, _, shared := g.Do("key", func() (int, error) { return 2, nil }); v != 2 || shared {
+		t.Errorf("Do after Forget = %v, shared %v; want a new call", v, shared)
+	}
+	close(release)
+	if r := <-ch; r.Val != 1 {
+		t.Errorf("the forgotten call returned %v", r.Val)
+	}
+}
+
+func TestGroup_PanicDo(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	fn := func() (int, error) {
+		<-release
+		panic("boom")
+	}
+
+	const n = 5
+	panics := make(chan any, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { panics <- recover() }()
+			g.Do("key", fn)
+		}()
+	}
+	for g.Stats()["key"].Waiters < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(panics)
+	for p := range panics {
+		if _, ok := p.(*panicError); !ok {
+			t.Errorf("every caller should panic with the panic of fn, got %v", p)
+		}
+	}
+	if len(g.Stats()) != 0 {
+		t.Error("a panicking call was not removed")
+	}
+}
+
+func TestGroup_GoexitDo(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	fn := func() (int, error) {
+		<-release
+		runtime.Goexit()
+		return 0, nil
+	}
+
+	const n = 5
+	var returned int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Do("key", fn)
+			atomic.AddInt32(&returned, 1)
+		}()
+	}
+	for g.Stats()["key"].Waiters < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if returned != 0 {
+		t.Errorf("%d callers returned after runtime.Goexit in fn", returned)
+	}
+}
+
+func TestGroup_DoCtx(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	done := make(chan int)
+	go func() {
+		v, _, _ := g.DoCtx(context.Background(), "key", func(ctx context.Context) (int, error) {
+			<-release
+			return 1, nil
+		})
+		done <- v
+	}()
+	for len(g.Stats()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err, _ := g.DoCtx(ctx, "key", func(ctx context.Context) (int, error) {
+		t.Error("a duplicate call ran fn")
+		return 0, nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("DoCtx error = %v; want the context error", err)
+	}
+	if w := g.Stats()["key"].Waiters; w != 0 {
+		t.Errorf("a caller that left is still counted: %d waiters", w)
+	}
+
+	close(release)
+	if v := <-done; v != 1 {
+		t.Errorf("DoCtx = %v", v)
+	}
+}
+
+func TestGroup_Stats(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		g.DoChan("key", func() (int, error) {
+			<-release
+			return 0, nil
+		})
+	}
+	st, ok := g.Stats()["key"]
+	if !ok || st.Waiters != 1 || st.Started.Before(start) {
+		t.Errorf("Stats = %+v, %v", st, ok)
+	}
+	close(release)
+}
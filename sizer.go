@@ -0,0 +1,107 @@
+package gocache
+
+// Rough per-value overheads, in bytes, used by DefaultSizer.
+const (
+	ifaceSize    = 16 // an interface value
+	headerSize   = 24 // a slice or string header plus padding
+	mapEntrySize = 48 // a map bucket slot, including the key header
+	zsetNodeSize = 64 // a skiplist node with its average level slice
+)
+
+// DefaultSizer estimates the memory held by x. It understands strings, byte
+// slices, numbers, and the hashes, lists, sets and sorted sets created by
+// HSet, LPush, SAdd, ZAdd and XAdd; for other types it returns a fixed
+// interface-sized cost.
+func DefaultSizer(x any) int64 {
+	switch v := x.(type) {
+	case nil:
+		return 0
+	case string:
+		return headerSize + int64(len(v))
+	case []byte:
+		return headerSize + int64(cap(v))
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, uintptr, float64:
+		return 8
+	case map[string]any:
+		n := int64(mapEntrySize)
+		for f, fv := range v {
+			n += mapEntrySize + int64(len(f)) + ifaceSize + DefaultSizer(fv)
+		}
+		return n
+	case *hash:
+		n := int64(mapEntrySize)
+		for f := range v.fields {
+			n += v.fieldCost(f)
+		}
+		return n
+	case set:
+		n := int64(mapEntrySize)
+		for m := range v {
+			n += memberCost(m)
+		}
+		return n
+	case *zset:
+		n := int64(mapEntrySize + zsetNodeSize)
+		for m := range v.dict {
+			n += zmemberCost(m)
+		}
+		return n
+	case *stream:
+		n := int64(headerSize + mapEntrySize)
+		for _, m := range v.entries {
+			n += entryCost(m.Values)
+		}
+		for name, g := range v.groups {
+			n += mapEntrySize + int64(len(name)) + int64(len(g.pending))*(mapEntrySize+48)
+		}
+		return n
+	case *deque:
+		n := int64(headerSize)
+		for i := 0; i < v.Len(); i++ {
+			n += elementCost(v.at(i))
+		}
+		return n
+	default:
+		return ifaceSize
+	}
+}
+
+// The costs DefaultSizer gives to the parts of hashes, lists, sets, sorted
+// sets and streams, so that changes to them can be accounted for without
+// measuring them again.
+
+// fieldCost returns the cost of the field f of h, with its TTL, or 0 if it
+// does not exist.
+func (h *hash) fieldCost(f string) int64 {
+	x, ok := h.fields[f]
+	if !ok {
+		return 0
+	}
+	n := mapEntrySize + int64(len(f)) + ifaceSize + DefaultSizer(x)
+	if _, ok := h.expires[f]; ok {
+		n += mapEntrySize + 8
+	}
+	return n
+}
+
+func memberCost(m string) int64 {
+	return mapEntrySize + int64(len(m))
+}
+
+func zmemberCost(m string) int64 {
+	return mapEntrySize + zsetNodeSize + int64(len(m))
+}
+
+func elementCost(x any) int64 {
+	return ifaceSize + DefaultSizer(x)
+}
+
+func entryCost(values map[string]any) int64 {
+	return 16 + DefaultSizer(values) // the ID and the values
+}
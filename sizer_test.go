@@ -0,0 +1,136 @@
+package gocache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultSizer(t *testing.T) {
+	if n := DefaultSizer("abc"); n != headerSize+3 {
+		t.Error("string size:", n)
+	}
+	if n := DefaultSizer(make([]byte, 10, 100)); n != headerSize+100 {
+		t.Error("[]byte should be charged for its capacity:", n)
+	}
+	if n := DefaultSizer(int64(1)); n != 8 {
+		t.Error("int64 size:", n)
+	}
+	h := map[string]any{"f": "v"}
+	if n := DefaultSizer(h); n != 2*mapEntrySize+1+ifaceSize+headerSize+1 {
+		t.Error("hash size:", n)
+	}
+	hh := newHash()
+	hh.set("f", "v")
+	hh.expire("f", 1)
+	if n := DefaultSizer(hh); n != 2*mapEntrySize+1+ifaceSize+headerSize+1+mapEntrySize+8 {
+		t.Error("hash with a field TTL size:", n)
+	}
+	l := newDeque("v")
+	if n := DefaultSizer(l); n != headerSize+ifaceSize+headerSize+1 {
+		t.Error("list size:", n)
+	}
+	if n := DefaultSizer(set{"ab": {}}); n != 2*mapEntrySize+2 {
+		t.Error("set size:", n)
+	}
+	z := newZSet()
+	z.set("ab", 1)
+	if n := DefaultSizer(z); n != 2*(mapEntrySize+zsetNodeSize)+2 {
+		t.Error("sorted set size:", n)
+	}
+	st := newStream()
+	st.add(StreamID{1, 0}, map[string]any{"f": "v"})
+	st.groups["g"] = newStreamGroup(MinStreamID)
+	st.groups["g"].deliver([]StreamID{{1, 0}}, "c", 0, false)
+	if n := DefaultSizer(st); n != headerSize+mapEntrySize+16+2*mapEntrySize+1+ifaceSize+headerSize+1+mapEntrySize+1+mapEntrySize+48 {
+		t.Error("stream size:", n)
+	}
+}
+
+func TestCache_MaxCost(t *testing.T) {
+	tc := NewCache(Config{MaxCost: 100})
+	var evicted []string
+	tc.OnEvicted(func(k string, v any) {
+		evicted = append(evicted, k)
+	})
+	tc.SetWithCost("a", "x", 40, DefaultExpiration)
+	tc.SetWithCost("b", "y", 40, DefaultExpiration)
+	tc.Get("a")
+	tc.SetWithCost("c", "z", 40, DefaultExpiration)
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Error("unexpected evictions:", evicted)
+	}
+	if tc.Cost() != 80 {
+		t.Error("cost error :", tc.Cost())
+	}
+	// Overwriting replaces the old cost rather than adding to it.
+	tc.SetWithCost("a", "x", 10, DefaultExpiration)
+	if tc.Cost() != 50 {
+		t.Error("cost error after overwrite :", tc.Cost())
+	}
+	tc.Delete("c")
+	if tc.Cost() != 10 {
+		t.Error("cost error after delete :", tc.Cost())
+	}
+	tc.SetWithCost("huge", "x", 1000, DefaultExpiration)
+	if _, found := tc.Get("huge"); found {
+		t.Error("an item larger than MaxCost should not be kept")
+	}
+	tc.Flush()
+	if tc.Cost() != 0 {
+		t.Error("cost error after flush :", tc.Cost())
+	}
+}
+
+func TestCache_MaxCost_Sizer(t *testing.T) {
+	tc := NewCache(Config{MaxCost: 1000})
+	tc.Set("small", "x", DefaultExpiration)
+	tc.Set("big", strings.Repeat("x", 990), DefaultExpiration)
+	if _, found := tc.Get("small"); found {
+		t.Error("small should have been evicted to make room for big")
+	}
+	if tc.Cost() > 1000 {
+		t.Error("cost over limit :", tc.Cost())
+	}
+
+	tc = NewCache(Config{MaxCost: 10, Sizer: func(any) int64 { return 1 }})
+	for i := 0; i < 20; i++ {
+		tc.HSet("h", strings.Repeat("f", i+1), i)
+		tc.LPush(strings.Repeat("l", i+1), i)
+	}
+	if tc.ItemCount() != 10 {
+		t.Error("count error :", tc.ItemCount())
+	}
+}
+
+func TestCache_MaxCost_Incremental(t *testing.T) {
+	tc := NewCache(Config{MaxCost: 1 << 30})
+	for i := 0; i < 50; i++ {
+		v := strings.Repeat("v", i)
+		tc.HSet("h", "f"+v, v)
+		tc.HIncrBy("h", "n", 1)
+		tc.LPush("l", v)
+		tc.RPush("l", i)
+		tc.SAdd("s", v, "x")
+		tc.ZAdd("z", 0, Z{v, float64(i)})
+		tc.XAdd("x", XAddArgs{Values: map[string]any{"f": v}, MaxLen: 20})
+	}
+	tc.HExpire("h", time.Hour, "f", "fv")
+	tc.HDel("h", "fvv")
+	tc.LPop("l")
+	tc.LSet("l", 3, "set")
+	tc.LInsert("l", true, "set", "ins")
+	tc.LRem("l", 0, 7)
+	tc.LTrim("l", 5, 40)
+	tc.SRem("s", "x", "vv")
+	tc.ZRem("z", "vvv")
+	tc.ZPopMin("z", 2)
+
+	var want int64
+	for _, v := range tc.Items() {
+		want += DefaultSizer(v.Object)
+	}
+	if got := tc.Cost(); got != want {
+		t.Errorf("incremental cost %d, measured %d", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package gocache
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// checkSkiplist verifies the links, spans and ordering of zsl against want,
+// which must be sorted.
+func checkSkiplist(t *testing.T, zsl *skiplist, want []Z) {
+	t.Helper()
+	if zsl.length != len(want) {
+		t.Fatalf("length %d, want %d", zsl.length, len(want))
+	}
+	var prev *skiplistNode
+	i := 0
+	for x := zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		if x.member != want[i].Member || x.score != want[i].Score {
+			t.Fatalf("node %d is %s/%v, want %v", i, x.member, x.score, want[i])
+		}
+		if x.backward != prev {
+			t.Fatalf("bad backward link at %d", i)
+		}
+		if r := zsl.rank(x.score, x.member); r != i {
+			t.Fatalf("rank of %s is %d, want %d", x.member, r, i)
+		}
+		if zsl.byRank(i) != x {
+			t.Fatalf("byRank(%d) returned the wrong node", i)
+		}
+		prev = x
+		i++
+	}
+	if zsl.tail != prev {
+		t.Fatal("bad tail")
+	}
+}
+
+func TestSkiplist(t *testing.T) {
+	zsl := newSkiplist()
+	ref := map[string]float64{}
+	for i := 0; i < 2000; i++ {
+		m := strconv.Itoa(rand.Intn(300))
+		if score, ok := ref[m]; ok && rand.Intn(2) == 0 {
+			if !zsl.delete(score, m) {
+				t.Fatal("delete did not find", m)
+			}
+			delete(ref, m)
+			continue
+		} else if ok {
+			zsl.delete(score, m)
+		}
+		score := float64(rand.Intn(50))
+		zsl.insert(score, m)
+		ref[m] = score
+	}
+	if zsl.delete(-1, "missing") {
+		t.Error("deleted a missing node")
+	}
+	want := make([]Z, 0, len(ref))
+	for m, score := range ref {
+		want = append(want, Z{m, score})
+	}
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].Score != want[j].Score {
+			return want[i].Score < want[j].Score
+		}
+		return want[i].Member < want[j].Member
+	})
+	checkSkiplist(t, zsl, want)
+
+	r := ScoreRange{Min: 10, Max: 20, MinExclusive: true}
+	first, last := zsl.first(r), zsl.last(r)
+	for _, z := range want {
+		if z.Score > 10 {
+			if first.member != z.Member {
+				t.Errorf("first in range is %s, want %s", first.member, z.Member)
+			}
+			break
+		}
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		if want[i].Score <= 20 {
+			if last.member != want[i].Member {
+				t.Errorf("last in range is %s, want %s", last.member, want[i].Member)
+			}
+			break
+		}
+	}
+	if zsl.first(ScoreRange{Min: 100, Max: 200}) != nil {
+		t.Error("found a node in a range past the tail")
+	}
+	if zsl.first(ScoreRange{Min: 5, Max: 5, MaxExclusive: true}) != nil {
+		t.Error("found a node in an empty range")
+	}
+}
@@ -0,0 +1,854 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrStreamID is returned by XAdd for an ID not greater than the last
+	// ID of the stream.
+	ErrStreamID = errors.New("gocache: stream ID is equal or smaller than the last entry")
+	// ErrInvalidStreamID is returned by ParseStreamID for a malformed ID.
+	ErrInvalidStreamID = errors.New("gocache: invalid stream ID")
+	// ErrNoGroup is returned for a consumer group, or a stream holding it,
+	// that does not exist.
+	ErrNoGroup = errors.New("gocache: no such stream or consumer group")
+	// ErrGroupExists is returned by XGroupCreate for a group that already
+	// exists.
+	ErrGroupExists = errors.New("gocache: consumer group already exists")
+
+	errStreamArgs = errors.New("gocache: the number of stream keys and IDs differ")
+)
+
+// StreamID identifies a stream entry: the Unix time in milliseconds at
+// which it was added and a sequence number ordering the entries added within
+// the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinStreamID is lower than every entry ID.
+	MinStreamID = StreamID{}
+	// MaxStreamID is greater than every entry ID. XRead and XGroupCreate
+	// take it to mean the last entry of the stream, like $ in Redis, and
+	// XReadGroup to mean the entries never delivered to the group, like >.
+	MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+)
+
+// ParseStreamID parses an ID of the form ms-seq, or ms alone for a sequence
+// number of 0.
+func ParseStreamID(s string) (StreamID, error) {
+	ms, seq, hasSeq := strings.Cut(s, "-")
+	var id StreamID
+	var err error
+	if id.Ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	if hasSeq {
+		if id.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return StreamID{}, ErrInvalidStreamID
+		}
+	}
+	return id, nil
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less reports whether id sorts before o.
+func (id StreamID) Less(o StreamID) bool {
+	return id.Ms < o.Ms || (id.Ms == o.Ms && id.Seq < o.Seq)
+}
+
+// next returns the smallest ID greater than id, or id if it is MaxStreamID.
+func (id StreamID) next() StreamID {
+	switch {
+	case id == MaxStreamID:
+		return id
+	case id.Seq == math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}
+	}
+	return StreamID{id.Ms, id.Seq + 1}
+}
+
+// XMessage is a stream entry.
+type XMessage struct {
+	ID     StreamID
+	Values map[string]any
+}
+
+// XStream is the entries read from the stream stored under Key.
+type XStream struct {
+	Key      string
+	Messages []XMessage
+}
+
+// XAddArgs describes an entry added by XAdd.
+type XAddArgs struct {
+	// ID is the ID of the entry. If zero, an ID greater than every other in
+	// the stream is generated from the current time.
+	ID     StreamID
+	Values map[string]any
+	// NoMkStream makes XAdd fail with ErrNoSuchKey rather than create a
+	// missing stream.
+	NoMkStream bool
+	// MaxLen, if positive, trims the stream to its MaxLen newest entries
+	// once the entry is added.
+	MaxLen int
+	// MinID, if not zero, trims the entries with lower IDs once the entry
+	// is added.
+	MinID StreamID
+}
+
+// XReadArgs describes the streams read by XRead.
+type XReadArgs struct {
+	Keys []string
+	// IDs holds, for each of Keys, the ID after which entries are read.
+	IDs []StreamID
+	// Count, if positive, is the maximum number of entries read from each
+	// stream.
+	Count int
+	// Block makes XRead wait for an entry to be added when there are none
+	// to read, for at most Timeout if it is positive.
+	Block   bool
+	Timeout time.Duration
+}
+
+// XReadGroupArgs describes the streams read by XReadGroup.
+type XReadGroupArgs struct {
+	Group    string
+	Consumer string
+	Keys     []string
+	// IDs holds, for each of Keys, MaxStreamID to read the entries never
+	// delivered to the group, or an ID after which to re-read the entries
+	// already delivered to Consumer and not yet acknowledged.
+	IDs   []StreamID
+	Count int
+	// NoAck considers the entries acknowledged as soon as they are
+	// delivered, rather than adding them to the pending entries list.
+	NoAck bool
+	// Block and Timeout are as for XRead. XReadGroup only blocks when
+	// every ID is MaxStreamID.
+	Block   bool
+	Timeout time.Duration
+}
+
+// XPendingSummary summarizes the pending entries of a consumer group.
+type XPendingSummary struct {
+	Count int
+	// Lower and Higher are the lowest and highest pending IDs.
+	Lower, Higher StreamID
+	// Consumers maps the consumers with pending entries to their number.
+	Consumers map[string]int
+}
+
+// XPendingExtArgs selects the pending entries returned by XPendingExt.
+type XPendingExtArgs struct {
+	// Start and End bound the IDs of the entries, inclusive.
+	Start, End StreamID
+	// Count, if positive, is the maximum number of entries returned.
+	Count int
+	// Consumer, if set, restricts the entries to those of one consumer.
+	Consumer string
+	// Idle, if positive, restricts the entries to those delivered at least
+	// Idle ago.
+	Idle time.Duration
+}
+
+// XPendingEntry is an entry delivered to a consumer and not yet
+// acknowledged.
+type XPendingEntry struct {
+	ID       StreamID
+	Consumer string
+	// Idle is the time elapsed since the entry was last delivered.
+	Idle time.Duration
+	// RetryCount is the number of times the entry was delivered.
+	RetryCount int
+}
+
+// stream is the value stored under a key by XAdd.
+type stream struct {
+	entries []XMessage // in ID order
+	lastID  StreamID   // the greatest ID ever added, possibly trimmed since
+	groups  map[string]*streamGroup
+}
+
+// streamGroup is a consumer group: the last entry delivered to it and the
+// entries delivered but not yet acknowledged.
+type streamGroup struct {
+	lastID  StreamID
+	pending map[StreamID]*pendingEntry
+}
+
+type pendingEntry struct {
+	consumer  string
+	delivered int64 // UnixNano of the last delivery
+	count     int
+}
+
+func newStream() *stream {
+	return &stream{groups: map[string]*streamGroup{}}
+}
+
+func newStreamGroup(lastID StreamID) *streamGroup {
+	return &streamGroup{lastID: lastID, pending: map[StreamID]*pendingEntry{}}
+}
+
+// nextID returns the ID XAdd generates at time now.
+func (st *stream) nextID(now time.Time) StreamID {
+	if ms := uint64(now.UnixMilli()); ms > st.lastID.Ms {
+		return StreamID{ms, 0}
+	}
+	return st.lastID.next()
+}
+
+func (st *stream) add(id StreamID, values map[string]any) {
+	st.entries = append(st.entries, XMessage{ID: id, Values: values})
+	st.lastID = id
+}
+
+// search returns the index of the first entry whose ID is not lower than
+// id.
+func (st *stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+}
+
+// get returns the entry with the given ID.
+func (st *stream) get(id StreamID) (XMessage, bool) {
+	i := st.search(id)
+	if i == len(st.entries) || st.entries[i].ID != id {
+		return XMessage{}, false
+	}
+	return st.entries[i], true
+}
+
+// trimBefore removes the entries with IDs lower than id and returns their
+// number and cost.
+func (st *stream) trimBefore(id StreamID) (int, int64) {
+	n := st.search(id)
+	var cost int64
+	for i := 0; i < n; i++ {
+		cost += entryCost(st.entries[i].Values)
+		st.entries[i] = XMessage{}
+	}
+	st.entries = st.entries[n:]
+	return n, cost
+}
+
+// trim applies the MaxLen and MinID limits of XAdd. It returns the ID below
+// which entries were removed, and false if none were, along with the cost
+// of the removed entries.
+func (st *stream) trim(maxLen int, minID StreamID) (StreamID, int64, bool) {
+	cut := minID
+	if maxLen > 0 && len(st.entries) > maxLen {
+		if id := st.entries[len(st.entries)-maxLen].ID; cut.Less(id) {
+			cut = id
+		}
+	}
+	n, cost := st.trimBefore(cut)
+	if n == 0 {
+		return StreamID{}, 0, false
+	}
+	return cut, cost, true
+}
+
+// between returns a copy of up to count entries with IDs from start to end
+// inclusive, or every such entry if count is not positive.
+func (st *stream) between(start, end StreamID, count int, rev bool) []XMessage {
+	lo, hi := st.search(start), st.search(end.next())
+	if end == MaxStreamID {
+		hi = len(st.entries)
+	}
+	if lo >= hi {
+		return nil
+	}
+	n := hi - lo
+	if count > 0 && count < n {
+		n = count
+	}
+	out := make([]XMessage, n)
+	for i := range out {
+		j := lo + i
+		if rev {
+			j = hi - 1 - i
+		}
+		out[i] = copyMessage(st.entries[j])
+	}
+	return out
+}
+
+func copyMessage(m XMessage) XMessage {
+	values := make(map[string]any, len(m.Values))
+	for f, v := range m.Values {
+		values[f] = v
+	}
+	return XMessage{ID: m.ID, Values: values}
+}
+
+// deliver records the delivery of ids to consumer at now, the time in
+// UnixNano.
+func (g *streamGroup) deliver(ids []StreamID, consumer string, now int64, noAck bool) {
+	for _, id := range ids {
+		if g.lastID.Less(id) {
+			g.lastID = id
+		}
+		if noAck {
+			continue
+		}
+		p := g.pending[id]
+		if p == nil {
+			p = &pendingEntry{}
+			g.pending[id] = p
+		}
+		p.consumer = consumer
+		p.delivered = now
+		p.count++
+	}
+}
+
+// ack removes ids from the pending entries and returns how many were
+// pending.
+func (g *streamGroup) ack(ids []StreamID) int {
+	n := 0
+	for _, id := range ids {
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			n++
+		}
+	}
+	return n
+}
+
+// claim hands the pending entries ids over to consumer at now, the time in
+// UnixNano. Entries trimmed from the stream are acknowledged instead.
+func (g *streamGroup) claim(st *stream, ids []StreamID, consumer string, now int64) []XMessage {
+	var out []XMessage
+	for _, id := range ids {
+		p := g.pending[id]
+		if p == nil {
+			continue
+		}
+		m, ok := st.get(id)
+		if !ok {
+			delete(g.pending, id)
+			continue
+		}
+		p.consumer = consumer
+		p.delivered = now
+		p.count++
+		out = append(out, copyMessage(m))
+	}
+	return out
+}
+
+// pendingIDs returns the pending IDs in order.
+func (g *streamGroup) pendingIDs() []StreamID {
+	ids := make([]StreamID, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+func (st *stream) snapshot() *streamSnapshot {
+	ss := &streamSnapshot{
+		Entries: append([]XMessage(nil), st.entries...),
+		LastID:  st.lastID,
+	}
+	for name, g := range st.groups {
+		gs := groupSnapshot{Name: name, LastID: g.lastID}
+		for _, id := range g.pendingIDs() {
+			p := g.pending[id]
+			gs.Pending = append(gs.Pending, pendingSnapshot{id, p.consumer, p.delivered, p.count})
+		}
+		ss.Groups = append(ss.Groups, gs)
+	}
+	sort.Slice(ss.Groups, func(i, j int) bool { return ss.Groups[i].Name < ss.Groups[j].Name })
+	return ss
+}
+
+func (ss *streamSnapshot) stream() *stream {
+	st := newStream()
+	st.entries = ss.Entries
+	st.lastID = ss.LastID
+	for _, gs := range ss.Groups {
+		g := newStreamGroup(gs.LastID)
+		for _, p := range gs.Pending {
+			g.pending[p.ID] = &pendingEntry{p.Consumer, p.Delivered, p.Count}
+		}
+		st.groups[gs.Name] = g
+	}
+	return st
+}
+
+// stream returns the unexpired stream stored under k. It returns
+// ErrWrongType if k holds something else. s.mu must be held.
+func (s *shard) stream(k string) (*stream, bool, error) {
+	item, found := s.item(k)
+	if !found {
+		return nil, false, nil
+	}
+	st, ok := item.Object.(*stream)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+	return st, true, nil
+}
+
+// group returns the consumer group of the stream stored under k. s.mu must
+// be held.
+func (s *shard) group(k, group string) (*stream, *streamGroup, error) {
+	st, found, err := s.stream(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found || st.groups[group] == nil {
+		return nil, nil, ErrNoGroup
+	}
+	return st, st.groups[group], nil
+}
+
+// XAdd appends an entry to the stream stored under k, creating the stream
+// if needed, and returns the ID of the entry.
+func (c *cache) XAdd(k string, a XAddArgs) (StreamID, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, _ := s.item(k)
+	st, found, err := s.stream(k)
+	if err == nil && !found {
+		if a.NoMkStream {
+			err = ErrNoSuchKey
+		}
+		st = newStream()
+		item = Item{Object: st}
+	}
+	id := a.ID
+	if id == (StreamID{}) && err == nil {
+		id = st.nextID(time.Now())
+	} else if err == nil && !st.lastID.Less(id) {
+		err = ErrStreamID
+	}
+	if err != nil {
+		s.mu.Unlock()
+		return StreamID{}, err
+	}
+	values := make(map[string]any, len(a.Values))
+	for f, v := range a.Values {
+		values[f] = v
+	}
+	st.add(id, values)
+	c.log(aofRecord{Op: opXAdd, Key: k, ID: id, Values: values})
+	delta := entryCost(values)
+	if cut, cost, trimmed := st.trim(a.MaxLen, a.MinID); trimmed {
+		c.log(aofRecord{Op: opXTrim, Key: k, ID: cut})
+		delta -= cost
+	}
+	evicted := s.storeDelta(k, item, delta)
+	s.wakeReaders(k)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return id, nil
+}
+
+// XLen returns the number of entries in the stream stored under k.
+func (c *cache) XLen(k string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, found, err := s.stream(k)
+	if !found {
+		return 0, err
+	}
+	return len(st.entries), nil
+}
+
+// XRange returns the entries of the stream stored under k with IDs from
+// start to end inclusive, in order. If count is positive, at most count
+// entries are returned.
+func (c *cache) XRange(k string, start, end StreamID, count int) ([]XMessage, error) {
+	return c.xrange(k, start, end, count, false)
+}
+
+// XRevRange is like XRange, in reverse order starting from end.
+func (c *cache) XRevRange(k string, end, start StreamID, count int) ([]XMessage, error) {
+	return c.xrange(k, start, end, count, true)
+}
+
+func (c *cache) xrange(k string, start, end StreamID, count int, rev bool) ([]XMessage, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, found, err := s.stream(k)
+	if !found {
+		return nil, err
+	}
+	return st.between(start, end, count, rev), nil
+}
+
+// XRead returns the entries added after the given IDs to the streams stored
+// under a.Keys, leaving out streams with none. If there are no entries at
+// all and a.Block is set, it waits for one to be added and returns
+// ErrTimeout if a.Timeout elapses first, or ctx.Err() if ctx is done first.
+func (c *cache) XRead(ctx context.Context, a XReadArgs) ([]XStream, error) {
+	if len(a.Keys) != len(a.IDs) {
+		return nil, errStreamArgs
+	}
+	ids := append([]StreamID(nil), a.IDs...)
+	resolved := false
+	return c.xblock(ctx, a.Keys, a.Block, a.Timeout, func() ([]XStream, error) {
+		var out []XStream
+		for i, k := range a.Keys {
+			st, found, err := c.shardFor(k).stream(k)
+			if err != nil {
+				return nil, err
+			}
+			if !resolved && ids[i] == MaxStreamID {
+				ids[i] = MinStreamID
+				if found {
+					ids[i] = st.lastID
+				}
+			}
+			if !found || ids[i] == MaxStreamID {
+				continue
+			}
+			if msgs := st.between(ids[i].next(), MaxStreamID, a.Count, false); len(msgs) > 0 {
+				out = append(out, XStream{Key: k, Messages: msgs})
+			}
+		}
+		resolved = true
+		return out, nil
+	})
+}
+
+// xblock calls read with the shards of keys locked until it returns entries
+// or an error. If it returns nothing and block is set, xblock waits for an
+// entry to be added to one of keys and tries again.
+func (c *cache) xblock(ctx context.Context, keys []string, block bool, timeout time.Duration, read func() ([]XStream, error)) ([]XStream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var expired <-chan time.Time
+	if block && timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	ss := c.shardsFor(keys)
+	for {
+		lockShards(ss)
+		out, err := read()
+		if err != nil || len(out) > 0 || !block {
+			unlockShards(ss)
+			return out, err
+		}
+		ch := make(chan struct{}, 1)
+		for _, k := range keys {
+			s := c.shardFor(k)
+			if s.readers == nil {
+				s.readers = make(map[string][]chan struct{})
+			}
+			s.readers[k] = append(s.readers[k], ch)
+		}
+		unlockShards(ss)
+
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-expired:
+			err = ErrTimeout
+		}
+		lockShards(ss)
+		for _, k := range keys {
+			s := c.shardFor(k)
+			rs := s.readers[k]
+			for i, x := range rs {
+				if x == ch {
+					rs = append(rs[:i], rs[i+1:]...)
+					break
+				}
+			}
+			if len(rs) == 0 {
+				delete(s.readers, k)
+			} else {
+				s.readers[k] = rs
+			}
+		}
+		unlockShards(ss)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wakeReaders wakes the goroutines blocked in XRead and XReadGroup on k.
+// s.mu must be held.
+func (s *shard) wakeReaders(k string) {
+	for _, ch := range s.readers[k] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	delete(s.readers, k)
+}
+
+// XGroupCreate creates a consumer group for the stream stored under k. The
+// first entry delivered to the group is the one following start, which may
+// be MaxStreamID for entries added from now on. If the stream does not
+// exist, XGroupCreate creates it if mkStream is set and returns
+// ErrNoSuchKey otherwise.
+func (c *cache) XGroupCreate(k, group string, start StreamID, mkStream bool) error {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	st, found, err := s.stream(k)
+	switch {
+	case err != nil:
+	case !found && !mkStream:
+		err = ErrNoSuchKey
+	case found && st.groups[group] != nil:
+		err = ErrGroupExists
+	}
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	var evicted []keyAndValue
+	if !found {
+		st = newStream()
+		evicted = s.store(k, Item{Object: st})
+	}
+	if start == MaxStreamID {
+		start = st.lastID
+	}
+	st.groups[group] = newStreamGroup(start)
+	c.log(aofRecord{Op: opXGroupCreate, Key: k, Field: group, ID: start})
+	s.mu.Unlock()
+	c.evict(evicted)
+	return nil
+}
+
+// XReadGroup reads the streams stored under a.Keys as a.Consumer of the
+// consumer group a.Group. New entries are added to the group's pending
+// entries list until they are acknowledged with XAck, unless a.NoAck is
+// set. It blocks as XRead does, and returns ErrNoGroup if a stream or its
+// group does not exist.
+func (c *cache) XReadGroup(ctx context.Context, a XReadGroupArgs) ([]XStream, error) {
+	if len(a.Keys) != len(a.IDs) {
+		return nil, errStreamArgs
+	}
+	block := a.Block
+	for _, id := range a.IDs {
+		if id != MaxStreamID {
+			block = false
+		}
+	}
+	return c.xblock(ctx, a.Keys, block, a.Timeout, func() ([]XStream, error) {
+		for _, k := range a.Keys {
+			if _, _, err := c.shardFor(k).group(k, a.Group); err != nil {
+				return nil, err
+			}
+		}
+		var out []XStream
+		now := time.Now().UnixNano()
+		for i, k := range a.Keys {
+			st, g, _ := c.shardFor(k).group(k, a.Group)
+			if a.IDs[i] != MaxStreamID {
+				out = append(out, XStream{Key: k, Messages: g.history(st, a.Consumer, a.IDs[i], a.Count)})
+				continue
+			}
+			msgs := st.between(g.lastID.next(), MaxStreamID, a.Count, false)
+			if len(msgs) == 0 {
+				continue
+			}
+			ids := make([]StreamID, len(msgs))
+			for j, m := range msgs {
+				ids[j] = m.ID
+			}
+			g.deliver(ids, a.Consumer, now, a.NoAck)
+			noAck := 0
+			if a.NoAck {
+				noAck = 1
+			}
+			c.log(aofRecord{Op: opXReadGroup, Key: k, Field: a.Group, Value: a.Consumer, IDs: ids, Exp: now, Start: noAck})
+			out = append(out, XStream{Key: k, Messages: msgs})
+		}
+		return out, nil
+	})
+}
+
+// history returns up to count of the entries pending for consumer with IDs
+// greater than after. Entries trimmed from the stream have no values.
+func (g *streamGroup) history(st *stream, consumer string, after StreamID, count int) []XMessage {
+	out := []XMessage{}
+	for _, id := range g.pendingIDs() {
+		if count > 0 && len(out) == count {
+			break
+		}
+		if !after.Less(id) || g.pending[id].consumer != consumer {
+			continue
+		}
+		m, ok := st.get(id)
+		if ok {
+			m = copyMessage(m)
+		} else {
+			m = XMessage{ID: id}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// XAck acknowledges entries delivered to the consumer group and returns the
+// number that were pending.
+func (c *cache) XAck(k, group string, ids ...StreamID) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.group(k, group)
+	if err != nil {
+		if err == ErrNoGroup {
+			err = nil
+		}
+		return 0, err
+	}
+	n := g.ack(ids)
+	if n > 0 {
+		c.log(aofRecord{Op: opXAck, Key: k, Field: group, IDs: ids})
+	}
+	return n, nil
+}
+
+// XPending summarizes the entries delivered to the consumer group and not
+// yet acknowledged.
+func (c *cache) XPending(k, group string) (XPendingSummary, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, g, err := s.group(k, group)
+	if err != nil {
+		return XPendingSummary{}, err
+	}
+	sum := XPendingSummary{Count: len(g.pending)}
+	if sum.Count == 0 {
+		return sum, nil
+	}
+	sum.Consumers = make(map[string]int)
+	ids := g.pendingIDs()
+	sum.Lower, sum.Higher = ids[0], ids[len(ids)-1]
+	for _, p := range g.pending {
+		sum.Consumers[p.consumer]++
+	}
+	return sum, nil
+}
+
+// XPendingExt returns the pending entries of the consumer group selected by
+// a, in ID order.
+func (c *cache) XPendingExt(k, group string, a XPendingExtArgs) ([]XPendingEntry, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, g, err := s.group(k, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	var out []XPendingEntry
+	for _, id := range g.pendingIDs() {
+		if a.Count > 0 && len(out) == a.Count {
+			break
+		}
+		p := g.pending[id]
+		idle := time.Duration(now - p.delivered)
+		if id.Less(a.Start) || a.End.Less(id) || (a.Consumer != "" && p.consumer != a.Consumer) || idle < a.Idle {
+			continue
+		}
+		out = append(out, XPendingEntry{ID: id, Consumer: p.consumer, Idle: idle, RetryCount: p.count})
+	}
+	return out, nil
+}
+
+// XClaim transfers to consumer the pending entries ids that were last
+// delivered at least minIdle ago, as if they were delivered to it again, and
+// returns them. Pending entries trimmed from the stream are acknowledged
+// instead.
+func (c *cache) XClaim(k, group, consumer string, minIdle time.Duration, ids ...StreamID) ([]XMessage, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, g, err := s.group(k, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	var claimed []StreamID
+	for _, id := range ids {
+		if p := g.pending[id]; p != nil && time.Duration(now-p.delivered) >= minIdle {
+			claimed = append(claimed, id)
+		}
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+	c.log(aofRecord{Op: opXClaim, Key: k, Field: group, Value: consumer, IDs: claimed, Exp: now})
+	return g.claim(st, claimed, consumer, now), nil
+}
+
+// applyStream replays a logged stream operation.
+func (c *cache) applyStream(s *shard, r *aofRecord) []keyAndValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, _ := s.item(r.Key)
+	st, found, err := s.stream(r.Key)
+	if err != nil {
+		return nil
+	}
+	if !found {
+		if r.Op != opXAdd && r.Op != opXGroupCreate {
+			return nil
+		}
+		st = newStream()
+		item = Item{Object: st}
+	}
+	g := st.groups[r.Field]
+	var delta int64
+	switch r.Op {
+	case opXAdd:
+		st.add(r.ID, r.Values)
+		delta = entryCost(r.Values)
+	case opXTrim:
+		_, cost := st.trimBefore(r.ID)
+		delta = -cost
+	case opXGroupCreate:
+		if g == nil {
+			st.groups[r.Field] = newStreamGroup(r.ID)
+		}
+	case opXReadGroup:
+		if g != nil {
+			consumer, _ := r.Value.(string)
+			g.deliver(r.IDs, consumer, r.Exp, r.Start != 0)
+		}
+	case opXAck:
+		if g != nil {
+			g.ack(r.IDs)
+		}
+	case opXClaim:
+		if g != nil {
+			consumer, _ := r.Value.(string)
+			g.claim(st, r.IDs, consumer, r.Exp)
+		}
+	}
+	return s.storeDelta(r.Key, item, delta)
+}
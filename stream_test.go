@@ -0,0 +1,232 @@
+package gocache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func streamIDs(msgs []XMessage) []StreamID {
+	ids := make([]StreamID, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestParseStreamID(t *testing.T) {
+	for s, want := range map[string]StreamID{"1-2": {1, 2}, "5": {5, 0}, "0-0": {}} {
+		if id, err := ParseStreamID(s); err != nil || id != want {
+			t.Errorf("ParseStreamID(%q) = %v, %v", s, id, err)
+		}
+	}
+	for _, s := range []string{"", "x", "1-", "-1", "1-2-3"} {
+		if _, err := ParseStreamID(s); err != ErrInvalidStreamID {
+			t.Errorf("ParseStreamID(%q) should fail, got %v", s, err)
+		}
+	}
+	if s := (StreamID{12, 3}).String(); s != "12-3" {
+		t.Error("String:", s)
+	}
+}
+
+func TestCache_XAdd_XRange(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	a, err := tc.XAdd("s", XAddArgs{Values: map[string]any{"n": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := tc.XAdd("s", XAddArgs{Values: map[string]any{"n": 2}})
+	if !a.Less(b) {
+		t.Errorf("generated IDs are not increasing: %v then %v", a, b)
+	}
+	future := StreamID{b.Ms + 1000, 0}
+	if id, err := tc.XAdd("s", XAddArgs{ID: future}); err != nil || id != future {
+		t.Error("XAdd with an explicit ID:", id, err)
+	}
+	if _, err := tc.XAdd("s", XAddArgs{ID: b}); err != ErrStreamID {
+		t.Error("XAdd should reject an ID not greater than the last, got", err)
+	}
+	if id, _ := tc.XAdd("s", XAddArgs{}); id != (StreamID{future.Ms, 1}) {
+		t.Error("a generated ID should follow the last one, got", id)
+	}
+	if n, _ := tc.XLen("s"); n != 4 {
+		t.Error("XLen:", n)
+	}
+
+	msgs, _ := tc.XRange("s", MinStreamID, MaxStreamID, 0)
+	if len(msgs) != 4 || msgs[0].ID != a || msgs[0].Values["n"] != 1 {
+		t.Error("XRange:", msgs)
+	}
+	msgs[0].Values["n"] = 100
+	if msgs, _ := tc.XRange("s", a, a, 0); msgs[0].Values["n"] != 1 {
+		t.Error("XRange returned the live entry")
+	}
+	if msgs, _ := tc.XRange("s", b, MaxStreamID, 2); !reflect.DeepEqual(streamIDs(msgs), []StreamID{b, future}) {
+		t.Error("XRange with a count:", streamIDs(msgs))
+	}
+	if msgs, _ := tc.XRevRange("s", future, MinStreamID, 0); !reflect.DeepEqual(streamIDs(msgs), []StreamID{future, b, a}) {
+		t.Error("XRevRange:", streamIDs(msgs))
+	}
+
+	if _, err := tc.XAdd("none", XAddArgs{NoMkStream: true}); err != ErrNoSuchKey {
+		t.Error("XAdd with NoMkStream should fail, got", err)
+	}
+	tc.Set("str", "x", DefaultExpiration)
+	if _, err := tc.XAdd("str", XAddArgs{}); err != ErrWrongType {
+		t.Error("XAdd on a string should fail, got", err)
+	}
+}
+
+func TestCache_XAdd_Trim(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	for i := uint64(1); i <= 10; i++ {
+		tc.XAdd("s", XAddArgs{ID: StreamID{i, 0}, MaxLen: 5})
+	}
+	msgs, _ := tc.XRange("s", MinStreamID, MaxStreamID, 0)
+	if len(msgs) != 5 || msgs[0].ID != (StreamID{6, 0}) {
+		t.Error("MaxLen kept", streamIDs(msgs))
+	}
+	tc.XAdd("s", XAddArgs{ID: StreamID{11, 0}, MinID: StreamID{9, 0}})
+	if n, _ := tc.XLen("s"); n != 3 {
+		t.Error("MinID kept", n)
+	}
+	tc.XAdd("s", XAddArgs{ID: StreamID{12, 0}, MinID: StreamID{20, 0}})
+	if n, _ := tc.XLen("s"); n != 0 {
+		t.Error("MinID above every entry kept", n)
+	}
+	if _, err := tc.XAdd("s", XAddArgs{ID: StreamID{12, 0}}); err != ErrStreamID {
+		t.Error("trimming all entries should not reset the last ID, got", err)
+	}
+}
+
+func TestCache_XRead(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	ctx := context.Background()
+	a, _ := tc.XAdd("s1", XAddArgs{Values: map[string]any{"n": 1}})
+	out, err := tc.XRead(ctx, XReadArgs{Keys: []string{"s1", "s2"}, IDs: []StreamID{MinStreamID, MinStreamID}})
+	if err != nil || len(out) != 1 || out[0].Key != "s1" || out[0].Messages[0].ID != a {
+		t.Error("XRead:", out, err)
+	}
+	out, _ = tc.XRead(ctx, XReadArgs{Keys: []string{"s1"}, IDs: []StreamID{a}})
+	if out != nil {
+		t.Error("XRead past the last entry returned", out)
+	}
+	if _, err := tc.XRead(ctx, XReadArgs{Keys: []string{"s1"}}); err == nil {
+		t.Error("XRead should fail without IDs")
+	}
+
+	start := time.Now()
+	_, err = tc.XRead(ctx, XReadArgs{Keys: []string{"s1"}, IDs: []StreamID{MaxStreamID}, Block: true, Timeout: 20 * time.Millisecond})
+	if err != ErrTimeout || time.Since(start) < 20*time.Millisecond {
+		t.Error("XRead should time out, got", err)
+	}
+
+	done := make(chan []XStream)
+	go func() {
+		out, err := tc.XRead(ctx, XReadArgs{Keys: []string{"s1", "s2"}, IDs: []StreamID{MaxStreamID, MaxStreamID}, Block: true})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- out
+	}()
+	time.Sleep(20 * time.Millisecond)
+	b, _ := tc.XAdd("s2", XAddArgs{Values: map[string]any{"n": 2}})
+	select {
+	case out := <-done:
+		if len(out) != 1 || out[0].Key != "s2" || out[0].Messages[0].ID != b {
+			t.Error("the blocked XRead returned", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("XRead was not woken by XAdd")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := tc.XRead(ctx, XReadArgs{Keys: []string{"s1"}, IDs: []StreamID{MaxStreamID}, Block: true}); err != context.Canceled {
+		t.Error("XRead should return the context error, got", err)
+	}
+}
+
+func TestCache_XReadGroup(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	ctx := context.Background()
+	if err := tc.XGroupCreate("s", "g", MinStreamID, false); err != ErrNoSuchKey {
+		t.Error("XGroupCreate on a missing stream should fail, got", err)
+	}
+	if err := tc.XGroupCreate("s", "g", MinStreamID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.XGroupCreate("s", "g", MinStreamID, false); err != ErrGroupExists {
+		t.Error("XGroupCreate should reject an existing group, got", err)
+	}
+	var ids []StreamID
+	for i := 0; i < 3; i++ {
+		id, _ := tc.XAdd("s", XAddArgs{Values: map[string]any{"n": i}})
+		ids = append(ids, id)
+	}
+
+	args := XReadGroupArgs{Group: "g", Consumer: "alice", Keys: []string{"s"}, IDs: []StreamID{MaxStreamID}, Count: 2}
+	out, err := tc.XReadGroup(ctx, args)
+	if err != nil || len(out) != 1 || !reflect.DeepEqual(streamIDs(out[0].Messages), ids[:2]) {
+		t.Fatal("XReadGroup:", out, err)
+	}
+	args.Consumer = "bob"
+	out, _ = tc.XReadGroup(ctx, args)
+	if !reflect.DeepEqual(streamIDs(out[0].Messages), ids[2:]) {
+		t.Error("the second consumer should get the remaining entry, got", out)
+	}
+	if out, _ := tc.XReadGroup(ctx, args); out != nil {
+		t.Error("XReadGroup without new entries returned", out)
+	}
+
+	sum, _ := tc.XPending("s", "g")
+	want := XPendingSummary{Count: 3, Lower: ids[0], Higher: ids[2], Consumers: map[string]int{"alice": 2, "bob": 1}}
+	if !reflect.DeepEqual(sum, want) {
+		t.Errorf("XPending: got %+v, want %+v", sum, want)
+	}
+
+	if n, _ := tc.XAck("s", "g", ids[0], ids[0]); n != 1 {
+		t.Error("XAck:", n)
+	}
+	args.Consumer, args.IDs = "alice", []StreamID{MinStreamID}
+	out, _ = tc.XReadGroup(ctx, args)
+	if !reflect.DeepEqual(streamIDs(out[0].Messages), ids[1:2]) {
+		t.Error("reading the history should return the unacknowledged entry, got", out)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if msgs, _ := tc.XClaim("s", "g", "bob", time.Hour, ids[1]); msgs != nil {
+		t.Error("XClaim ignored minIdle:", msgs)
+	}
+	msgs, _ := tc.XClaim("s", "g", "bob", 5*time.Millisecond, ids[1], ids[0])
+	if !reflect.DeepEqual(streamIDs(msgs), ids[1:2]) {
+		t.Error("XClaim:", streamIDs(msgs))
+	}
+	pending, _ := tc.XPendingExt("s", "g", XPendingExtArgs{Start: MinStreamID, End: MaxStreamID, Consumer: "bob"})
+	if len(pending) != 2 || pending[0].ID != ids[1] || pending[0].RetryCount != 2 || pending[0].Idle > 5*time.Millisecond {
+		t.Errorf("XPendingExt: %+v", pending)
+	}
+
+	if _, err := tc.XReadGroup(ctx, XReadGroupArgs{Group: "nope", Keys: []string{"s"}, IDs: []StreamID{MaxStreamID}}); err != ErrNoGroup {
+		t.Error("XReadGroup with a missing group should fail, got", err)
+	}
+
+	done := make(chan []XStream)
+	go func() {
+		out, _ := tc.XReadGroup(ctx, XReadGroupArgs{Group: "g", Consumer: "carol", Keys: []string{"s"}, IDs: []StreamID{MaxStreamID}, NoAck: true, Block: true})
+		done <- out
+	}()
+	time.Sleep(20 * time.Millisecond)
+	id, _ := tc.XAdd("s", XAddArgs{})
+	if out := <-done; len(out) != 1 || out[0].Messages[0].ID != id {
+		t.Error("the blocked XReadGroup returned", out)
+	}
+	if sum, _ := tc.XPending("s", "g"); sum.Consumers["carol"] != 0 {
+		t.Error("NoAck entries were added to the pending entries list")
+	}
+}
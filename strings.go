@@ -0,0 +1,543 @@
+package gocache
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrWrongType is returned by operations on a key holding the wrong
+	// kind of value, e.g. a string operation on a hash.
+	ErrWrongType = errors.New("gocache: operation against a key holding the wrong kind of value")
+	// ErrNotInteger is returned when a value cannot be used as an integer,
+	// or an operation on it would overflow.
+	ErrNotInteger = errors.New("gocache: value is not an integer or out of range")
+	// ErrNotFloat is returned when a value cannot be used as a float, or an
+	// operation on it would produce NaN or an infinity.
+	ErrNotFloat = errors.New("gocache: value is not a valid float")
+	// ErrOutOfRange is returned for a negative string offset, or one that
+	// would grow the string past 512MB.
+	ErrOutOfRange = errors.New("gocache: offset is out of range")
+)
+
+// maxStringLength is the largest string SetRange will create, as in Redis.
+const maxStringLength = 512 << 20
+
+// SetNX sets k to x only if k does not already exist, and reports whether it
+// was set.
+func (c *cache) SetNX(k string, x any, d time.Duration) bool {
+	e := c.expiration(d)
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if _, found := s.get(k); found {
+		s.mu.Unlock()
+		return false
+	}
+	if c.write(k, x, false) != nil {
+		s.mu.Unlock()
+		return false
+	}
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e})
+	c.notifySet(s, EventSet, k, x, "SetNX")
+	evicted := s.store(k, Item{
+		Object:     x,
+		Expiration: e,
+	})
+	s.mu.Unlock()
+	c.evict(evicted)
+	return true
+}
+
+// SetXX sets k to x only if k already exists, and reports whether it was
+// set.
+func (c *cache) SetXX(k string, x any, d time.Duration) bool {
+	e := c.expiration(d)
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if _, found := s.get(k); !found {
+		s.mu.Unlock()
+		return false
+	}
+	if c.write(k, x, false) != nil {
+		s.mu.Unlock()
+		return false
+	}
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e})
+	c.notifySet(s, EventSet, k, x, "SetXX")
+	evicted := s.store(k, Item{
+		Object:     x,
+		Expiration: e,
+	})
+	s.mu.Unlock()
+	c.evict(evicted)
+	return true
+}
+
+// IncrBy adds n to the integer stored under k and returns the result. Unlike
+// Increment it follows Redis semantics: a missing key is treated as 0, a
+// string holding a base-10 integer is incremented in place, and overflow is
+// an error. The value keeps its type and expiration.
+func (c *cache) IncrBy(k string, n int64) (int64, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, found := s.item(k)
+	if !found {
+		item = Item{Object: int64(0)}
+	}
+	cur, ok := toInt64(item.Object)
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrNotInteger
+	}
+	r := cur + n
+	if (n > 0 && r < cur) || (n < 0 && r > cur) {
+		s.mu.Unlock()
+		return 0, ErrNotInteger
+	}
+	v, ok := fromInt64(item.Object, r)
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrNotInteger
+	}
+	if err := c.write(k, v, false); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	item.Object = v
+	c.notifySet(s, EventIncr, k, v, "IncrBy")
+	c.log(aofRecord{Op: opSet, Key: k, Value: v, Exp: item.Expiration})
+	evicted := s.store(k, item)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return r, nil
+}
+
+// IncrByFloat adds f to the number stored under k and returns the result. A
+// missing key is treated as 0. Float values keep their type, numeric strings
+// stay strings, and integers become float64. The expiration is kept.
+func (c *cache) IncrByFloat(k string, f float64) (float64, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrNotFloat
+	}
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, found := s.item(k)
+	if !found {
+		item = Item{Object: float64(0)}
+	}
+	cur, ok := toFloat64(item.Object)
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrNotFloat
+	}
+	r := cur + f
+	if math.IsNaN(r) || math.IsInf(r, 0) {
+		s.mu.Unlock()
+		return 0, ErrNotFloat
+	}
+	switch item.Object.(type) {
+	case float32:
+		item.Object = float32(r)
+	case string:
+		item.Object = strconv.FormatFloat(r, 'f', -1, 64)
+	case []byte:
+		item.Object = []byte(strconv.FormatFloat(r, 'f', -1, 64))
+	default:
+		item.Object = r
+	}
+	if err := c.write(k, item.Object, false); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	c.notifySet(s, EventIncr, k, item.Object, "IncrByFloat")
+	c.log(aofRecord{Op: opSet, Key: k, Value: item.Object, Exp: item.Expiration})
+	evicted := s.store(k, item)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return r, nil
+}
+
+// GetSet sets k to x and returns the value it replaced, if any. With a
+// Writer, a failed write leaves k unchanged and returns its value.
+func (c *cache) GetSet(k string, x any, d time.Duration) (any, bool) {
+	e := c.expiration(d)
+	s := c.shardFor(k)
+	s.mu.Lock()
+	old, found := s.item(k)
+	if c.write(k, x, false) != nil {
+		s.mu.Unlock()
+		return old.Object, found
+	}
+	c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e})
+	c.notifySet(s, EventSet, k, x, "GetSet")
+	evicted := s.store(k, Item{
+		Object:     x,
+		Expiration: e,
+	})
+	s.mu.Unlock()
+	c.evict(evicted)
+	return old.Object, found
+}
+
+// GetDel deletes k and returns the value it held, if any. With a Writer, a
+// failed delete leaves k in place and reports it as not deleted.
+func (c *cache) GetDel(k string) (any, bool) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, found := s.item(k)
+	if c.write(k, nil, true) != nil {
+		s.mu.Unlock()
+		return nil, false
+	}
+	c.notifyDelete(s, EventDelete, k, "GetDel")
+	v, evicted := s.delete(k)
+	s.mu.Unlock()
+	if evicted {
+		c.onEvicted(k, v)
+	}
+	return item.Object, found
+}
+
+// GetEx returns the value of k and resets its expiration to d, which is
+// interpreted as in Set: DefaultExpiration applies the cache default and
+// NoExpiration makes the key persistent.
+func (c *cache) GetEx(k string, d time.Duration) (any, bool) {
+	e := c.expiration(d)
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, found := s.item(k)
+	if !found {
+		s.mu.Unlock()
+		return nil, false
+	}
+	item.Expiration = e
+	item.version = s.nextVersion()
+	s.items[k] = item
+	s.touch(k)
+	c.log(aofRecord{Op: opExpire, Key: k, Exp: e})
+	s.mu.Unlock()
+	return item.Object, true
+}
+
+// MSet sets every key in items, replacing any existing values. All keys are
+// written atomically. With a Writer, the keys it fails to write are left
+// unchanged.
+func (c *cache) MSet(items map[string]any, d time.Duration) {
+	e := c.expiration(d)
+	ss := c.shardsFor(mapKeys(items))
+	lockShards(ss)
+	if failed := c.writeMany(items, nil); len(failed) > 0 {
+		items = withoutKeys(items, failed)
+	}
+	evicted := c.mset(items, e, "MSet")
+	unlockShards(ss)
+	c.evict(evicted)
+}
+
+// MSetNX is like MSet, but sets nothing if any of the keys already exists.
+// It reports whether the keys were set, even if the Writer failed to write
+// some of them.
+func (c *cache) MSetNX(items map[string]any, d time.Duration) bool {
+	e := c.expiration(d)
+	ss := c.shardsFor(mapKeys(items))
+	lockShards(ss)
+	for k := range items {
+		if _, found := c.shardFor(k).item(k); found {
+			unlockShards(ss)
+			return false
+		}
+	}
+	if failed := c.writeMany(items, nil); len(failed) > 0 {
+		items = withoutKeys(items, failed)
+	}
+	evicted := c.mset(items, e, "MSetNX")
+	unlockShards(ss)
+	c.evict(evicted)
+	return true
+}
+
+// mset stores items. The shards owning them must be locked.
+func (c *cache) mset(items map[string]any, e int64, cause string) []keyAndValue {
+	var evicted []keyAndValue
+	for k, x := range items {
+		s := c.shardFor(k)
+		c.log(aofRecord{Op: opSet, Key: k, Value: x, Exp: e})
+		c.notifySet(s, EventSet, k, x, cause)
+		evicted = append(evicted, s.store(k, Item{
+			Object:     x,
+			Expiration: e,
+		})...)
+	}
+	return evicted
+}
+
+// MGet returns the values of keys, read atomically, with nil for keys that
+// are missing or expired.
+func (c *cache) MGet(keys ...string) []any {
+	ss := c.shardsFor(keys)
+	rlockShards(ss)
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		values[i], _ = c.shardFor(k).get(k)
+	}
+	runlockShards(ss)
+	return values
+}
+
+// Append appends v to the string stored under k, creating it if needed, and
+// returns the new length. []byte values stay []byte; numbers are converted to
+// strings.
+func (c *cache) Append(k string, v string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, found := s.item(k)
+	cur, ok := "", true
+	if found {
+		cur, ok = toString(item.Object)
+	}
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrWrongType
+	}
+	r := cur + v
+	x := withString(item.Object, r)
+	if err := c.write(k, x, false); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	item.Object = x
+	c.notifySet(s, EventSet, k, item.Object, "Append")
+	c.log(aofRecord{Op: opSet, Key: k, Value: item.Object, Exp: item.Expiration})
+	evicted := s.store(k, item)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return len(r), nil
+}
+
+// StrLen returns the length of the string stored under k, or 0 if k does not
+// exist.
+func (c *cache) StrLen(k string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	v, found := s.get(k)
+	s.mu.RUnlock()
+	if !found {
+		return 0, nil
+	}
+	str, ok := toString(v)
+	if !ok {
+		return 0, ErrWrongType
+	}
+	return len(str), nil
+}
+
+// GetRange returns the substring of the string stored under k between the
+// byte offsets start and end, inclusive. Negative offsets count from the end
+// of the string and out of range offsets are clamped, as in Redis.
+func (c *cache) GetRange(k string, start, end int) (string, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	v, found := s.get(k)
+	s.mu.RUnlock()
+	if !found {
+		return "", nil
+	}
+	str, ok := toString(v)
+	if !ok {
+		return "", ErrWrongType
+	}
+	n := len(str)
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+	if start > end {
+		return "", nil
+	}
+	return str[start : end+1], nil
+}
+
+// SetRange overwrites part of the string stored under k starting at offset,
+// padding it with zero bytes if it is too short, and returns the new length.
+func (c *cache) SetRange(k string, offset int, v string) (int, error) {
+	if offset < 0 || offset > maxStringLength-len(v) {
+		return 0, ErrOutOfRange
+	}
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, found := s.item(k)
+	cur, ok := "", true
+	if found {
+		cur, ok = toString(item.Object)
+	}
+	if !ok {
+		s.mu.Unlock()
+		return 0, ErrWrongType
+	}
+	if v == "" {
+		s.mu.Unlock()
+		return len(cur), nil
+	}
+	b := []byte(cur)
+	if end := offset + len(v); end > len(b) {
+		b = append(b, make([]byte, end-len(b))...)
+	}
+	copy(b[offset:], v)
+	x := any(string(b))
+	if _, isBytes := item.Object.([]byte); isBytes {
+		x = b
+	}
+	if err := c.write(k, x, false); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	item.Object = x
+	c.notifySet(s, EventSet, k, item.Object, "SetRange")
+	c.log(aofRecord{Op: opSet, Key: k, Value: item.Object, Exp: item.Expiration})
+	evicted := s.store(k, item)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return len(b), nil
+}
+
+// toInt64 converts an integer or a string holding a base-10 integer.
+func toInt64(x any) (int64, bool) {
+	switch v := x.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case uintptr:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// fromInt64 converts n back to the type of like, reporting false if it does
+// not fit.
+func fromInt64(like any, n int64) (any, bool) {
+	switch like.(type) {
+	case int:
+		return int(n), int64(int(n)) == n
+	case int8:
+		return int8(n), int64(int8(n)) == n
+	case int16:
+		return int16(n), int64(int16(n)) == n
+	case int32:
+		return int32(n), int64(int32(n)) == n
+	case int64:
+		return n, true
+	case uint:
+		return uint(n), n >= 0 && uint64(uint(n)) == uint64(n)
+	case uint8:
+		return uint8(n), n >= 0 && int64(uint8(n)) == n
+	case uint16:
+		return uint16(n), n >= 0 && int64(uint16(n)) == n
+	case uint32:
+		return uint32(n), n >= 0 && int64(uint32(n)) == n
+	case uint64:
+		return uint64(n), n >= 0
+	case uintptr:
+		return uintptr(n), n >= 0 && uint64(uintptr(n)) == uint64(n)
+	case string:
+		return strconv.FormatInt(n, 10), true
+	case []byte:
+		return []byte(strconv.FormatInt(n, 10)), true
+	}
+	return nil, false
+}
+
+// toFloat64 converts a number or a string holding a decimal number.
+func toFloat64(x any) (float64, bool) {
+	var str string
+	switch v := x.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	default:
+		n, ok := toInt64(x)
+		return float64(n), ok
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// toString returns the string form of a string, []byte or number.
+func toString(x any) (string, bool) {
+	switch v := x.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), true
+	case uintptr:
+		return strconv.FormatUint(uint64(v), 10), true
+	}
+	if n, ok := toInt64(x); ok {
+		return strconv.FormatInt(n, 10), true
+	}
+	return "", false
+}
+
+// withString returns s as a []byte if like is one, and as a string otherwise.
+func withString(like any, s string) any {
+	if _, ok := like.([]byte); ok {
+		return []byte(s)
+	}
+	return s
+}
+
+func mapKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,225 @@
+package gocache
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCache_SetNX_SetXX(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if tc.SetXX("a", 1, DefaultExpiration) {
+		t.Error("SetXX set a missing key")
+	}
+	if !tc.SetNX("a", 1, DefaultExpiration) {
+		t.Error("SetNX did not set a missing key")
+	}
+	if tc.SetNX("a", 2, DefaultExpiration) {
+		t.Error("SetNX overwrote an existing key")
+	}
+	if !tc.SetXX("a", 3, DefaultExpiration) {
+		t.Error("SetXX did not set an existing key")
+	}
+	if x, _ := tc.Get("a"); x.(int) != 3 {
+		t.Error("a should be 3, got", x)
+	}
+	tc.Set("short", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	if !tc.SetNX("short", 2, DefaultExpiration) {
+		t.Error("SetNX should treat an expired key as missing")
+	}
+}
+
+func TestCache_IncrBy(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if n, err := tc.IncrBy("missing", 5); err != nil || n != 5 {
+		t.Error("IncrBy on a missing key:", n, err)
+	}
+	tc.Set("s", "10", DefaultExpiration)
+	if n, err := tc.IncrBy("s", -3); err != nil || n != 7 {
+		t.Error("IncrBy on a numeric string:", n, err)
+	}
+	if x, _ := tc.Get("s"); x.(string) != "7" {
+		t.Error("numeric strings should stay strings, got", x)
+	}
+	tc.Set("i8", int8(120), DefaultExpiration)
+	if _, err := tc.IncrBy("i8", 10); err != ErrNotInteger {
+		t.Error("int8 overflow should fail, got", err)
+	}
+	tc.Set("max", int64(math.MaxInt64), DefaultExpiration)
+	if _, err := tc.IncrBy("max", 1); err != ErrNotInteger {
+		t.Error("int64 overflow should fail, got", err)
+	}
+	tc.Set("str", "abc", DefaultExpiration)
+	if _, err := tc.IncrBy("str", 1); err != ErrNotInteger {
+		t.Error("non-numeric string should fail, got", err)
+	}
+	tc.Set("u", uint(1), DefaultExpiration)
+	if _, err := tc.IncrBy("u", -2); err != ErrNotInteger {
+		t.Error("negative unsigned should fail, got", err)
+	}
+}
+
+func TestCache_IncrByFloat(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if f, err := tc.IncrByFloat("missing", 1.5); err != nil || f != 1.5 {
+		t.Error("IncrByFloat on a missing key:", f, err)
+	}
+	tc.Set("s", "10.5", DefaultExpiration)
+	if f, err := tc.IncrByFloat("s", 0.25); err != nil || f != 10.75 {
+		t.Error("IncrByFloat on a numeric string:", f, err)
+	}
+	if x, _ := tc.Get("s"); x.(string) != "10.75" {
+		t.Error("numeric strings should stay strings, got", x)
+	}
+	tc.Set("f32", float32(1), DefaultExpiration)
+	tc.IncrByFloat("f32", 1)
+	if x, _ := tc.Get("f32"); x.(float32) != 2 {
+		t.Error("float32 should stay float32, got", x)
+	}
+	tc.Set("i", 3, DefaultExpiration)
+	if f, err := tc.IncrByFloat("i", 0.5); err != nil || f != 3.5 {
+		t.Error("IncrByFloat on an int:", f, err)
+	}
+	tc.Set("str", "abc", DefaultExpiration)
+	if _, err := tc.IncrByFloat("str", 1); err != ErrNotFloat {
+		t.Error("non-numeric string should fail, got", err)
+	}
+	tc.Set("max", math.MaxFloat64, DefaultExpiration)
+	if _, err := tc.IncrByFloat("max", math.MaxFloat64); err != ErrNotFloat {
+		t.Error("overflow to infinity should fail, got", err)
+	}
+}
+
+func TestCache_GetSet_GetDel_GetEx(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if _, found := tc.GetSet("a", 1, DefaultExpiration); found {
+		t.Error("GetSet found a missing key")
+	}
+	if x, found := tc.GetSet("a", 2, DefaultExpiration); !found || x.(int) != 1 {
+		t.Error("GetSet should return the old value, got", x)
+	}
+	if x, found := tc.GetEx("a", time.Hour); !found || x.(int) != 2 {
+		t.Error("GetEx returned", x, found)
+	}
+	if d, _ := tc.TTL("a"); d <= 0 || d > time.Hour {
+		t.Error("GetEx did not set the expiration:", d)
+	}
+	tc.GetEx("a", NoExpiration)
+	if d, _ := tc.TTL("a"); d != NoExpiration {
+		t.Error("GetEx with NoExpiration should persist the key:", d)
+	}
+	if x, found := tc.GetDel("a"); !found || x.(int) != 2 {
+		t.Error("GetDel returned", x, found)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("GetDel did not delete a")
+	}
+	if _, found := tc.GetDel("a"); found {
+		t.Error("GetDel found a deleted key")
+	}
+}
+
+func TestCache_MSet_MGet(t *testing.T) {
+	tc := NewCache(Config{Shards: 8})
+	tc.MSet(map[string]any{"a": 1, "b": 2, "c": 3}, DefaultExpiration)
+	values := tc.MGet("a", "missing", "c")
+	if len(values) != 3 || values[0] != 1 || values[1] != nil || values[2] != 3 {
+		t.Error("unexpected MGet result:", values)
+	}
+	if tc.MSetNX(map[string]any{"c": 30, "d": 4}, DefaultExpiration) {
+		t.Error("MSetNX set keys although c exists")
+	}
+	if _, found := tc.Get("d"); found {
+		t.Error("MSetNX partially applied")
+	}
+	if !tc.MSetNX(map[string]any{"d": 4, "e": 5}, DefaultExpiration) {
+		t.Error("MSetNX did not set missing keys")
+	}
+	if tc.ItemCount() != 5 {
+		t.Error("expected 5 items, got", tc.ItemCount())
+	}
+}
+
+func TestCache_Append_StrLen(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if n, err := tc.Append("s", "foo"); err != nil || n != 3 {
+		t.Error("Append to a missing key:", n, err)
+	}
+	if n, err := tc.Append("s", "bar"); err != nil || n != 6 {
+		t.Error("Append:", n, err)
+	}
+	if x, _ := tc.Get("s"); x.(string) != "foobar" {
+		t.Error("s should be foobar, got", x)
+	}
+	tc.Set("b", []byte("ab"), DefaultExpiration)
+	tc.Append("b", "c")
+	if x, _ := tc.Get("b"); string(x.([]byte)) != "abc" {
+		t.Error("[]byte values should stay []byte, got", x)
+	}
+	tc.Set("n", 12, DefaultExpiration)
+	if n, err := tc.StrLen("n"); err != nil || n != 2 {
+		t.Error("StrLen of a number:", n, err)
+	}
+	if n, err := tc.StrLen("missing"); err != nil || n != 0 {
+		t.Error("StrLen of a missing key:", n, err)
+	}
+	tc.HSet("h", "f", 1)
+	if _, err := tc.Append("h", "x"); err != ErrWrongType {
+		t.Error("Append to a hash should fail, got", err)
+	}
+	if _, err := tc.StrLen("h"); err != ErrWrongType {
+		t.Error("StrLen of a hash should fail, got", err)
+	}
+}
+
+func TestCache_GetRange_SetRange(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.Set("s", "This is a string", DefaultExpiration)
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{5, 2, ""},
+		{-100, 1, "Th"},
+	}
+	for _, tt := range tests {
+		if got, err := tc.GetRange("s", tt.start, tt.end); err != nil || got != tt.want {
+			t.Errorf("GetRange(%d, %d) = %q, %v; want %q", tt.start, tt.end, got, err, tt.want)
+		}
+	}
+
+	tc.Set("h", "Hello World", DefaultExpiration)
+	if n, err := tc.SetRange("h", 6, "Redis"); err != nil || n != 11 {
+		t.Error("SetRange:", n, err)
+	}
+	if x, _ := tc.Get("h"); x.(string) != "Hello Redis" {
+		t.Error("h should be Hello Redis, got", x)
+	}
+	if n, err := tc.SetRange("p", 3, "x"); err != nil || n != 4 {
+		t.Error("SetRange on a missing key:", n, err)
+	}
+	if x, _ := tc.Get("p"); x.(string) != "\x00\x00\x00x" {
+		t.Errorf("SetRange should zero-pad, got %q", x)
+	}
+	if n, _ := tc.SetRange("empty", 5, ""); n != 0 {
+		t.Error("SetRange with an empty value should not create the key")
+	}
+	if _, found := tc.Get("empty"); found {
+		t.Error("SetRange with an empty value created the key")
+	}
+	if _, err := tc.SetRange("h", -1, "x"); err != ErrOutOfRange {
+		t.Error("negative offset should fail, got", err)
+	}
+	if _, err := tc.SetRange("h", math.MaxInt, "x"); err != ErrOutOfRange {
+		t.Error("an offset overflowing the length should fail, got", err)
+	}
+	if _, err := tc.SetRange("h", maxStringLength, "x"); err != ErrOutOfRange {
+		t.Error("an offset past the maximum length should fail, got", err)
+	}
+	tc.Set("h", "x", DefaultExpiration) // the shard is not left locked
+}
@@ -0,0 +1,247 @@
+package gocache
+
+import (
+	"container/list"
+	"sync"
+)
+
+const sketchDepth = 4
+
+// cmSketch is a count-min sketch of 4-bit-style saturating counters used by
+// W-TinyLFU to estimate key popularity. Counters are halved periodically so
+// that old popularity fades.
+type cmSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCMSketch(capacity int) *cmSketch {
+	// Eight counters per entry keeps collisions rare; the sample size of
+	// ten times the capacity follows the TinyLFU paper.
+	width := 16
+	for width < 8*capacity {
+		width <<= 1
+	}
+	s := &cmSketch{
+		mask:    uint64(width - 1),
+		resetAt: 10 * capacity,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *cmSketch) index(h uint64, i int) uint64 {
+	h1, h2 := h&0xffffffff, h>>32|1
+	return (h1 + uint64(i)*h2) & s.mask
+}
+
+func (s *cmSketch) estimate(h uint64) uint8 {
+	min := uint8(15)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(h, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// increment uses the conservative update rule: only the counters holding
+// the current minimum are raised.
+func (s *cmSketch) increment(h uint64) {
+	min := s.estimate(h)
+	if min == 15 {
+		return
+	}
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] == min {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func (s *cmSketch) clear() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
+
+// tinyLFU segments.
+const (
+	tlfuWindow = iota
+	tlfuProbation
+	tlfuProtected
+)
+
+type tlfuEntry struct {
+	key string
+	seg int
+}
+
+type tinyLFUPolicy struct {
+	mu           sync.Mutex
+	sketch       *cmSketch
+	segs         [3]*list.List
+	elems        map[string]*list.Element
+	windowCap    int
+	mainCap      int
+	protectedCap int
+}
+
+// NewTinyLFUPolicy returns a W-TinyLFU policy: new keys enter a small LRU
+// window, and a key leaving the window is only admitted to the main
+// segmented LRU if a count-min sketch estimates it to be more popular than
+// the main segment's own victim.
+func NewTinyLFUPolicy(capacity int) EvictionPolicy {
+	if capacity < 2 {
+		capacity = 2
+	}
+	windowCap := capacity / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	t := &tinyLFUPolicy{
+		sketch:    newCMSketch(capacity),
+		elems:     make(map[string]*list.Element),
+		windowCap: windowCap,
+		mainCap:   capacity - windowCap,
+	}
+	t.protectedCap = t.mainCap * 8 / 10
+	for i := range t.segs {
+		t.segs[i] = list.New()
+	}
+	return t
+}
+
+func (t *tinyLFUPolicy) move(e *list.Element, to int) *list.Element {
+	ent := e.Value.(*tlfuEntry)
+	t.segs[ent.seg].Remove(e)
+	ent.seg = to
+	e = t.segs[to].PushFront(ent)
+	t.elems[ent.key] = e
+	return e
+}
+
+// hit records a use of a resident key, promoting it through the segments.
+func (t *tinyLFUPolicy) hit(k string) {
+	t.sketch.increment(hashKey(k))
+	e, ok := t.elems[k]
+	if !ok {
+		return
+	}
+	switch e.Value.(*tlfuEntry).seg {
+	case tlfuWindow:
+		t.segs[tlfuWindow].MoveToFront(e)
+	case tlfuProbation:
+		t.move(e, tlfuProtected)
+		for t.segs[tlfuProtected].Len() > t.protectedCap {
+			t.move(t.segs[tlfuProtected].Back(), tlfuProbation)
+		}
+	case tlfuProtected:
+		t.segs[tlfuProtected].MoveToFront(e)
+	}
+}
+
+func (t *tinyLFUPolicy) Access(k string) {
+	t.mu.Lock()
+	t.hit(k)
+	t.mu.Unlock()
+}
+
+func (t *tinyLFUPolicy) Insert(k string) {
+	t.mu.Lock()
+	if _, ok := t.elems[k]; ok {
+		t.hit(k)
+	} else {
+		t.sketch.increment(hashKey(k))
+		t.elems[k] = t.segs[tlfuWindow].PushFront(&tlfuEntry{key: k, seg: tlfuWindow})
+		// While the main segment has room, keys leaving the window are
+		// admitted without a contest.
+		for t.segs[tlfuWindow].Len() > t.windowCap && t.mainLen() < t.mainCap {
+			t.move(t.segs[tlfuWindow].Back(), tlfuProbation)
+		}
+	}
+	t.mu.Unlock()
+}
+
+func (t *tinyLFUPolicy) Remove(k string) {
+	t.mu.Lock()
+	if e, ok := t.elems[k]; ok {
+		t.segs[e.Value.(*tlfuEntry).seg].Remove(e)
+		delete(t.elems, k)
+	}
+	t.mu.Unlock()
+}
+
+func (t *tinyLFUPolicy) mainLen() int {
+	return t.segs[tlfuProbation].Len() + t.segs[tlfuProtected].Len()
+}
+
+// mainVictim is the key the main segment would give up: the probation LRU,
+// or the protected LRU if probation is empty.
+func (t *tinyLFUPolicy) mainVictim() *list.Element {
+	if e := t.segs[tlfuProbation].Back(); e != nil {
+		return e
+	}
+	return t.segs[tlfuProtected].Back()
+}
+
+func (t *tinyLFUPolicy) Victim() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	window := t.segs[tlfuWindow]
+	for window.Len() > t.windowCap {
+		cand := window.Back()
+		if t.mainLen() < t.mainCap {
+			t.move(cand, tlfuProbation)
+			continue
+		}
+		victim := t.mainVictim()
+		if victim == nil {
+			break
+		}
+		ck, vk := cand.Value.(*tlfuEntry).key, victim.Value.(*tlfuEntry).key
+		if t.sketch.estimate(hashKey(ck)) > t.sketch.estimate(hashKey(vk)) {
+			t.move(cand, tlfuProbation)
+			return vk, true
+		}
+		return ck, true
+	}
+	if e := t.mainVictim(); e != nil {
+		return e.Value.(*tlfuEntry).key, true
+	}
+	if e := window.Back(); e != nil {
+		return e.Value.(*tlfuEntry).key, true
+	}
+	return "", false
+}
+
+func (t *tinyLFUPolicy) Reset() {
+	t.mu.Lock()
+	for _, l := range t.segs {
+		l.Init()
+	}
+	t.elems = make(map[string]*list.Element)
+	t.sketch.clear()
+	t.mu.Unlock()
+}
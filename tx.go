@@ -0,0 +1,199 @@
+package gocache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTxAborted is returned by Exec when a watched key changed after it was
+// watched. Nothing was written; the transaction can be retried.
+var ErrTxAborted = errors.New("gocache: transaction aborted because a watched key changed")
+
+// Tx is a transaction: a batch of reads and writes applied atomically.
+// Writes are buffered in the Tx and only applied when the function passed
+// to Exec or Update returns nil, so an error leaves the cache untouched and
+// OnEvicted only fires for a committed transaction.
+//
+// The cache is locked while the function runs; it must use the methods of
+// the Tx and not those of the cache, which would deadlock.
+type Tx struct {
+	c       *cache
+	watched map[string]uint64 // key versions when watched
+	writes  map[string]txWrite
+	order   []string // written keys, in order
+}
+
+// txWrite is a buffered write: an item to store, or a deletion.
+type txWrite struct {
+	item    Item
+	deleted bool
+}
+
+// Watch returns a transaction that Exec aborts with ErrTxAborted if any of
+// keys is written, deleted or expires before it runs. Watch a key, read it,
+// then write a value derived from it in Exec, retrying on ErrTxAborted,
+// to update it without races. A key missing when watched is also seen as
+// changed if another key of its shard is deleted meanwhile, which aborts
+// Exec needlessly but never lets a change go unnoticed.
+func (c *cache) Watch(keys ...string) *Tx {
+	tx := &Tx{c: c}
+	tx.Watch(keys...)
+	return tx
+}
+
+// Update runs fn in a transaction. The writes fn makes through tx are
+// applied atomically if it returns nil and discarded otherwise, and its error
+// is returned.
+func (c *cache) Update(fn func(tx *Tx) error) error {
+	return (&Tx{c: c}).Exec(fn)
+}
+
+// version returns the version of the unexpired item under k, or 0 if there
+// is none. s.mu must be held.
+func (s *shard) version(k string) uint64 {
+	item, found := s.item(k)
+	if !found {
+		return 0
+	}
+	return item.version
+}
+
+// expiredVersion marks the version of an item that has expired but was not
+// removed yet.
+const expiredVersion = 1 << 63
+
+// watchVersion is like version, but returns a tombstone version for a
+// missing key rather than 0: that of the last removal from the shard, or,
+// if k has expired, its version with expiredVersion set. A key written then
+// deleted, or written then expired, thus no longer has the version it had
+// when missing. s.mu must be held.
+func (s *shard) watchVersion(k string) uint64 {
+	item, found := s.items[k]
+	switch {
+	case !found:
+		return s.removed
+	case (item.Expiration > 0 && s.c.now() > item.Expiration) || isCachedError(item):
+		return item.version | expiredVersion
+	}
+	return item.version
+}
+
+// Exec runs fn in the transaction, as Update does, unless a watched key has
+// changed, in which case it returns ErrTxAborted without calling fn. The
+// watches are cleared once Exec returns. With a Writer, the writes it fails
+// are not applied and the first of its errors is returned.
+func (tx *Tx) Exec(fn func(tx *Tx) error) error {
+	c := tx.c
+	c.lockAll()
+	for k, v := range tx.watched {
+		if c.shardFor(k).watchVersion(k) != v {
+			c.unlockAll()
+			tx.reset()
+			return ErrTxAborted
+		}
+	}
+	tx.writes = make(map[string]txWrite)
+	var evicted []keyAndValue
+	committed := false
+	defer func() {
+		c.unlockAll()
+		tx.reset()
+		if committed {
+			c.evict(evicted)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	values := make(map[string]any)
+	var deleted []string
+	for _, k := range tx.order {
+		if w := tx.writes[k]; w.deleted {
+			deleted = append(deleted, k)
+		} else {
+			values[k] = w.item.Object
+		}
+	}
+	failed := c.writeMany(values, deleted)
+	var err error
+	for _, k := range tx.order {
+		if failed[k] != nil {
+			if err == nil {
+				err = failed[k]
+			}
+			continue
+		}
+		w := tx.writes[k]
+		s := c.shardFor(k)
+		if w.deleted {
+			c.notifyDelete(s, EventDelete, k, "Exec")
+			if v, ok := s.delete(k); ok {
+				evicted = append(evicted, keyAndValue{k, v})
+			}
+			continue
+		}
+		c.log(aofRecord{Op: opSet, Key: k, Value: w.item.Object, Exp: w.item.Expiration})
+		c.notifySet(s, EventSet, k, w.item.Object, "Exec")
+		evicted = append(evicted, s.store(k, w.item)...)
+	}
+	committed = true
+	return err
+}
+
+// Watch adds keys to the keys watched by the transaction. A key already
+// watched keeps the version it had when first watched. Watch must be called
+// before Exec: it panics if called by the function Exec runs, which holds
+// the locks Watch needs.
+func (tx *Tx) Watch(keys ...string) {
+	if tx.writes != nil {
+		panic("gocache: Tx.Watch called inside Exec")
+	}
+	if tx.watched == nil {
+		tx.watched = make(map[string]uint64, len(keys))
+	}
+	for _, k := range keys {
+		if _, ok := tx.watched[k]; ok {
+			continue
+		}
+		s := tx.c.shardFor(k)
+		s.mu.RLock()
+		tx.watched[k] = s.watchVersion(k)
+		s.mu.RUnlock()
+	}
+}
+
+func (tx *Tx) reset() {
+	tx.watched = nil
+	tx.writes = nil
+	tx.order = nil
+}
+
+func (tx *Tx) write(k string, w txWrite) {
+	if _, ok := tx.writes[k]; !ok {
+		tx.order = append(tx.order, k)
+	}
+	tx.writes[k] = w
+}
+
+// Get returns the value of k, including writes made earlier in the
+// transaction.
+func (tx *Tx) Get(k string) (any, bool) {
+	if w, ok := tx.writes[k]; ok {
+		if w.deleted || w.item.Expired() {
+			return nil, false
+		}
+		return w.item.Object, true
+	}
+	return tx.c.shardFor(k).get(k)
+}
+
+// Set sets the value of k when the transaction commits. The expiration d is
+// interpreted as in Cache.Set.
+func (tx *Tx) Set(k string, x any, d time.Duration) {
+	tx.write(k, txWrite{item: Item{Object: x, Expiration: tx.c.expiration(d)}})
+}
+
+// Delete deletes k when the transaction commits.
+func (tx *Tx) Delete(k string) {
+	tx.write(k, txWrite{deleted: true})
+}
@@ -0,0 +1,149 @@
+package gocache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_Update(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	var evicted []string
+	tc.OnEvicted(func(k string, v any) {
+		evicted = append(evicted, k)
+	})
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, DefaultExpiration)
+
+	err := tc.Update(func(tx *Tx) error {
+		x, _ := tx.Get("a")
+		tx.Set("a", x.(int)+10, DefaultExpiration)
+		if x, _ := tx.Get("a"); x != 11 {
+			t.Error("Get should see earlier writes, got", x)
+		}
+		tx.Delete("b")
+		if _, found := tx.Get("b"); found {
+			t.Error("Get should see earlier deletions")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := tc.Get("a"); x != 11 {
+		t.Error("a was not committed:", x)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("b was not deleted")
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Error("OnEvicted should fire on commit, got", evicted)
+	}
+
+	evicted = nil
+	fail := errors.New("fail")
+	err = tc.Update(func(tx *Tx) error {
+		tx.Set("a", 100, DefaultExpiration)
+		tx.Delete("a")
+		tx.Set("c", 3, DefaultExpiration)
+		return fail
+	})
+	if err != fail {
+		t.Error("Update should return the error of fn, got", err)
+	}
+	if x, _ := tc.Get("a"); x != 11 {
+		t.Error("a rolled-back transaction changed a:", x)
+	}
+	if _, found := tc.Get("c"); found {
+		t.Error("a rolled-back transaction created c")
+	}
+	if evicted != nil {
+		t.Error("OnEvicted fired for a rolled-back transaction:", evicted)
+	}
+}
+
+func TestCache_Watch(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	tc.Set("a", 1, DefaultExpiration)
+	tx := tc.Watch("a", "missing")
+	tc.Set("a", 2, DefaultExpiration)
+	called := false
+	if err := tx.Exec(func(tx *Tx) error { called = true; return nil }); err != ErrTxAborted {
+		t.Error("Exec should abort when a watched key changed, got", err)
+	}
+	if called {
+		t.Error("an aborted transaction ran")
+	}
+
+	tx = tc.Watch("a", "missing")
+	tc.Set("missing", 1, DefaultExpiration)
+	if err := tx.Exec(func(tx *Tx) error { return nil }); err != ErrTxAborted {
+		t.Error("Exec should abort when a watched key was created, got", err)
+	}
+
+	tx = tc.Watch("a")
+	tc.Get("a")
+	tc.Set("other", 1, DefaultExpiration)
+	if err := tx.Exec(func(tx *Tx) error { return nil }); err != nil {
+		t.Error("reads and writes to other keys should not abort, got", err)
+	}
+
+	tx = tc.Watch("new")
+	tc.Set("new", 1, DefaultExpiration)
+	tc.Delete("new")
+	if err := tx.Exec(func(tx *Tx) error { return nil }); err != ErrTxAborted {
+		t.Error("Exec should abort when a watched key was created then deleted, got", err)
+	}
+	tx = tc.Watch("new")
+	tc.Set("new", 1, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if err := tx.Exec(func(tx *Tx) error { return nil }); err != ErrTxAborted {
+		t.Error("Exec should abort when a watched key was created then expired, got", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Watch inside Exec should panic")
+		}
+		tc.Set("a", 3, DefaultExpiration) // the cache is unlocked
+	}()
+	tc.Update(func(tx *Tx) error {
+		tx.Watch("a")
+		return nil
+	})
+}
+
+func TestCache_Watch_Concurrent(t *testing.T) {
+	tc := NewCache(Config{Shards: 4})
+	tc.Set("n", 0, DefaultExpiration)
+	const workers, incrs = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < incrs; j++ {
+				for {
+					tx := tc.Watch("n")
+					x, _ := tc.Get("n")
+					err := tx.Exec(func(tx *Tx) error {
+						tx.Set("n", x.(int)+1, DefaultExpiration)
+						return nil
+					})
+					if err == nil {
+						break
+					}
+					if err != ErrTxAborted {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if x, _ := tc.Get("n"); x != workers*incrs {
+		t.Errorf("lost updates: got %v, want %d", x, workers*incrs)
+	}
+}
@@ -0,0 +1,218 @@
+package gocache
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// TypedItem is the generic counterpart of Item.
+type TypedItem[V any] struct {
+	Object     V
+	Expiration int64
+}
+
+// Returns true if the item has expired.
+func (item TypedItem[V]) Expired() bool {
+	if item.Expiration == 0 {
+		return false
+	}
+	return time.Now().UnixNano() > item.Expiration
+}
+
+// TypedCache is a type-safe cache keyed by K and holding values of type V.
+// Values are stored as-is, so no type assertions are needed on retrieval.
+type TypedCache[K comparable, V any] struct {
+	*typedCache[K, V]
+	// See the comment on Cache about the embedded pointer.
+}
+
+type typedCache[K comparable, V any] struct {
+	defaultExpiration time.Duration
+	items             map[K]TypedItem[V]
+	mu                sync.RWMutex
+	onEvicted         func(K, V)
+	janitor           *janitor
+	group             Group[K, V]
+}
+
+// NewTypedCache returns a TypedCache configured by config. A TypedCache is a
+// single map under one lock: only DefaultExpiration and CleanupInterval
+// apply. It is not bounded, sharded, persisted nor backed by a store, so
+// NewTypedCache panics if MaxEntries, MaxCost, Shards (above 1), AOFPath,
+// Loader or Writer is set; use NewCache for those.
+func NewTypedCache[K comparable, V any](config Config) *TypedCache[K, V] {
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"MaxEntries", config.MaxEntries != 0},
+		{"MaxCost", config.MaxCost != 0},
+		{"Shards", config.Shards > 1},
+		{"AOFPath", config.AOFPath != ""},
+		{"Loader", config.Loader != nil},
+		{"Writer", config.Writer != nil},
+	} {
+		if f.set {
+			panic("gocache: NewTypedCache does not support Config." + f.name)
+		}
+	}
+	c := &typedCache[K, V]{
+		defaultExpiration: config.DefaultExpiration,
+		items:             make(map[K]TypedItem[V]),
+	}
+	C := &TypedCache[K, V]{c}
+
+	if config.CleanupInterval > 0 {
+		c.janitor = newJanitor(c, config.CleanupInterval)
+		runtime.SetFinalizer(C, stopTypedJanitor[K, V])
+	}
+	return C
+}
+
+func stopTypedJanitor[K comparable, V any](c *TypedCache[K, V]) {
+	c.janitor.Stop()
+}
+
+func (c *typedCache[K, V]) expiration(d time.Duration) int64 {
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	if d > 0 {
+		return time.Now().Add(d).UnixNano()
+	}
+	return 0
+}
+
+// Set adds an item to the cache, replacing any existing item.
+func (c *typedCache[K, V]) Set(k K, x V, d time.Duration) {
+	e := c.expiration(d)
+	c.mu.Lock()
+	c.items[k] = TypedItem[V]{
+		Object:     x,
+		Expiration: e,
+	}
+	c.mu.Unlock()
+}
+
+func (c *typedCache[K, V]) get(k K) (V, bool) {
+	item, found := c.items[k]
+	if !found || item.Expired() {
+		var zero V
+		return zero, false
+	}
+	return item.Object, true
+}
+
+// Get returns the item stored under k and whether it was found.
+func (c *typedCache[K, V]) Get(k K) (V, bool) {
+	c.mu.RLock()
+	v, found := c.get(k)
+	c.mu.RUnlock()
+	return v, found
+}
+
+// Delete removes k from the cache.
+func (c *typedCache[K, V]) Delete(k K) {
+	c.mu.Lock()
+	v, evicted := c.delete(k)
+	onEvicted := c.onEvicted
+	c.mu.Unlock()
+	if evicted {
+		onEvicted(k, v)
+	}
+}
+
+func (c *typedCache[K, V]) delete(k K) (V, bool) {
+	v, found := c.items[k]
+	delete(c.items, k)
+	if found && c.onEvicted != nil {
+		return v.Object, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Sets an (optional) function that is called with the key and value when an
+// item is evicted from the cache. (Including when it is deleted manually, but
+// not when it is overwritten.) Set to nil to disable.
+func (c *typedCache[K, V]) OnEvicted(f func(K, V)) {
+	c.mu.Lock()
+	c.onEvicted = f
+	c.mu.Unlock()
+}
+
+// DeleteExpired deletes expired items
+func (c *typedCache[K, V]) DeleteExpired() {
+	type kv struct {
+		key   K
+		value V
+	}
+	var evictedItems []kv
+	now := time.Now().UnixNano()
+	c.mu.Lock()
+	onEvicted := c.onEvicted
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			ov, evicted := c.delete(k)
+			if evicted {
+				evictedItems = append(evictedItems, kv{k, ov})
+			}
+		}
+	}
+	c.mu.Unlock()
+	for _, v := range evictedItems {
+		onEvicted(v.key, v.value)
+	}
+}
+
+// Copies all unexpired items in the cache into a new map and returns it.
+func (c *typedCache[K, V]) Items() map[K]TypedItem[V] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m := make(map[K]TypedItem[V], len(c.items))
+	now := time.Now().UnixNano()
+	for k, v := range c.items {
+		if v.Expiration > 0 && now > v.Expiration {
+			continue
+		}
+		m[k] = v
+	}
+	return m
+}
+
+// Returns the number of items in the cache. This may include items that have
+// expired, but have not yet been cleaned up.
+func (c *typedCache[K, V]) ItemCount() int {
+	c.mu.RLock()
+	n := len(c.items)
+	c.mu.RUnlock()
+	return n
+}
+
+// Delete all items from the cache.
+func (c *typedCache[K, V]) Flush() {
+	c.mu.Lock()
+	c.items = map[K]TypedItem[V]{}
+	c.mu.Unlock()
+}
+
+// Memoize executes and returns the results of the given function, unless there was a cached value of the same key.
+// Only one execution is in-flight for a given key at a time. The cache is not
+// locked while fn runs.
+func (c *typedCache[K, V]) Memoize(k K, fn func() (V, error), d time.Duration) (V, error) {
+	if value, found := c.Get(k); found {
+		return value, nil
+	}
+	value, err, _ := c.group.Do(k, func() (V, error) {
+		if value, found := c.Get(k); found {
+			return value, nil
+		}
+		data, innerErr := fn()
+		if innerErr == nil {
+			c.Set(k, data, d)
+		}
+		return data, innerErr
+	})
+	return value, err
+}
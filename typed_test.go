@@ -0,0 +1,124 @@
+package gocache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTypedCache(t *testing.T) {
+	tc := NewTypedCache[string, int](DefaultConfig)
+
+	a, found := tc.Get("a")
+	if found || a != 0 {
+		t.Error("Getting A found value that shouldn't exist:", a)
+	}
+
+	tc.Set("a", 1, DefaultExpiration)
+
+	a, found = tc.Get("a")
+	if !found {
+		t.Error("a was not found")
+	}
+	if a+2 != 3 {
+		t.Error("a (which should be 1) plus 2 does not equal 3; value:", a)
+	}
+	if tc.ItemCount() != 1 {
+		t.Error("count error :", tc.ItemCount())
+	}
+	tc.Flush()
+	if tc.ItemCount() != 0 {
+		t.Error("Flush error")
+	}
+}
+
+func TestTypedCacheTimes(t *testing.T) {
+	tc := NewTypedCache[int, string](Config{DefaultExpiration: 20 * time.Millisecond})
+	tc.Set(1, "a", DefaultExpiration)
+	tc.Set(2, "b", NoExpiration)
+
+	<-time.After(30 * time.Millisecond)
+	if _, found := tc.Get(1); found {
+		t.Error("Found 1 when it should have been automatically deleted")
+	}
+	if _, found := tc.Get(2); !found {
+		t.Error("Did not find 2 even though it was set to never expire")
+	}
+	items := tc.Items()
+	if len(items) != 1 || items[2].Object != "b" {
+		t.Error("unexpected items:", items)
+	}
+	tc.DeleteExpired()
+	if tc.ItemCount() != 1 {
+		t.Error("DeleteExpired left expired items:", tc.ItemCount())
+	}
+}
+
+func TestTypedCache_OnEvicted(t *testing.T) {
+	tc := NewTypedCache[string, []byte](DefaultConfig)
+	var evicted []byte
+	tc.OnEvicted(func(k string, v []byte) {
+		evicted = v
+	})
+	tc.Set("foo", []byte("bar"), DefaultExpiration)
+	tc.Delete("foo")
+	if string(evicted) != "bar" {
+		t.Errorf("OnEvicted got %q", evicted)
+	}
+	if _, found := tc.Get("foo"); found {
+		t.Error("foo was found, but it should have been deleted")
+	}
+}
+
+func TestTypedCache_Memoize(t *testing.T) {
+	tc := NewTypedCache[string, int](DefaultConfig)
+	calls := 0
+	fn := func() (int, error) {
+		calls++
+		return 42, nil
+	}
+	for i := 0; i < 3; i++ {
+		v, err := tc.Memoize("a", fn, NoExpiration)
+		if err != nil || v != 42 {
+			t.Error("memoize error :", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Error("fn was called", calls, "times")
+	}
+
+	errFail := errors.New("fail")
+	_, err := tc.Memoize("b", func() (int, error) {
+		return 0, errFail
+	}, NoExpiration)
+	if err != errFail {
+		t.Error("expected errFail, got", err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("failed result was cached")
+	}
+}
+
+func BenchmarkTypedCacheGetNotExpiring(b *testing.B) {
+	b.StopTimer()
+	tc := NewTypedCache[string, string](Config{DefaultExpiration: NoExpiration})
+	tc.Set("foo", "bar", DefaultExpiration)
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		tc.Get("foo")
+	}
+}
+
+func TestNewTypedCache_Unsupported(t *testing.T) {
+	for _, config := range []Config{{MaxEntries: 10}, {MaxCost: 10}, {Shards: 4}, {Writer: &mapStore{}}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewTypedCache(%+v) should panic", config)
+				}
+			}()
+			NewTypedCache[string, int](config)
+		}()
+	}
+	NewTypedCache[string, int](Config{Shards: 1})
+}
@@ -0,0 +1,538 @@
+package gocache
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrZAddFlags is returned by ZAdd for a combination of flags Redis rejects,
+// such as NX with XX.
+var ErrZAddFlags = errors.New("gocache: incompatible ZAdd flags")
+
+// Z is a sorted set member and its score.
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// ZAddFlag modifies the behavior of ZAdd and ZAddIncr, as the options of
+// the Redis ZADD command do.
+type ZAddFlag int
+
+const (
+	// ZAddNX only adds new members and never updates existing ones.
+	ZAddNX ZAddFlag = 1 << iota
+	// ZAddXX only updates existing members and never adds new ones.
+	ZAddXX
+	// ZAddGT only updates a member if its new score is greater.
+	ZAddGT
+	// ZAddLT only updates a member if its new score is lower.
+	ZAddLT
+	// ZAddCh makes ZAdd count updated members as well as added ones.
+	ZAddCh
+)
+
+func (f ZAddFlag) valid() bool {
+	return !(f&ZAddNX != 0 && f&(ZAddXX|ZAddGT|ZAddLT) != 0) &&
+		!(f&ZAddGT != 0 && f&ZAddLT != 0)
+}
+
+// zset is the value stored under a key by ZAdd: a map for score lookups and
+// a skiplist for ordered access.
+type zset struct {
+	dict map[string]float64
+	zsl  *skiplist
+}
+
+func newZSet() *zset {
+	return &zset{dict: map[string]float64{}, zsl: newSkiplist()}
+}
+
+// set adds member or changes its score.
+func (z *zset) set(member string, score float64) {
+	if cur, ok := z.dict[member]; ok {
+		if cur == score {
+			return
+		}
+		z.zsl.delete(cur, member)
+	}
+	z.dict[member] = score
+	z.zsl.insert(score, member)
+}
+
+func (z *zset) remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	delete(z.dict, member)
+	z.zsl.delete(score, member)
+	return true
+}
+
+// add applies one ZADD update and returns the resulting score, whether the
+// member was added and whether its score changed.
+func (z *zset) add(flags ZAddFlag, incr bool, m Z) (score float64, added, changed bool, err error) {
+	cur, exists := z.dict[m.Member]
+	if exists {
+		if flags&ZAddNX != 0 {
+			return cur, false, false, nil
+		}
+		score = m.Score
+		if incr {
+			score += cur
+			if math.IsNaN(score) {
+				return 0, false, false, ErrNotFloat
+			}
+		}
+		if (flags&ZAddGT != 0 && score <= cur) || (flags&ZAddLT != 0 && score >= cur) {
+			return cur, false, false, nil
+		}
+		if score != cur {
+			z.set(m.Member, score)
+			changed = true
+		}
+		return score, false, changed, nil
+	}
+	if flags&ZAddXX != 0 {
+		return 0, false, false, nil
+	}
+	z.set(m.Member, m.Score)
+	return m.Score, true, true, nil
+}
+
+func (z *zset) entries() []Z {
+	out := make([]Z, 0, len(z.dict))
+	for x := z.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		out = append(out, Z{x.member, x.score})
+	}
+	return out
+}
+
+// zset returns the unexpired sorted set stored under k. It returns
+// ErrWrongType if k holds something else. s.mu must be held.
+func (s *shard) zset(k string) (*zset, bool, error) {
+	item, found := s.item(k)
+	if !found {
+		return nil, false, nil
+	}
+	z, ok := item.Object.(*zset)
+	if !ok {
+		return nil, false, ErrWrongType
+	}
+	return z, true, nil
+}
+
+// ZAdd adds members to the sorted set stored under k, or updates their
+// scores, and returns the number of members added. With ZAddCh it returns
+// the number of members added or updated.
+func (c *cache) ZAdd(k string, flags ZAddFlag, members ...Z) (int, error) {
+	if !flags.valid() {
+		return 0, ErrZAddFlags
+	}
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNotFloat
+		}
+	}
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, _ := s.item(k)
+	z, found, err := s.zset(k)
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	if !found {
+		z = newZSet()
+		item = Item{Object: z}
+	}
+	var n int
+	var logged []Z
+	var delta int64
+	for _, m := range members {
+		score, added, changed, _ := z.add(flags, false, m)
+		if added || (changed && flags&ZAddCh != 0) {
+			n++
+		}
+		if added {
+			delta += zmemberCost(m.Member)
+		}
+		if changed {
+			logged = append(logged, Z{m.Member, score})
+		}
+	}
+	if len(z.dict) == 0 {
+		s.mu.Unlock()
+		return 0, nil
+	}
+	evicted := c.storeZSet(s, k, item, logged, delta)
+	s.mu.Unlock()
+	c.evict(evicted)
+	return n, nil
+}
+
+// ZAddIncr is ZAdd in INCR mode: it adds incr to the score of m.Member,
+// subject to flags, and returns the new score. It reports false if flags
+// prevented the update.
+func (c *cache) ZAddIncr(k string, flags ZAddFlag, m Z) (float64, bool, error) {
+	if !flags.valid() {
+		return 0, false, ErrZAddFlags
+	}
+	if math.IsNaN(m.Score) {
+		return 0, false, ErrNotFloat
+	}
+	s := c.shardFor(k)
+	s.mu.Lock()
+	item, _ := s.item(k)
+	z, found, err := s.zset(k)
+	if err != nil {
+		s.mu.Unlock()
+		return 0, false, err
+	}
+	if !found {
+		z = newZSet()
+		item = Item{Object: z}
+	}
+	_, exists := z.dict[m.Member]
+	score, added, changed, err := z.add(flags, true, m)
+	if err != nil || len(z.dict) == 0 {
+		s.mu.Unlock()
+		return 0, false, err
+	}
+	var updated []Z
+	if added || changed {
+		updated = []Z{{m.Member, score}}
+	}
+	var delta int64
+	if added {
+		delta = zmemberCost(m.Member)
+	}
+	evicted := c.storeZSet(s, k, item, updated, delta)
+	s.mu.Unlock()
+	c.evict(evicted)
+	// An increment of 0 changes nothing but still counts as applied.
+	applied := added || changed || (exists && flags&(ZAddNX|ZAddGT|ZAddLT) == 0)
+	return score, applied, nil
+}
+
+// ZIncrBy adds incr to the score of member in the sorted set stored under
+// k, adding it if needed, and returns the new score.
+func (c *cache) ZIncrBy(k string, incr float64, member string) (float64, error) {
+	score, _, err := c.ZAddIncr(k, 0, Z{member, incr})
+	return score, err
+}
+
+// storeZSet stores the sorted set in item, whose cost changed by delta, and
+// logs the updated members. s.mu must be held.
+func (c *cache) storeZSet(s *shard, k string, item Item, updated []Z, delta int64) []keyAndValue {
+	if len(updated) > 0 {
+		c.log(aofRecord{Op: opZAdd, Key: k, Members: zMembers(updated), Scores: zScores(updated)})
+	}
+	return s.storeDelta(k, item, delta)
+}
+
+// ZRem removes members from the sorted set stored under k and returns the
+// number that were present. The key is deleted once the set is empty.
+func (c *cache) ZRem(k string, members ...string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return 0, err
+	}
+	var removed []string
+	for _, m := range members {
+		if z.remove(m) {
+			removed = append(removed, m)
+		}
+	}
+	c.zremoved(s, k, z, removed, "ZRem")
+	return len(removed), nil
+}
+
+// zremoved logs the removal of members from z and stores or deletes it.
+// s.mu must be held.
+func (c *cache) zremoved(s *shard, k string, z *zset, removed []string, cause string) {
+	if len(removed) == 0 {
+		return
+	}
+	c.log(aofRecord{Op: opZRem, Key: k, Members: removed})
+	if len(z.dict) == 0 {
+		c.notifyDelete(s, EventDelete, k, cause)
+		s.delete(k)
+	} else {
+		var delta int64
+		for _, m := range removed {
+			delta -= zmemberCost(m)
+		}
+		s.storeDelta(k, s.items[k], delta)
+	}
+}
+
+// ZScore returns the score of member in the sorted set stored under k.
+func (c *cache) ZScore(k, member string) (float64, bool, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return 0, false, err
+	}
+	s.touch(k)
+	score, ok := z.dict[member]
+	return score, ok, nil
+}
+
+// ZCard returns the number of members of the sorted set stored under k.
+func (c *cache) ZCard(k string) (int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return 0, err
+	}
+	return len(z.dict), nil
+}
+
+// ZRank returns the 0-based rank of member in the sorted set stored under
+// k, ordered from the lowest score.
+func (c *cache) ZRank(k, member string) (int, bool, error) {
+	return c.zrank(k, member, false)
+}
+
+// ZRevRank returns the 0-based rank of member in the sorted set stored
+// under k, ordered from the highest score.
+func (c *cache) ZRevRank(k, member string) (int, bool, error) {
+	return c.zrank(k, member, true)
+}
+
+func (c *cache) zrank(k, member string, rev bool) (int, bool, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return 0, false, err
+	}
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false, nil
+	}
+	s.touch(k)
+	r := z.zsl.rank(score, member)
+	if rev {
+		r = z.zsl.length - 1 - r
+	}
+	return r, true, nil
+}
+
+// ZRange returns the members of the sorted set stored under k with ranks
+// between start and stop, inclusive, ordered from the lowest score. Negative
+// ranks count from the end, as in Redis.
+func (c *cache) ZRange(k string, start, stop int) ([]Z, error) {
+	return c.zrangeByRank(k, start, stop, false)
+}
+
+// ZRevRange is like ZRange, ordered from the highest score.
+func (c *cache) ZRevRange(k string, start, stop int) ([]Z, error) {
+	return c.zrangeByRank(k, start, stop, true)
+}
+
+func (c *cache) zrangeByRank(k string, start, stop int, rev bool) ([]Z, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return nil, err
+	}
+	s.touch(k)
+	start, stop, ok := rankRange(start, stop, z.zsl.length)
+	if !ok {
+		return []Z{}, nil
+	}
+	var x *skiplistNode
+	if rev {
+		x = z.zsl.byRank(z.zsl.length - 1 - start)
+	} else {
+		x = z.zsl.byRank(start)
+	}
+	out := make([]Z, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		out = append(out, Z{x.member, x.score})
+		x = next(x, rev)
+	}
+	return out, nil
+}
+
+// rankRange converts Redis-style start and stop indexes, which may be
+// negative, into a valid inclusive range for a sequence of length n.
+func rankRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop, start <= stop
+}
+
+func next(x *skiplistNode, rev bool) *skiplistNode {
+	if rev {
+		return x.backward
+	}
+	return x.level[0].forward
+}
+
+// ZRangeByScore returns the members of the sorted set stored under k with
+// scores in r, ordered from the lowest score. It skips offset members and
+// returns at most count; a negative count means no limit.
+func (c *cache) ZRangeByScore(k string, r ScoreRange, offset, count int) ([]Z, error) {
+	return c.zrangeBy(k, r, offset, count, false)
+}
+
+// ZRevRangeByScore is like ZRangeByScore, ordered from the highest score.
+func (c *cache) ZRevRangeByScore(k string, r ScoreRange, offset, count int) ([]Z, error) {
+	return c.zrangeBy(k, r, offset, count, true)
+}
+
+// ZRangeByLex returns the members of the sorted set stored under k that
+// fall in r, with the same offset and count limits as ZRangeByScore. As in
+// Redis, the result is only meaningful if all members have the same score.
+func (c *cache) ZRangeByLex(k string, r LexRange, offset, count int) ([]string, error) {
+	zs, err := c.zrangeBy(k, r, offset, count, false)
+	if err != nil {
+		return nil, err
+	}
+	return zMembers(zs), nil
+}
+
+func (c *cache) zrangeBy(k string, r zrange, offset, count int, rev bool) ([]Z, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return nil, err
+	}
+	s.touch(k)
+	var x *skiplistNode
+	if rev {
+		x = z.zsl.last(r)
+	} else {
+		x = z.zsl.first(r)
+	}
+	for ; x != nil && offset > 0; offset-- {
+		x = next(x, rev)
+	}
+	out := []Z{}
+	for ; x != nil && count != 0; count-- {
+		if (rev && !r.aboveMin(x)) || (!rev && !r.belowMax(x)) {
+			break
+		}
+		out = append(out, Z{x.member, x.score})
+		x = next(x, rev)
+	}
+	return out, nil
+}
+
+// ZCount returns the number of members of the sorted set stored under k
+// with scores in r.
+func (c *cache) ZCount(k string, r ScoreRange) (int, error) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return 0, err
+	}
+	first := z.zsl.first(r)
+	if first == nil {
+		return 0, nil
+	}
+	last := z.zsl.last(r)
+	return z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1, nil
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores
+// from the sorted set stored under k.
+func (c *cache) ZPopMin(k string, count int) ([]Z, error) {
+	return c.zpop(k, count, false)
+}
+
+// ZPopMax removes and returns up to count members with the highest scores
+// from the sorted set stored under k.
+func (c *cache) ZPopMax(k string, count int) ([]Z, error) {
+	return c.zpop(k, count, true)
+}
+
+func (c *cache) zpop(k string, count int, max bool) ([]Z, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z, found, err := s.zset(k)
+	if !found || count <= 0 {
+		return nil, err
+	}
+	var out []Z
+	for ; count > 0 && z.zsl.length > 0; count-- {
+		x := z.zsl.header.level[0].forward
+		if max {
+			x = z.zsl.tail
+		}
+		out = append(out, Z{x.member, x.score})
+		z.remove(x.member)
+	}
+	cause := "ZPopMin"
+	if max {
+		cause = "ZPopMax"
+	}
+	c.zremoved(s, k, z, zMembers(out), cause)
+	return out, nil
+}
+
+// ZRemRangeByScore removes the members of the sorted set stored under k
+// with scores in r and returns how many were removed.
+func (c *cache) ZRemRangeByScore(k string, r ScoreRange) (int, error) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z, found, err := s.zset(k)
+	if !found {
+		return 0, err
+	}
+	var removed []string
+	for x := z.zsl.first(r); x != nil && r.belowMax(x); {
+		nx := x.level[0].forward
+		removed = append(removed, x.member)
+		z.remove(x.member)
+		x = nx
+	}
+	c.zremoved(s, k, z, removed, "ZRemRangeByScore")
+	return len(removed), nil
+}
+
+func zMembers(zs []Z) []string {
+	m := make([]string, len(zs))
+	for i, z := range zs {
+		m[i] = z.Member
+	}
+	return m
+}
+
+func zScores(zs []Z) []float64 {
+	f := make([]float64, len(zs))
+	for i, z := range zs {
+		f[i] = z.Score
+	}
+	return f
+}
@@ -0,0 +1,188 @@
+package gocache
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var inf = math.Inf(1)
+
+func newLeaderboard() *Cache {
+	tc := NewCache(DefaultConfig)
+	tc.ZAdd("z", 0, Z{"a", 1}, Z{"b", 2}, Z{"c", 3}, Z{"d", 4}, Z{"e", 5})
+	return tc
+}
+
+func TestCache_ZAdd(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if n, err := tc.ZAdd("z", 0, Z{"a", 1}, Z{"b", 2}); err != nil || n != 2 {
+		t.Error("ZAdd:", n, err)
+	}
+	if n, _ := tc.ZAdd("z", 0, Z{"a", 10}, Z{"c", 3}); n != 1 {
+		t.Error("ZAdd should count only new members, got", n)
+	}
+	if n, _ := tc.ZAdd("z", ZAddCh, Z{"a", 11}, Z{"b", 2}); n != 1 {
+		t.Error("ZAdd with ZAddCh should count changed members, got", n)
+	}
+	if n, _ := tc.ZAdd("z", ZAddNX, Z{"a", 0}, Z{"d", 4}); n != 1 {
+		t.Error("ZAdd with ZAddNX:", n)
+	}
+	if s, _, _ := tc.ZScore("z", "a"); s != 11 {
+		t.Error("ZAddNX updated an existing member:", s)
+	}
+	if n, _ := tc.ZAdd("z", ZAddXX, Z{"a", 12}, Z{"e", 5}); n != 0 {
+		t.Error("ZAdd with ZAddXX:", n)
+	}
+	if _, found, _ := tc.ZScore("z", "e"); found {
+		t.Error("ZAddXX added a new member")
+	}
+	tc.ZAdd("z", ZAddGT, Z{"a", 1}, Z{"b", 20})
+	tc.ZAdd("z", ZAddLT, Z{"c", 30}, Z{"d", 0})
+	want := map[string]float64{"a": 12, "b": 20, "c": 3, "d": 0}
+	for m, w := range want {
+		if s, _, _ := tc.ZScore("z", m); s != w {
+			t.Errorf("score of %s is %v, want %v", m, s, w)
+		}
+	}
+	if n, _ := tc.ZCard("z"); n != 4 {
+		t.Error("ZCard:", n)
+	}
+	if _, err := tc.ZAdd("z", ZAddNX|ZAddXX, Z{"a", 1}); err != ErrZAddFlags {
+		t.Error("NX with XX should fail, got", err)
+	}
+	if _, err := tc.ZAdd("z", ZAddGT|ZAddLT, Z{"a", 1}); err != ErrZAddFlags {
+		t.Error("GT with LT should fail, got", err)
+	}
+	if _, err := tc.ZAdd("z", 0, Z{"a", math.NaN()}); err != ErrNotFloat {
+		t.Error("a NaN score should fail, got", err)
+	}
+	tc.ZAdd("empty", ZAddXX, Z{"a", 1})
+	if _, found := tc.Get("empty"); found {
+		t.Error("ZAdd with ZAddXX created an empty sorted set")
+	}
+	tc.Set("str", "x", DefaultExpiration)
+	if _, err := tc.ZAdd("str", 0, Z{"a", 1}); err != ErrWrongType {
+		t.Error("ZAdd to a string should fail, got", err)
+	}
+}
+
+func TestCache_ZAddIncr_ZIncrBy(t *testing.T) {
+	tc := NewCache(DefaultConfig)
+	if s, err := tc.ZIncrBy("z", 2.5, "a"); err != nil || s != 2.5 {
+		t.Error("ZIncrBy on a missing member:", s, err)
+	}
+	if s, _ := tc.ZIncrBy("z", -1, "a"); s != 1.5 {
+		t.Error("ZIncrBy:", s)
+	}
+	if _, ok, _ := tc.ZAddIncr("z", ZAddNX, Z{"a", 1}); ok {
+		t.Error("ZAddIncr with ZAddNX updated an existing member")
+	}
+	if _, ok, _ := tc.ZAddIncr("z", ZAddGT, Z{"a", -1}); ok {
+		t.Error("ZAddIncr with ZAddGT lowered a score")
+	}
+	if s, ok, _ := tc.ZAddIncr("z", ZAddGT, Z{"a", 1}); !ok || s != 2.5 {
+		t.Error("ZAddIncr with ZAddGT:", s, ok)
+	}
+	tc.ZAdd("z", 0, Z{"inf", inf})
+	if _, err := tc.ZIncrBy("z", -inf, "inf"); err != ErrNotFloat {
+		t.Error("a NaN result should fail, got", err)
+	}
+}
+
+func TestCache_ZRem_ZRank(t *testing.T) {
+	tc := newLeaderboard()
+	if r, ok, _ := tc.ZRank("z", "b"); !ok || r != 1 {
+		t.Error("ZRank:", r, ok)
+	}
+	if r, ok, _ := tc.ZRevRank("z", "b"); !ok || r != 3 {
+		t.Error("ZRevRank:", r, ok)
+	}
+	if _, ok, _ := tc.ZRank("z", "missing"); ok {
+		t.Error("ZRank found a missing member")
+	}
+	if n, _ := tc.ZRem("z", "b", "missing"); n != 1 {
+		t.Error("ZRem:", n)
+	}
+	if r, _, _ := tc.ZRank("z", "c"); r != 1 {
+		t.Error("ZRank after ZRem:", r)
+	}
+	tc.ZRem("z", "a", "c", "d", "e")
+	if _, found := tc.Get("z"); found {
+		t.Error("an empty sorted set should be deleted")
+	}
+}
+
+func TestCache_ZRange(t *testing.T) {
+	tc := newLeaderboard()
+	if zs, _ := tc.ZRange("z", 0, 1); !reflect.DeepEqual(zs, []Z{{"a", 1}, {"b", 2}}) {
+		t.Error("ZRange:", zs)
+	}
+	if zs, _ := tc.ZRange("z", -2, 100); !reflect.DeepEqual(zs, []Z{{"d", 4}, {"e", 5}}) {
+		t.Error("ZRange with negative indexes:", zs)
+	}
+	if zs, _ := tc.ZRevRange("z", 0, 2); !reflect.DeepEqual(zMembers(zs), []string{"e", "d", "c"}) {
+		t.Error("ZRevRange:", zs)
+	}
+	if zs, _ := tc.ZRange("z", 3, 1); len(zs) != 0 {
+		t.Error("ZRange with start > stop:", zs)
+	}
+
+	r := ScoreRange{Min: 2, Max: 5, MaxExclusive: true}
+	if zs, _ := tc.ZRangeByScore("z", r, 0, -1); !reflect.DeepEqual(zMembers(zs), []string{"b", "c", "d"}) {
+		t.Error("ZRangeByScore:", zs)
+	}
+	if zs, _ := tc.ZRangeByScore("z", r, 1, 1); !reflect.DeepEqual(zMembers(zs), []string{"c"}) {
+		t.Error("ZRangeByScore with a limit:", zs)
+	}
+	if zs, _ := tc.ZRevRangeByScore("z", ScoreRange{Min: -inf, Max: inf}, 0, 2); !reflect.DeepEqual(zMembers(zs), []string{"e", "d"}) {
+		t.Error("ZRevRangeByScore:", zs)
+	}
+	if n, _ := tc.ZCount("z", r); n != 3 {
+		t.Error("ZCount:", n)
+	}
+	if n, _ := tc.ZCount("z", ScoreRange{Min: 10, Max: 20}); n != 0 {
+		t.Error("ZCount of an empty range:", n)
+	}
+
+	tc.ZAdd("lex", 0, Z{"apple", 0}, Z{"banana", 0}, Z{"cherry", 0}, Z{"date", 0})
+	if m, _ := tc.ZRangeByLex("lex", LexRange{Min: "b", MaxInf: true}, 0, -1); !reflect.DeepEqual(m, []string{"banana", "cherry", "date"}) {
+		t.Error("ZRangeByLex:", m)
+	}
+	if m, _ := tc.ZRangeByLex("lex", LexRange{Min: "apple", MinExclusive: true, Max: "date", MaxExclusive: true}, 1, 5); !reflect.DeepEqual(m, []string{"cherry"}) {
+		t.Error("ZRangeByLex with exclusive ends and a limit:", m)
+	}
+}
+
+func TestCache_ZPop_ZRemRangeByScore(t *testing.T) {
+	tc := newLeaderboard()
+	if zs, _ := tc.ZPopMin("z", 2); !reflect.DeepEqual(zs, []Z{{"a", 1}, {"b", 2}}) {
+		t.Error("ZPopMin:", zs)
+	}
+	if zs, _ := tc.ZPopMax("z", 1); !reflect.DeepEqual(zs, []Z{{"e", 5}}) {
+		t.Error("ZPopMax:", zs)
+	}
+	if n, _ := tc.ZRemRangeByScore("z", ScoreRange{Min: 3, Max: 3}); n != 1 {
+		t.Error("ZRemRangeByScore:", n)
+	}
+	if zs, _ := tc.ZRange("z", 0, -1); !reflect.DeepEqual(zs, []Z{{"d", 4}}) {
+		t.Error("remaining members:", zs)
+	}
+	tc.ZPopMax("z", 10)
+	if _, found := tc.Get("z"); found {
+		t.Error("popping every member should delete the sorted set")
+	}
+}
+
+func TestCache_ZSet_Expiration(t *testing.T) {
+	tc := newLeaderboard()
+	tc.SetExpiration("z", 10*time.Millisecond)
+	<-time.After(20 * time.Millisecond)
+	if n, _ := tc.ZCard("z"); n != 0 {
+		t.Error("an expired sorted set should be empty, got", n)
+	}
+	if n, _ := tc.ZAdd("z", 0, Z{"x", 1}); n != 1 {
+		t.Error("ZAdd to an expired sorted set should start a new one")
+	}
+}